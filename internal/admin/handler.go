@@ -0,0 +1,384 @@
+package admin
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/google/uuid"
+	"github.com/nathansiegfrid/todolist/internal/auth"
+	"github.com/nathansiegfrid/todolist/pkg/handler"
+	"github.com/nathansiegfrid/todolist/pkg/request"
+	"github.com/nathansiegfrid/todolist/pkg/response"
+	"github.com/nathansiegfrid/todolist/pkg/token"
+)
+
+// impersonationTokenDuration is short, and impersonation tokens can't be refreshed.
+const impersonationTokenDuration = 15 * time.Minute
+
+var (
+	errSelf        = response.Error(http.StatusBadRequest, "Admins can't perform this action on themselves.")
+	errImpersonate = response.Error(http.StatusForbidden, "Admins and disabled users can't be impersonated.")
+)
+
+type userRepository interface {
+	GetAll(ctx context.Context, filter *auth.UserFilter) ([]*auth.User, *response.Page, error)
+	Get(ctx context.Context, id uuid.UUID) (*auth.User, error)
+	Delete(ctx context.Context, id uuid.UUID, hooks ...auth.TxHook) error
+	SetDisabled(ctx context.Context, id uuid.UUID, disabled bool, hooks ...auth.TxHook) error
+	SetRole(ctx context.Context, id uuid.UUID, role string, hooks ...auth.TxHook) error
+}
+
+type repository interface {
+	GetAuditLogs(ctx context.Context, filter *AuditLogFilter) ([]*AuditLog, *response.Page, error)
+	CreateAuditLog(ctx context.Context, l *AuditLog) error
+	AuditHook(l *AuditLog) auth.TxHook
+}
+
+// Config contains the dependencies of Handler.
+type Config struct {
+	JWTAuth     *token.JWTAuth
+	Revocations token.RevocationStore
+	Cursors     *token.Signer // Signs pagination cursors.
+}
+
+// Handler serves the admin API. Routes must be protected by RequireRole middleware.
+// Every action is recorded in the audit log.
+type Handler struct {
+	repository  repository
+	users       userRepository
+	jwtAuth     *token.JWTAuth
+	revocations token.RevocationStore
+}
+
+func NewHandler(db *sql.DB, config *Config) *Handler {
+	return &Handler{
+		repository:  NewRepository(db, config.Cursors),
+		users:       auth.NewRepository(db, config.Cursors),
+		jwtAuth:     config.JWTAuth,
+		revocations: config.Revocations,
+	}
+}
+
+func (h *Handler) HandleUsersRoute() http.HandlerFunc {
+	return handler.MethodHandler{
+		"GET": handler.ErrorHandlerFunc(h.getAllUsers),
+	}.HandlerFunc()
+}
+
+func (h *Handler) HandleUsersIDRoute() http.HandlerFunc {
+	return handler.MethodHandler{
+		"GET":    handler.ErrorHandlerFunc(h.getUser),
+		"DELETE": handler.ErrorHandlerFunc(h.deleteUser),
+	}.HandlerFunc()
+}
+
+func (h *Handler) HandleUsersIDDisableRoute() http.HandlerFunc {
+	return handler.MethodHandler{
+		"POST": handler.ErrorHandlerFunc(h.disableUser),
+	}.HandlerFunc()
+}
+
+func (h *Handler) HandleUsersIDEnableRoute() http.HandlerFunc {
+	return handler.MethodHandler{
+		"POST": handler.ErrorHandlerFunc(h.enableUser),
+	}.HandlerFunc()
+}
+
+func (h *Handler) HandleUsersIDRoleRoute() http.HandlerFunc {
+	return handler.MethodHandler{
+		"PUT": handler.ErrorHandlerFunc(h.setUserRole),
+	}.HandlerFunc()
+}
+
+func (h *Handler) HandleUsersIDImpersonateRoute() http.HandlerFunc {
+	return handler.MethodHandler{
+		"POST": handler.ErrorHandlerFunc(h.impersonateUser),
+	}.HandlerFunc()
+}
+
+func (h *Handler) HandleAuditLogsRoute() http.HandlerFunc {
+	return handler.MethodHandler{
+		"GET": handler.ErrorHandlerFunc(h.getAllAuditLogs),
+	}.HandlerFunc()
+}
+
+func (h *Handler) getAllUsers(w http.ResponseWriter, r *http.Request) error {
+	// Read URL query.
+	filter, err := request.ReadURLQuery[auth.UserFilter](r)
+	if err != nil {
+		return err
+	}
+
+	err = h.audit(r, actionUserList, uuid.Nil, filter)
+	if err != nil {
+		return err
+	}
+
+	users, page, err := h.users.GetAll(r.Context(), filter)
+	if err != nil {
+		return err
+	}
+
+	return response.WritePage(w, r, users, page)
+}
+
+func (h *Handler) getUser(w http.ResponseWriter, r *http.Request) error {
+	// Read request param "id".
+	id, err := request.ReadID(r)
+	if err != nil {
+		return err
+	}
+
+	err = h.audit(r, actionUserGet, id, nil)
+	if err != nil {
+		return err
+	}
+
+	user, err := h.users.Get(r.Context(), id)
+	if err != nil {
+		return err
+	}
+
+	return response.WriteJSON(w, user)
+}
+
+func (h *Handler) deleteUser(w http.ResponseWriter, r *http.Request) error {
+	// Read request param "id".
+	id, err := request.ReadID(r)
+	if err != nil {
+		return err
+	}
+	// Admins delete their own account at "/v1/me", which requires password re-entry.
+	if id == request.UserIDFromContext(r.Context()) {
+		return errSelf
+	}
+
+	// The audit log record is committed together with the change.
+	l, err := newAuditLog(r, actionUserDelete, id, nil)
+	if err != nil {
+		return err
+	}
+	err = h.users.Delete(r.Context(), id, h.repository.AuditHook(l))
+	if err != nil {
+		return err
+	}
+	err = h.revocations.RevokeAllForUser(r.Context(), id, time.Now())
+	if err != nil {
+		return err
+	}
+
+	return response.WriteOK(w)
+}
+
+// disableUser blocks the user from logging in, and ends all their sessions. API tokens of disabled users
+// are rejected until the user is enabled again.
+func (h *Handler) disableUser(w http.ResponseWriter, r *http.Request) error {
+	// Read request param "id".
+	id, err := request.ReadID(r)
+	if err != nil {
+		return err
+	}
+	if id == request.UserIDFromContext(r.Context()) {
+		return errSelf
+	}
+
+	// The audit log record is committed together with the change.
+	l, err := newAuditLog(r, actionUserDisable, id, nil)
+	if err != nil {
+		return err
+	}
+	err = h.users.SetDisabled(r.Context(), id, true, h.repository.AuditHook(l))
+	if err != nil {
+		return err
+	}
+	err = h.revocations.RevokeAllForUser(r.Context(), id, time.Now())
+	if err != nil {
+		return err
+	}
+
+	return response.WriteOK(w)
+}
+
+func (h *Handler) enableUser(w http.ResponseWriter, r *http.Request) error {
+	// Read request param "id".
+	id, err := request.ReadID(r)
+	if err != nil {
+		return err
+	}
+
+	// The audit log record is committed together with the change.
+	l, err := newAuditLog(r, actionUserEnable, id, nil)
+	if err != nil {
+		return err
+	}
+	err = h.users.SetDisabled(r.Context(), id, false, h.repository.AuditHook(l))
+	if err != nil {
+		return err
+	}
+
+	return response.WriteOK(w)
+}
+
+// setUserRole changes the role of the user. Access tokens of the user are revoked, so a removed role
+// can't be used until they expire. The new role takes effect when the user refreshes their token.
+func (h *Handler) setUserRole(w http.ResponseWriter, r *http.Request) error {
+	type requestData struct {
+		Role string `json:"role"`
+	}
+
+	// Read request param "id".
+	id, err := request.ReadID(r)
+	if err != nil {
+		return err
+	}
+	// Prevents the last admin from locking everyone out.
+	if id == request.UserIDFromContext(r.Context()) {
+		return errSelf
+	}
+
+	// Read request body.
+	reqBody, err := request.ReadJSON[requestData](r)
+	if err != nil {
+		return err
+	}
+
+	// Validate user input.
+	if err := validation.ValidateStruct(reqBody,
+		validation.Field(&reqBody.Role, validation.Required, validation.In(auth.RoleUser, auth.RoleAdmin)),
+	); err != nil {
+		if errs, ok := err.(validation.Errors); ok {
+			return response.ErrDataValidation(errs)
+		}
+		return err
+	}
+
+	// The audit log record is committed together with the change.
+	l, err := newAuditLog(r, actionUserSetRole, id, reqBody)
+	if err != nil {
+		return err
+	}
+	err = h.users.SetRole(r.Context(), id, reqBody.Role, h.repository.AuditHook(l))
+	if err != nil {
+		return err
+	}
+	err = h.revocations.RevokeAllForUser(r.Context(), id, time.Now())
+	if err != nil {
+		return err
+	}
+
+	return response.WriteOK(w)
+}
+
+// impersonateUser returns a short-lived access token to act as the user for support. The token can't be
+// refreshed and can't be used to manage the account of the user. A reason is required for the audit log.
+func (h *Handler) impersonateUser(w http.ResponseWriter, r *http.Request) error {
+	type requestData struct {
+		Reason string `json:"reason"`
+	}
+
+	type responseData struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+
+	// Read request param "id".
+	id, err := request.ReadID(r)
+	if err != nil {
+		return err
+	}
+
+	// Read request body.
+	reqBody, err := request.ReadJSON[requestData](r)
+	if err != nil {
+		return err
+	}
+
+	// Validate user input.
+	if err := validation.ValidateStruct(reqBody,
+		validation.Field(&reqBody.Reason, validation.Required, validation.Length(0, 500)),
+	); err != nil {
+		if errs, ok := err.(validation.Errors); ok {
+			return response.ErrDataValidation(errs)
+		}
+		return err
+	}
+
+	ctx := r.Context()
+	user, err := h.users.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if user.Role == auth.RoleAdmin || user.DisabledAt.Valid {
+		return errImpersonate
+	}
+
+	err = h.audit(r, actionUserImpersonate, id, reqBody)
+	if err != nil {
+		return err
+	}
+
+	expiresAt := time.Now().Add(impersonationTokenDuration)
+	accessToken, err := h.jwtAuth.GenerateImpersonationToken(
+		user.ID, user.Role, request.UserIDFromContext(ctx), impersonationTokenDuration,
+	)
+	if err != nil {
+		return err
+	}
+
+	return response.WriteJSON(w, &responseData{Token: accessToken, ExpiresAt: expiresAt})
+}
+
+func (h *Handler) getAllAuditLogs(w http.ResponseWriter, r *http.Request) error {
+	// Read URL query.
+	filter, err := request.ReadURLQuery[AuditLogFilter](r)
+	if err != nil {
+		return err
+	}
+
+	err = h.audit(r, actionAuditLogList, uuid.Nil, filter)
+	if err != nil {
+		return err
+	}
+
+	logs, page, err := h.repository.GetAuditLogs(r.Context(), filter)
+	if err != nil {
+		return err
+	}
+
+	return response.WritePage(w, r, logs, page)
+}
+
+// audit records the action of the current user, before the action is done. Actions that change data
+// use newAuditLog with AuditHook instead, so the record is committed in the same transaction.
+func (h *Handler) audit(r *http.Request, action string, targetID uuid.UUID, details any) error {
+	l, err := newAuditLog(r, action, targetID, details)
+	if err != nil {
+		return err
+	}
+	return h.repository.CreateAuditLog(r.Context(), l)
+}
+
+// newAuditLog returns the record of the action of the current user. Details are stored as JSON.
+func newAuditLog(r *http.Request, action string, targetID uuid.UUID, details any) (*AuditLog, error) {
+	ctx := r.Context()
+	detailsJSON := []byte("{}")
+	if details != nil {
+		var err error
+		detailsJSON, err = json.Marshal(details)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &AuditLog{
+		ActorID:   request.UserIDFromContext(ctx),
+		Action:    action,
+		TargetID:  uuid.NullUUID{UUID: targetID, Valid: targetID != uuid.Nil},
+		Details:   detailsJSON,
+		IP:        request.ClientIP(r),
+		RequestID: request.RequestIDFromContext(ctx),
+	}, nil
+}
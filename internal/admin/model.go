@@ -0,0 +1,42 @@
+package admin
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Actions recorded in the audit log.
+const (
+	actionUserList        = "user.list"
+	actionUserGet         = "user.get"
+	actionUserDisable     = "user.disable"
+	actionUserEnable      = "user.enable"
+	actionUserDelete      = "user.delete"
+	actionUserSetRole     = "user.set_role"
+	actionUserImpersonate = "user.impersonate"
+	actionAuditLogList    = "audit_log.list"
+)
+
+// AuditLog records an action of an admin.
+type AuditLog struct {
+	ID        uuid.UUID       `json:"id"`
+	ActorID   uuid.UUID       `json:"actor_id"`
+	Action    string          `json:"action"`
+	TargetID  uuid.NullUUID   `json:"target_id"`
+	Details   json.RawMessage `json:"details"`
+	IP        string          `json:"ip"`
+	RequestID string          `json:"request_id"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+type AuditLogFilter struct {
+	ActorID  *uuid.UUID `schema:"actor_id" json:"actor_id,omitempty"`
+	TargetID *uuid.UUID `schema:"target_id" json:"target_id,omitempty"`
+	Action   *string    `schema:"action" json:"action,omitempty"`
+
+	Cursor       string `schema:"cursor" json:"-"`
+	Limit        int    `schema:"limit" json:"limit,omitempty"` // Defaults to query.DefaultLimit, at most query.MaxLimit.
+	IncludeTotal bool   `schema:"include_total" json:"-"`
+}
@@ -0,0 +1,118 @@
+package admin
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/nathansiegfrid/todolist/internal/auth"
+	"github.com/nathansiegfrid/todolist/pkg/query"
+	"github.com/nathansiegfrid/todolist/pkg/response"
+	"github.com/nathansiegfrid/todolist/pkg/token"
+)
+
+type Repository struct {
+	db      *sql.DB
+	cursors *token.Signer
+}
+
+func NewRepository(db *sql.DB, cursors *token.Signer) *Repository {
+	return &Repository{db, cursors}
+}
+
+func (r *Repository) GetAuditLogs(ctx context.Context, filter *AuditLogFilter) ([]*AuditLog, *response.Page, error) {
+	// Translate filter into WHERE conditions and args.
+	b := query.NewBuilder()
+	if v := filter.ActorID; v != nil {
+		b.Where("actor_id = " + b.Arg(*v))
+	}
+	if v := filter.TargetID; v != nil {
+		b.Where("target_id = " + b.Arg(*v))
+	}
+	if v := filter.Action; v != nil {
+		b.Where("action = " + b.Arg(*v))
+	}
+
+	// Count before adding the cursor condition, so the total includes all pages.
+	page := &response.Page{}
+	if filter.IncludeTotal {
+		var total int
+		err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM audit_log WHERE "+b.SQL(), b.Args()...).Scan(&total)
+		if err != nil {
+			return nil, nil, err
+		}
+		page.Total = &total
+	}
+
+	// Newest first.
+	sort := query.Sort{{Column: "created_at", Type: "TIMESTAMPTZ", Desc: true}, {Column: "id", Type: "UUID", Desc: true}}
+	filters := b.Fingerprint()
+	cursor, err := query.DecodeCursor(r.cursors, sort, filters, filter.Cursor)
+	if err != nil {
+		return nil, nil, err
+	}
+	query.After(b, sort, cursor)
+	limit := query.Limit(filter.Limit)
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, actor_id, action, target_id, details, ip, request_id, created_at
+		FROM audit_log
+		WHERE `+b.SQL()+`
+		ORDER BY `+sort.OrderBy(cursor)+`
+		LIMIT `+strconv.Itoa(limit+1),
+		b.Args()...,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	logs := []*AuditLog{}
+	for rows.Next() {
+		l := &AuditLog{}
+		var details []byte
+		err := rows.Scan(&l.ID, &l.ActorID, &l.Action, &l.TargetID, &details, &l.IP, &l.RequestID, &l.CreatedAt)
+		if err != nil {
+			return nil, nil, err
+		}
+		l.Details = details
+		logs = append(logs, l)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	logs, next, prev := query.Paginate(logs, limit, cursor, func(l *AuditLog) []any {
+		return []any{l.CreatedAt, l.ID}
+	})
+	page.NextCursor = query.EncodeCursor(r.cursors, sort, filters, next)
+	page.PrevCursor = query.EncodeCursor(r.cursors, sort, filters, prev)
+	return logs, page, nil
+}
+
+func (r *Repository) CreateAuditLog(ctx context.Context, l *AuditLog) error {
+	return insertAuditLog(ctx, r.db, l)
+}
+
+// AuditHook returns a hook that writes the audit log record in the transaction of the audited change.
+func (r *Repository) AuditHook(l *AuditLog) auth.TxHook {
+	return func(ctx context.Context, tx *sql.Tx) error {
+		return insertAuditLog(ctx, tx, l)
+	}
+}
+
+// querier is *sql.DB or *sql.Tx.
+type querier interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func insertAuditLog(ctx context.Context, q querier, l *AuditLog) error {
+	l.ID = uuid.New()
+	return q.QueryRowContext(ctx, `
+		INSERT INTO audit_log (id, actor_id, action, target_id, details, ip, request_id, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NOW())
+		RETURNING created_at`,
+		l.ID, l.ActorID, l.Action, l.TargetID, string(l.Details), l.IP, l.RequestID,
+	).Scan(&l.CreatedAt)
+}
@@ -0,0 +1,111 @@
+package apitoken
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/google/uuid"
+	"github.com/guregu/null/v5"
+	"github.com/nathansiegfrid/todolist/pkg/handler"
+	"github.com/nathansiegfrid/todolist/pkg/request"
+	"github.com/nathansiegfrid/todolist/pkg/response"
+	"github.com/nathansiegfrid/todolist/pkg/token"
+	"github.com/samber/lo"
+)
+
+type repository interface {
+	GetAll(ctx context.Context) ([]*APIToken, error)
+	Create(ctx context.Context, t *APIToken) error
+	Delete(ctx context.Context, id uuid.UUID) error
+}
+
+type Handler struct {
+	repository repository
+}
+
+func NewHandler(db *sql.DB) *Handler {
+	return &Handler{
+		repository: NewRepository(db),
+	}
+}
+
+func (h *Handler) HandleTokensRoute() http.HandlerFunc {
+	return handler.MethodHandler{
+		"GET":  handler.ErrorHandlerFunc(h.getAllTokens),
+		"POST": handler.ErrorHandlerFunc(h.createToken),
+	}.HandlerFunc()
+}
+
+func (h *Handler) HandleTokensIDRoute() http.HandlerFunc {
+	return handler.MethodHandler{
+		"DELETE": handler.ErrorHandlerFunc(h.deleteToken),
+	}.HandlerFunc()
+}
+
+func (h *Handler) getAllTokens(w http.ResponseWriter, r *http.Request) error {
+	tokens, err := h.repository.GetAll(r.Context())
+	if err != nil {
+		return err
+	}
+
+	return response.WriteJSON(w, tokens)
+}
+
+func (h *Handler) createToken(w http.ResponseWriter, r *http.Request) error {
+	// The token is only returned here, it can't be retrieved later.
+	type responseData struct {
+		*APIToken
+		Token string `json:"token"`
+	}
+
+	// Read request body.
+	t, err := request.ReadJSON[APIToken](r)
+	if err != nil {
+		return err
+	}
+
+	// Validate user input.
+	if err := validation.ValidateStruct(t,
+		validation.Field(&t.Name, validation.Required, validation.Length(0, 100)),
+		validation.Field(&t.Scopes, validation.Required, validation.Each(validation.In(lo.ToAnySlice(token.GrantableScopes)...))),
+		validation.Field(&t.ExpiresAt, validation.Min(time.Now()).Error("must be in the future")),
+	); err != nil {
+		if errs, ok := err.(validation.Errors); ok {
+			return response.ErrDataValidation(errs)
+		}
+		return err
+	}
+
+	apiToken, tokenHash, err := token.GenerateAPIToken()
+	if err != nil {
+		return err
+	}
+	t.TokenHash = tokenHash
+	t.Scopes = lo.Uniq(t.Scopes)
+	t.LastUsedAt = null.Time{}
+
+	err = h.repository.Create(r.Context(), t)
+	if err != nil {
+		return err
+	}
+
+	return response.WriteJSON(w, &responseData{t, apiToken})
+}
+
+func (h *Handler) deleteToken(w http.ResponseWriter, r *http.Request) error {
+	// Read request param "id".
+	id, err := request.ReadID(r)
+	if err != nil {
+		return err
+	}
+
+	err = h.repository.Delete(r.Context(), id)
+	if err != nil {
+		return err
+	}
+
+	return response.WriteOK(w)
+}
@@ -0,0 +1,21 @@
+package apitoken
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/guregu/null/v5"
+)
+
+// APIToken is a personal access token for scripts and integrations. Only the hash of the token is stored,
+// the token itself is only shown once when created.
+type APIToken struct {
+	ID         uuid.UUID `json:"id"`
+	UserID     uuid.UUID `json:"user_id"`
+	Name       string    `json:"name"`
+	TokenHash  []byte    `json:"-"`
+	Scopes     []string  `json:"scopes"`
+	ExpiresAt  null.Time `json:"expires_at"`
+	LastUsedAt null.Time `json:"last_used_at"`
+	CreatedAt  time.Time `json:"created_at"`
+}
@@ -0,0 +1,81 @@
+package apitoken
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/nathansiegfrid/todolist/pkg/request"
+	"github.com/nathansiegfrid/todolist/pkg/response"
+)
+
+type Repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{db}
+}
+
+// GetAll returns API tokens of the user, including expired ones.
+func (r *Repository) GetAll(ctx context.Context) ([]*APIToken, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, user_id, name, scopes, expires_at, last_used_at, created_at
+		FROM api_token
+		WHERE user_id = $1
+		ORDER BY created_at DESC`,
+		request.UserIDFromContext(ctx),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []*APIToken{}
+	for rows.Next() {
+		t := &APIToken{}
+		var scopes string
+		err := rows.Scan(&t.ID, &t.UserID, &t.Name, &scopes, &t.ExpiresAt, &t.LastUsedAt, &t.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		t.Scopes = strings.Fields(scopes)
+		tokens = append(tokens, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+func (r *Repository) Create(ctx context.Context, t *APIToken) error {
+	t.ID = uuid.New()
+	t.UserID = request.UserIDFromContext(ctx)
+	return r.db.QueryRowContext(ctx, `
+		INSERT INTO api_token (id, user_id, name, token_hash, scopes, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NOW())
+		RETURNING created_at`,
+		t.ID, t.UserID, t.Name, t.TokenHash, strings.Join(t.Scopes, " "), t.ExpiresAt,
+	).Scan(&t.CreatedAt)
+}
+
+// Delete revokes the API token. Only the owner of the token can delete it.
+func (r *Repository) Delete(ctx context.Context, id uuid.UUID) error {
+	result, err := r.db.ExecContext(ctx,
+		"DELETE FROM api_token WHERE id = $1 AND user_id = $2",
+		id, request.UserIDFromContext(ctx),
+	)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return response.ErrIDNotFound("API token", id)
+	}
+	return nil
+}
@@ -3,36 +3,172 @@ package auth
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
 	validation "github.com/go-ozzo/ozzo-validation/v4"
 	"github.com/go-ozzo/ozzo-validation/v4/is"
 	"github.com/google/uuid"
 	"github.com/nathansiegfrid/todolist/pkg/handler"
+	"github.com/nathansiegfrid/todolist/pkg/logger"
+	"github.com/nathansiegfrid/todolist/pkg/mailer"
+	"github.com/nathansiegfrid/todolist/pkg/oidc"
+	"github.com/nathansiegfrid/todolist/pkg/ratelimit"
 	"github.com/nathansiegfrid/todolist/pkg/request"
 	"github.com/nathansiegfrid/todolist/pkg/response"
 	"github.com/nathansiegfrid/todolist/pkg/token"
+	"github.com/nathansiegfrid/todolist/pkg/totp"
 )
 
-var errLogin = response.Error(http.StatusUnauthorized, "Incorrect email or password.")
+const (
+	accessTokenDuration   = 5 * time.Minute
+	refreshTokenDuration  = 72 * time.Hour
+	verifyEmailDuration   = 24 * time.Hour
+	resetPasswordDuration = time.Hour
+	mfaTokenDuration      = 5 * time.Minute
+	oidcStateDuration     = 10 * time.Minute
+	oidcStatePath         = "/v1/auth/oidc"
+
+	totpIssuer        = "Todolist"
+	recoveryCodeCount = 10
+)
+
+var (
+	// loginPolicy applies to login attempts per IP and per email, successful ones are uncounted.
+	// It slows down password guessing, then locks the email or IP for a while.
+	loginPolicy = ratelimit.Policy{
+		Window:       time.Hour,
+		FreeHits:     3,
+		BaseDelay:    time.Second,
+		MaxDelay:     time.Minute,
+		LockHits:     10,
+		LockDuration: 15 * time.Minute,
+	}
+	// registerPolicy applies to all registrations per IP.
+	registerPolicy = ratelimit.Policy{
+		Window:       time.Hour,
+		FreeHits:     5,
+		BaseDelay:    time.Minute,
+		MaxDelay:     time.Hour,
+		LockHits:     20,
+		LockDuration: 24 * time.Hour,
+	}
+	// mailPolicy applies to requests that send emails, per IP and per email.
+	mailPolicy = ratelimit.Policy{
+		Window:       time.Hour,
+		FreeHits:     3,
+		BaseDelay:    time.Minute,
+		MaxDelay:     time.Hour,
+		LockHits:     10,
+		LockDuration: 24 * time.Hour,
+	}
+)
+
+var (
+	errLogin               = response.Error(http.StatusUnauthorized, "Incorrect email or password.")
+	errCurrentPassword     = response.Error(http.StatusForbidden, "Current password is incorrect.")
+	errRefreshTokenInvalid = response.Error(http.StatusUnauthorized, "Refresh token is invalid.")
+	errRefreshTokenExpired = response.Error(http.StatusUnauthorized, "Refresh token has expired.")
+	errRefreshTokenReused  = response.Error(http.StatusUnauthorized, "Refresh token has already been used. All sessions from this login have been revoked.")
+	errEmailNotVerified    = response.Error(http.StatusForbidden, "Email address is not verified.")
+	errUserDisabled        = response.Error(http.StatusForbidden, "Account has been disabled.")
+	errActionTokenInvalid  = response.Error(http.StatusBadRequest, "Token is invalid or has expired.")
+	errActionTokenUsed     = response.Error(http.StatusBadRequest, "Token has already been used.")
+	errTOTPEnabled         = response.Error(http.StatusConflict, "Two-factor authentication is already enabled.")
+	errTOTPNotEnabled      = response.Error(http.StatusBadRequest, "Two-factor authentication is not enabled.")
+	errTOTPNotEnrolled     = response.Error(http.StatusBadRequest, "Two-factor authentication enrollment has not been started.")
+	errMFACode             = response.Error(http.StatusUnauthorized, "Authentication code is incorrect.")
+	errOIDCDisabled        = response.Error(http.StatusNotFound, "Single sign-on is not configured.")
+	errOIDCState           = response.Error(http.StatusBadRequest, "Single sign-on state is invalid or has expired. Please try again.")
+	errOIDCLogin           = response.Error(http.StatusUnauthorized, "Single sign-on failed.")
+
+	errIdentityEmailMissing    = response.Error(http.StatusBadRequest, "Identity provider didn't share an email address.")
+	errIdentityEmailUnverified = response.Error(http.StatusConflict, "An account with this email already exists, but the identity provider didn't verify the email.")
+)
 
 type repository interface {
-	GetAll(ctx context.Context, filter *UserFilter) ([]*User, error)
+	GetAll(ctx context.Context, filter *UserFilter) ([]*User, *response.Page, error)
 	Get(ctx context.Context, id uuid.UUID) (*User, error)
 	Create(ctx context.Context, todo *User) error
 	Update(ctx context.Context, id uuid.UUID, update *UserUpdate) error
+	Delete(ctx context.Context, id uuid.UUID, hooks ...TxHook) error
+	CreateRefreshToken(ctx context.Context, t *RefreshToken) error
+	RotateRefreshToken(ctx context.Context, tokenHash []byte, next *RefreshToken) error
+	RevokeRefreshTokenFamily(ctx context.Context, tokenHash []byte) error
+	RevokeAllRefreshTokens(ctx context.Context, userID uuid.UUID) error
+	VerifyEmail(ctx context.Context, userID uuid.UUID, t *actionToken) error
+	ResetPassword(ctx context.Context, userID uuid.UUID, passwordHash []byte, t *actionToken) error
+	UseActionToken(ctx context.Context, t *actionToken) error
+	SetTOTPSecret(ctx context.Context, userID uuid.UUID, secret []byte) error
+	EnableTOTP(ctx context.Context, userID uuid.UUID, step int64, codeHashes [][]byte) error
+	DisableTOTP(ctx context.Context, userID uuid.UUID) error
+	ReplaceRecoveryCodes(ctx context.Context, userID uuid.UUID, codeHashes [][]byte) error
+	UseTOTPStep(ctx context.Context, userID uuid.UUID, step int64) error
+	UseRecoveryCode(ctx context.Context, userID uuid.UUID, codeHash []byte) error
+	LoginWithIdentity(ctx context.Context, identity *UserIdentity) (uuid.UUID, error)
+}
+
+// tokenResponseData contains either the tokens, or only the CSRF token if tokens are set as cookies.
+// If 2FA is enabled, login only returns the MFA token to be exchanged at "/v1/login/mfa".
+type tokenResponseData struct {
+	Token        string `json:"token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	CSRFToken    string `json:"csrf_token,omitempty"`
+	MFARequired  bool   `json:"mfa_required,omitempty"`
+	MFAToken     string `json:"mfa_token,omitempty"`
+}
+
+// Config contains the dependencies and settings of Handler.
+type Config struct {
+	JWTAuth     *token.JWTAuth
+	Revocations token.RevocationStore
+	Cookies     *token.CookieConfig
+	RateLimits  ratelimit.Store
+	Signer      *token.Signer // Signs tokens sent by email.
+	Mailer      mailer.Mailer
+	AppURL      string         // Base URL of the web app, used for links in emails.
+	OIDC        *oidc.Provider // Optional single sign-on provider.
+
+	// RequireVerifiedEmail blocks login until the email address is verified.
+	RequireVerifiedEmail bool
 }
 
 type Handler struct {
-	repository repository
-	jwtAuth    *token.JWTAuth
+	repository  repository
+	jwtAuth     *token.JWTAuth
+	revocations token.RevocationStore
+	cookies     *token.CookieConfig
+	signer      *token.Signer
+	mailer      mailer.Mailer
+	appURL      string
+	oidc        *oidc.Provider
+
+	requireVerifiedEmail bool
+
+	loginLimiter    *ratelimit.Limiter
+	registerLimiter *ratelimit.Limiter
+	mailLimiter     *ratelimit.Limiter
 }
 
-func NewHandler(db *sql.DB, jwtAuth *token.JWTAuth) *Handler {
+func NewHandler(db *sql.DB, config *Config) *Handler {
 	return &Handler{
-		repository: NewRepository(db),
-		jwtAuth:    jwtAuth,
+		repository:           NewRepository(db, config.Signer),
+		jwtAuth:              config.JWTAuth,
+		revocations:          config.Revocations,
+		cookies:              config.Cookies,
+		signer:               config.Signer,
+		mailer:               config.Mailer,
+		appURL:               strings.TrimSuffix(config.AppURL, "/"),
+		oidc:                 config.OIDC,
+		requireVerifiedEmail: config.RequireVerifiedEmail,
+		loginLimiter:         ratelimit.NewLimiter(config.RateLimits, loginPolicy),
+		registerLimiter:      ratelimit.NewLimiter(config.RateLimits, registerPolicy),
+		mailLimiter:          ratelimit.NewLimiter(config.RateLimits, mailPolicy),
 	}
 }
 
@@ -40,23 +176,89 @@ func (h *Handler) HandleLoginRoute() http.HandlerFunc {
 	return handler.MethodHandler{"POST": h.handleLogin()}.HandlerFunc()
 }
 
+func (h *Handler) HandleLoginMFARoute() http.HandlerFunc {
+	return handler.MethodHandler{"POST": h.handleLoginMFA()}.HandlerFunc()
+}
+
+func (h *Handler) HandleOIDCLoginRoute() http.HandlerFunc {
+	return handler.MethodHandler{"GET": h.handleOIDCLogin()}.HandlerFunc()
+}
+
+func (h *Handler) HandleOIDCCallbackRoute() http.HandlerFunc {
+	return handler.MethodHandler{"GET": h.handleOIDCCallback()}.HandlerFunc()
+}
+
 func (h *Handler) HandleRegisterRoute() http.HandlerFunc {
 	return handler.MethodHandler{"POST": h.handleRegister()}.HandlerFunc()
 }
 
+func (h *Handler) HandleRefreshTokenRoute() http.HandlerFunc {
+	return handler.MethodHandler{"POST": h.handleRefreshToken()}.HandlerFunc()
+}
+
+func (h *Handler) HandleLogoutRoute() http.HandlerFunc {
+	return handler.MethodHandler{"POST": h.handleLogout()}.HandlerFunc()
+}
+
+func (h *Handler) HandleLogoutAllRoute() http.HandlerFunc {
+	return handler.MethodHandler{"POST": h.handleLogoutAll()}.HandlerFunc()
+}
+
+func (h *Handler) HandleSendVerificationEmailRoute() http.HandlerFunc {
+	return handler.MethodHandler{"POST": h.handleSendVerificationEmail()}.HandlerFunc()
+}
+
+func (h *Handler) HandleVerifyEmailRoute() http.HandlerFunc {
+	return handler.MethodHandler{"POST": h.handleVerifyEmail()}.HandlerFunc()
+}
+
+func (h *Handler) HandleSendPasswordResetEmailRoute() http.HandlerFunc {
+	return handler.MethodHandler{"POST": h.handleSendPasswordResetEmail()}.HandlerFunc()
+}
+
+func (h *Handler) HandleResetPasswordRoute() http.HandlerFunc {
+	return handler.MethodHandler{"POST": h.handleResetPassword()}.HandlerFunc()
+}
+
+func (h *Handler) HandleMeRoute() http.HandlerFunc {
+	return handler.MethodHandler{
+		"GET":    handler.ErrorHandlerFunc(h.getMe),
+		"PATCH":  handler.ErrorHandlerFunc(h.updateMe),
+		"DELETE": handler.ErrorHandlerFunc(h.deleteMe),
+	}.HandlerFunc()
+}
+
+func (h *Handler) HandleJWKSRoute() http.HandlerFunc {
+	return handler.MethodHandler{"GET": h.handleJWKS()}.HandlerFunc()
+}
+
+func (h *Handler) HandleTOTPRoute() http.HandlerFunc {
+	return handler.MethodHandler{"DELETE": handler.ErrorHandlerFunc(h.disableTOTP)}.HandlerFunc()
+}
+
+func (h *Handler) HandleTOTPEnrollRoute() http.HandlerFunc {
+	return handler.MethodHandler{"POST": handler.ErrorHandlerFunc(h.enrollTOTP)}.HandlerFunc()
+}
+
+func (h *Handler) HandleTOTPConfirmRoute() http.HandlerFunc {
+	return handler.MethodHandler{"POST": handler.ErrorHandlerFunc(h.confirmTOTP)}.HandlerFunc()
+}
+
+func (h *Handler) HandleRecoveryCodesRoute() http.HandlerFunc {
+	return handler.MethodHandler{"POST": handler.ErrorHandlerFunc(h.regenerateRecoveryCodes)}.HandlerFunc()
+}
+
 func (h *Handler) HandleVerifyAuthRoute() http.HandlerFunc {
 	return handler.MethodHandler{"GET": h.handleVerifyAuth()}.HandlerFunc()
 }
 
+// handleLogin returns an access token and a refresh token.
+// Browser clients can set "use_cookie" to receive them as HttpOnly cookies instead.
 func (h *Handler) handleLogin() http.HandlerFunc {
 	type requestData struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
-	}
-
-	type responseData struct {
-		Token        string `json:"token"`
-		RefreshToken string `json:"refresh_token"`
+		Email     string `json:"email"`
+		Password  string `json:"password"`
+		UseCookie bool   `json:"use_cookie"`
 	}
 
 	return handler.ErrorHandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
@@ -66,7 +268,15 @@ func (h *Handler) handleLogin() http.HandlerFunc {
 			return err
 		}
 
-		users, err := h.repository.GetAll(r.Context(), &UserFilter{Email: &reqBody.Email, Limit: 1})
+		// Count the attempt before running bcrypt, so concurrent guesses can't skip the rate limit.
+		ipKey := "login:ip:" + request.ClientIP(r)
+		emailKey := "login:email:" + strings.ToLower(reqBody.Email)
+		err = h.loginLimiter.Hit(r.Context(), ipKey, emailKey)
+		if err != nil {
+			return err
+		}
+
+		users, _, err := h.repository.GetAll(r.Context(), &UserFilter{Email: &reqBody.Email, Limit: 1})
 		if err != nil {
 			return err
 		}
@@ -75,19 +285,333 @@ func (h *Handler) handleLogin() http.HandlerFunc {
 			return errLogin
 		}
 
-		token, err := h.jwtAuth.GenerateToken(users[0].ID, 5*time.Minute)
+		// IP key is only released, not reset, otherwise an attacker could reset it by logging in to their own account.
+		err = h.loginLimiter.Reset(r.Context(), emailKey)
 		if err != nil {
 			return err
 		}
-		refreshToken, err := h.jwtAuth.GenerateToken(users[0].ID, 72*time.Hour)
+		err = h.loginLimiter.Release(r.Context(), ipKey)
 		if err != nil {
 			return err
 		}
 
-		return response.WriteJSON(w, &responseData{
-			Token:        token,
-			RefreshToken: refreshToken,
+		return h.completeLogin(r.Context(), w, users[0], reqBody.UseCookie)
+	})
+}
+
+// completeLogin starts a session for an authenticated user, unless the user still has to verify their email
+// or enter a 2FA code.
+func (h *Handler) completeLogin(ctx context.Context, w http.ResponseWriter, user *User, useCookie bool) error {
+	if user.DisabledAt.Valid {
+		return errUserDisabled
+	}
+	if h.requireVerifiedEmail && !user.VerifiedAt.Valid {
+		return errEmailNotVerified
+	}
+
+	if user.TOTPEnabledAt.Valid {
+		mfaToken, err := h.signActionToken(user, purposeMFA, mfaTokenDuration)
+		if err != nil {
+			return err
+		}
+		return response.WriteJSON(w, &tokenResponseData{MFARequired: true, MFAToken: mfaToken})
+	}
+
+	return h.startSession(ctx, w, user, useCookie)
+}
+
+// oidcState is stored in a signed cookie during single sign-on, so the callback can only be completed
+// by the browser that started it.
+type oidcState struct {
+	State        string `json:"state"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"cv"`
+	UseCookie    bool   `json:"uc"`
+	ExpiresAt    int64  `json:"exp"`
+}
+
+// oidcStateBinding prevents other signed payloads from being accepted as OIDC state.
+var oidcStateBinding = []byte("oidc_state")
+
+// handleOIDCLogin redirects to the login page of the OpenID provider.
+func (h *Handler) handleOIDCLogin() http.HandlerFunc {
+	type requestQuery struct {
+		UseCookie bool   `schema:"use_cookie"`
+		LoginHint string `schema:"login_hint"`
+	}
+
+	return handler.ErrorHandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		if h.oidc == nil {
+			return errOIDCDisabled
+		}
+
+		// Read URL query.
+		query, err := request.ReadURLQuery[requestQuery](r)
+		if err != nil {
+			return err
+		}
+
+		state := &oidcState{UseCookie: query.UseCookie, ExpiresAt: time.Now().Add(oidcStateDuration).Unix()}
+		for _, v := range []*string{&state.State, &state.Nonce, &state.CodeVerifier} {
+			if *v, err = oidc.GenerateRandom(); err != nil {
+				return err
+			}
+		}
+		authURL, err := h.oidc.AuthCodeURL(r.Context(), state.State, state.Nonce, state.CodeVerifier, query.LoginHint)
+		if err != nil {
+			return err
+		}
+
+		payload, err := json.Marshal(state)
+		if err != nil {
+			return err
+		}
+		h.cookies.SetStateCookie(w, token.OIDCStateCookie, h.signer.Sign(payload, oidcStateBinding), oidcStatePath, oidcStateDuration)
+		http.Redirect(w, r, authURL, http.StatusFound)
+		return nil
+	})
+}
+
+// handleOIDCCallback completes single sign-on when the OpenID provider redirects back. The user is linked
+// by their identity at the provider, or by email if the provider verified it. New users are created without
+// password. The response is the same as handleLogin.
+func (h *Handler) handleOIDCCallback() http.HandlerFunc {
+	type requestQuery struct {
+		Code             string `schema:"code"`
+		State            string `schema:"state"`
+		Error            string `schema:"error"`
+		ErrorDescription string `schema:"error_description"`
+	}
+
+	return handler.ErrorHandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		if h.oidc == nil {
+			return errOIDCDisabled
+		}
+
+		// Read URL query.
+		query, err := request.ReadURLQuery[requestQuery](r)
+		if err != nil {
+			return err
+		}
+
+		// State cookie is single-use.
+		cookie, err := r.Cookie(token.OIDCStateCookie)
+		if err != nil {
+			return errOIDCState
+		}
+		h.cookies.ClearStateCookie(w, token.OIDCStateCookie, oidcStatePath)
+		payload, err := h.signer.Verify(cookie.Value, oidcStateBinding)
+		if err != nil {
+			return errOIDCState
+		}
+		state := &oidcState{}
+		if err := json.Unmarshal(payload, state); err != nil {
+			return errOIDCState
+		}
+		if time.Now().Unix() > state.ExpiresAt || query.State != state.State {
+			return errOIDCState
+		}
+
+		if query.Error != "" {
+			return response.Errorf(http.StatusUnauthorized, "Single sign-on failed: %s.", query.Error)
+		}
+
+		ctx := r.Context()
+		idToken, err := h.oidc.Exchange(ctx, query.Code, state.CodeVerifier, state.Nonce)
+		if err != nil {
+			logger.Error(ctx, fmt.Sprintf("OIDC error: %s.", err), "category", "internal_error")
+			return errOIDCLogin
+		}
+
+		userID, err := h.repository.LoginWithIdentity(ctx, &UserIdentity{
+			Issuer:        idToken.Issuer,
+			Subject:       idToken.Subject,
+			Email:         idToken.Email,
+			EmailVerified: idToken.EmailVerified,
 		})
+		if err != nil {
+			return err
+		}
+		user, err := h.repository.Get(ctx, userID)
+		if err != nil {
+			return err
+		}
+
+		return h.completeLogin(ctx, w, user, state.UseCookie)
+	})
+}
+
+// handleLoginMFA completes a login of a user with 2FA enabled. It exchanges the MFA token from
+// handleLogin and a TOTP code, or an unused recovery code, for an access token and a refresh token.
+func (h *Handler) handleLoginMFA() http.HandlerFunc {
+	type requestData struct {
+		MFAToken     string `json:"mfa_token"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+		UseCookie    bool   `json:"use_cookie"`
+	}
+
+	return handler.ErrorHandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		// Read request body.
+		reqBody, err := request.ReadJSON[requestData](r)
+		if err != nil {
+			return err
+		}
+
+		// Validate user input.
+		if err := validation.ValidateStruct(reqBody,
+			validation.Field(&reqBody.MFAToken, validation.Required),
+			validation.Field(&reqBody.Code, validation.When(reqBody.RecoveryCode == "", validation.Required)),
+		); err != nil {
+			if errs, ok := err.(validation.Errors); ok {
+				return response.ErrDataValidation(errs)
+			}
+			return err
+		}
+
+		ctx := r.Context()
+		t, user, err := h.verifyActionToken(ctx, reqBody.MFAToken, purposeMFA)
+		if err != nil {
+			return err
+		}
+
+		// 6-digit codes are easy to guess without rate limiting.
+		userKey := "login:mfa:" + user.ID.String()
+		err = h.loginLimiter.Hit(ctx, userKey)
+		if err != nil {
+			return err
+		}
+
+		if reqBody.Code != "" {
+			err = h.useTOTPCode(ctx, user, reqBody.Code)
+		} else {
+			err = h.repository.UseRecoveryCode(ctx, user.ID, hashRecoveryCode(reqBody.RecoveryCode))
+		}
+		if errors.Is(err, errInvalidMFACode) {
+			return errMFACode
+		}
+		if err != nil {
+			return err
+		}
+
+		err = h.repository.UseActionToken(ctx, t)
+		if err != nil {
+			return err
+		}
+		err = h.loginLimiter.Reset(ctx, userKey)
+		if err != nil {
+			return err
+		}
+
+		return h.startSession(ctx, w, user, reqBody.UseCookie)
+	})
+}
+
+// startSession starts a new refresh token family and writes the tokens.
+func (h *Handler) startSession(ctx context.Context, w http.ResponseWriter, user *User, useCookie bool) error {
+	if user.DisabledAt.Valid {
+		return errUserDisabled
+	}
+
+	refreshToken, refreshTokenHash, err := token.GenerateOpaqueToken()
+	if err != nil {
+		return err
+	}
+	err = h.repository.CreateRefreshToken(ctx, &RefreshToken{
+		UserID:    user.ID,
+		FamilyID:  uuid.New(),
+		TokenHash: refreshTokenHash,
+		ExpiresAt: time.Now().Add(refreshTokenDuration),
+	})
+	if err != nil {
+		return err
+	}
+
+	return h.writeTokens(w, user, refreshToken, useCookie)
+}
+
+// handleRefreshToken exchanges a refresh token for a new access token and a new refresh token.
+// The submitted refresh token can't be used again. If the refresh token is not in the request body,
+// it's read from the cookie and the new tokens are set as cookies.
+func (h *Handler) handleRefreshToken() http.HandlerFunc {
+	type requestData struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	return handler.ErrorHandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		// Read optional request body.
+		reqBody := &requestData{}
+		if r.ContentLength != 0 {
+			var err error
+			reqBody, err = request.ReadJSON[requestData](r)
+			if err != nil {
+				return err
+			}
+		}
+
+		useCookie := false
+		if reqBody.RefreshToken == "" {
+			cookie, err := r.Cookie(token.RefreshTokenCookie)
+			if err != nil || cookie.Value == "" {
+				return errRefreshTokenInvalid
+			}
+			// This route is public, so CSRF middleware doesn't know the cookie is used.
+			if err := token.VerifyCSRF(r); err != nil {
+				return err
+			}
+			reqBody.RefreshToken = cookie.Value
+			useCookie = true
+		}
+
+		refreshToken, refreshTokenHash, err := token.GenerateOpaqueToken()
+		if err != nil {
+			return err
+		}
+		next := &RefreshToken{
+			TokenHash: refreshTokenHash,
+			ExpiresAt: time.Now().Add(refreshTokenDuration),
+		}
+		err = h.repository.RotateRefreshToken(r.Context(), token.HashOpaqueToken(reqBody.RefreshToken), next)
+		if err != nil {
+			return err
+		}
+
+		// Role may have changed since login.
+		user, err := h.repository.Get(r.Context(), next.UserID)
+		if err != nil {
+			return err
+		}
+		if user.DisabledAt.Valid {
+			return errUserDisabled
+		}
+
+		return h.writeTokens(w, user, refreshToken, useCookie)
+	})
+}
+
+// writeTokens generates an access token and writes it with the refresh token,
+// either in the response body or as session cookies.
+func (h *Handler) writeTokens(w http.ResponseWriter, user *User, refreshToken string, useCookie bool) error {
+	accessToken, err := h.jwtAuth.GenerateToken(user.ID, user.Role, accessTokenDuration)
+	if err != nil {
+		return err
+	}
+
+	if useCookie {
+		csrfToken, err := h.cookies.SetSessionCookies(
+			w,
+			accessToken, accessTokenDuration,
+			refreshToken, refreshTokenDuration,
+		)
+		if err != nil {
+			return err
+		}
+		return response.WriteJSON(w, &tokenResponseData{CSRFToken: csrfToken})
+	}
+
+	return response.WriteJSON(w, &tokenResponseData{
+		Token:        accessToken,
+		RefreshToken: refreshToken,
 	})
 }
 
@@ -104,6 +628,13 @@ func (h *Handler) handleRegister() http.HandlerFunc {
 			return err
 		}
 
+		// Every registration attempt counts, to prevent mass account creation.
+		ipKey := "register:ip:" + request.ClientIP(r)
+		err = h.registerLimiter.Hit(r.Context(), ipKey)
+		if err != nil {
+			return err
+		}
+
 		// Validate user input.
 		if err := validation.ValidateStruct(reqBody,
 			validation.Field(&reqBody.Email, validation.Required, is.Email),
@@ -124,10 +655,82 @@ func (h *Handler) handleRegister() http.HandlerFunc {
 			return err
 		}
 
+		// User can request the email again, so a mail error shouldn't fail the registration.
+		err = h.sendVerificationEmail(r.Context(), user)
+		if err != nil {
+			logger.Error(r.Context(), fmt.Sprintf("Send verification email error: %s.", err), "category", "internal_error")
+		}
+
 		return response.WriteOK(w)
 	})
 }
 
+// handleLogout revokes the access token used for the request.
+// If a refresh token is submitted or in the cookie, all refresh tokens from the same login are revoked as well.
+func (h *Handler) handleLogout() http.HandlerFunc {
+	type requestData struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	return handler.ErrorHandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		// Read optional request body.
+		reqBody := &requestData{}
+		if r.ContentLength != 0 {
+			var err error
+			reqBody, err = request.ReadJSON[requestData](r)
+			if err != nil {
+				return err
+			}
+		}
+
+		if reqBody.RefreshToken == "" {
+			if cookie, err := r.Cookie(token.RefreshTokenCookie); err == nil {
+				reqBody.RefreshToken = cookie.Value
+			}
+		}
+
+		ctx := r.Context()
+		if reqBody.RefreshToken != "" {
+			err := h.repository.RevokeRefreshTokenFamily(ctx, token.HashOpaqueToken(reqBody.RefreshToken))
+			if err != nil {
+				return err
+			}
+		}
+
+		// The revocation can be dropped once the token has expired.
+		err := h.revocations.Revoke(ctx, request.TokenIDFromContext(ctx), request.TokenExpiresAtFromContext(ctx))
+		if err != nil {
+			return err
+		}
+
+		h.cookies.ClearSessionCookies(w)
+		return response.WriteOK(w)
+	})
+}
+
+// handleLogoutAll revokes every access and refresh token of the user, on all devices.
+func (h *Handler) handleLogoutAll() http.HandlerFunc {
+	return handler.ErrorHandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		err := h.revokeAllSessions(r.Context(), request.UserIDFromContext(r.Context()))
+		if err != nil {
+			return err
+		}
+
+		h.cookies.ClearSessionCookies(w)
+		return response.WriteOK(w)
+	})
+}
+
+// handleJWKS serves the public keys used to verify access tokens, so other services can verify them
+// without sharing a secret.
+func (h *Handler) handleJWKS() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Allow caching, but not for too long so rotated keys are picked up.
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		response.WriteRawJSON(w, h.jwtAuth.JWKS())
+	}
+}
+
 // HandleVerifyAuth returns user info if the request is correctly authenticated.
 // Use with Authenticator middleware.
 func (h *Handler) handleVerifyAuth() http.HandlerFunc {
@@ -149,3 +752,540 @@ func (h *Handler) handleVerifyAuth() http.HandlerFunc {
 		})
 	})
 }
+
+// handleSendVerificationEmail sends a new verification email. It's public, so users who can't log in
+// before verifying can request it. The response doesn't reveal whether the email is registered.
+func (h *Handler) handleSendVerificationEmail() http.HandlerFunc {
+	type requestData struct {
+		Email string `json:"email"`
+	}
+
+	return handler.ErrorHandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		// Read request body.
+		reqBody, err := request.ReadJSON[requestData](r)
+		if err != nil {
+			return err
+		}
+
+		user, err := h.findUserForEmail(r, purposeVerifyEmail, reqBody.Email)
+		if err != nil {
+			return err
+		}
+		// Errors are only logged, so the response is the same whether the email is registered or not.
+		if user != nil && !user.VerifiedAt.Valid {
+			err = h.sendVerificationEmail(r.Context(), user)
+			if err != nil {
+				logger.Error(r.Context(), fmt.Sprintf("Send verification email error: %s.", err), "category", "internal_error")
+			}
+		}
+
+		return response.WriteOK(w)
+	})
+}
+
+func (h *Handler) handleVerifyEmail() http.HandlerFunc {
+	type requestData struct {
+		Token string `json:"token"`
+	}
+
+	return handler.ErrorHandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		// Read request body.
+		reqBody, err := request.ReadJSON[requestData](r)
+		if err != nil {
+			return err
+		}
+
+		t, user, err := h.verifyActionToken(r.Context(), reqBody.Token, purposeVerifyEmail)
+		if err != nil {
+			return err
+		}
+
+		err = h.repository.VerifyEmail(r.Context(), user.ID, t)
+		if err != nil {
+			return err
+		}
+
+		return response.WriteOK(w)
+	})
+}
+
+// handleSendPasswordResetEmail sends a password reset link.
+// The response doesn't reveal whether the email is registered.
+func (h *Handler) handleSendPasswordResetEmail() http.HandlerFunc {
+	type requestData struct {
+		Email string `json:"email"`
+	}
+
+	return handler.ErrorHandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		// Read request body.
+		reqBody, err := request.ReadJSON[requestData](r)
+		if err != nil {
+			return err
+		}
+
+		user, err := h.findUserForEmail(r, purposeResetPassword, reqBody.Email)
+		if err != nil {
+			return err
+		}
+		// Errors are only logged, so the response is the same whether the email is registered or not.
+		if user != nil {
+			err := h.sendPasswordResetEmail(r.Context(), user)
+			if err != nil {
+				logger.Error(r.Context(), fmt.Sprintf("Send password reset email error: %s.", err), "category", "internal_error")
+			}
+		}
+
+		return response.WriteOK(w)
+	})
+}
+
+func (h *Handler) sendPasswordResetEmail(ctx context.Context, user *User) error {
+	signed, err := h.signActionToken(user, purposeResetPassword, resetPasswordDuration)
+	if err != nil {
+		return err
+	}
+	return h.mailer.Send(ctx, &mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: "Open the link below to choose a new password:\n\n" +
+			h.appURL + "/reset-password?token=" + url.QueryEscape(signed) + "\n\n" +
+			"The link expires in 1 hour. If you didn't request a password reset, you can ignore this email.",
+	})
+}
+
+// handleResetPassword sets a new password using the token from the password reset email.
+// All sessions of the user are revoked.
+func (h *Handler) handleResetPassword() http.HandlerFunc {
+	type requestData struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	return handler.ErrorHandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		// Read request body.
+		reqBody, err := request.ReadJSON[requestData](r)
+		if err != nil {
+			return err
+		}
+
+		// Validate user input.
+		if err := validation.ValidateStruct(reqBody,
+			validation.Field(&reqBody.Token, validation.Required),
+			validation.Field(&reqBody.Password, validation.Required, validation.Length(8, 0)),
+		); err != nil {
+			if errs, ok := err.(validation.Errors); ok {
+				return response.ErrDataValidation(errs)
+			}
+			return err
+		}
+
+		ctx := r.Context()
+		t, user, err := h.verifyActionToken(ctx, reqBody.Token, purposeResetPassword)
+		if err != nil {
+			return err
+		}
+
+		user.SetNewPassword(reqBody.Password)
+		err = h.repository.ResetPassword(ctx, user.ID, user.PasswordHash, t)
+		if err != nil {
+			return err
+		}
+
+		err = h.revokeAllSessions(ctx, user.ID)
+		if err != nil {
+			return err
+		}
+
+		return response.WriteOK(w)
+	})
+}
+
+// findUserForEmail rate limits the request and returns the user with the email, or nil if not found.
+func (h *Handler) findUserForEmail(r *http.Request, action string, email string) (*User, error) {
+	keys := []string{
+		action + ":ip:" + request.ClientIP(r),
+		action + ":email:" + strings.ToLower(email),
+	}
+	err := h.mailLimiter.Hit(r.Context(), keys...)
+	if err != nil {
+		return nil, err
+	}
+
+	users, _, err := h.repository.GetAll(r.Context(), &UserFilter{Email: &email, Limit: 1})
+	if err != nil || len(users) == 0 {
+		return nil, err
+	}
+	return users[0], nil
+}
+
+func (h *Handler) sendVerificationEmail(ctx context.Context, user *User) error {
+	signed, err := h.signActionToken(user, purposeVerifyEmail, verifyEmailDuration)
+	if err != nil {
+		return err
+	}
+	return h.mailer.Send(ctx, &mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: "Open the link below to verify your email address:\n\n" +
+			h.appURL + "/verify-email?token=" + url.QueryEscape(signed) + "\n\n" +
+			"The link expires in 24 hours.",
+	})
+}
+
+// actionTokenBinding returns the user state the token is bound to. Changing the state invalidates
+// the token, e.g. a password reset link stops working once the password is changed.
+func actionTokenBinding(user *User, purpose string) []byte {
+	switch purpose {
+	case purposeResetPassword:
+		return user.PasswordHash
+	case purposeMFA:
+		return user.TOTPSecret
+	default:
+		return []byte(strings.ToLower(user.Email))
+	}
+}
+
+func (h *Handler) signActionToken(user *User, purpose string, duration time.Duration) (string, error) {
+	payload, err := json.Marshal(&actionToken{
+		ID:        uuid.New(),
+		Purpose:   purpose,
+		UserID:    user.ID,
+		ExpiresAt: time.Now().Add(duration).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	return h.signer.Sign(payload, []byte(purpose), actionTokenBinding(user, purpose)), nil
+}
+
+func (h *Handler) verifyActionToken(ctx context.Context, signed string, purpose string) (*actionToken, *User, error) {
+	// Payload is read before verification to find the user, whose state is needed to verify the signature.
+	payload, err := h.signer.Payload(signed)
+	if err != nil {
+		return nil, nil, errActionTokenInvalid
+	}
+	t := &actionToken{}
+	if err := json.Unmarshal(payload, t); err != nil || t.Purpose != purpose {
+		return nil, nil, errActionTokenInvalid
+	}
+	if time.Now().Unix() > t.ExpiresAt {
+		return nil, nil, errActionTokenInvalid
+	}
+
+	user, err := h.repository.Get(ctx, t.UserID)
+	if err != nil {
+		if response.ErrorResponseFrom(err).StatusCode == http.StatusNotFound {
+			return nil, nil, errActionTokenInvalid
+		}
+		return nil, nil, err
+	}
+
+	_, err = h.signer.Verify(signed, []byte(purpose), actionTokenBinding(user, purpose))
+	if err != nil {
+		return nil, nil, errActionTokenInvalid
+	}
+	return t, user, nil
+}
+
+// enrollTOTP generates a new TOTP secret for the user. 2FA is enabled once confirmed with a code.
+func (h *Handler) enrollTOTP(w http.ResponseWriter, r *http.Request) error {
+	type requestData struct {
+		CurrentPassword string `json:"current_password"`
+	}
+
+	type responseData struct {
+		Secret          string `json:"secret"`
+		ProvisioningURI string `json:"provisioning_uri"`
+	}
+
+	// Read request body.
+	reqBody, err := request.ReadJSON[requestData](r)
+	if err != nil {
+		return err
+	}
+
+	ctx := r.Context()
+	user, err := h.repository.Get(ctx, request.UserIDFromContext(ctx))
+	if err != nil {
+		return err
+	}
+	if !user.CheckPassword(reqBody.CurrentPassword) {
+		return errCurrentPassword
+	}
+	if user.TOTPEnabledAt.Valid {
+		return errTOTPEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return err
+	}
+	err = h.repository.SetTOTPSecret(ctx, user.ID, secret)
+	if err != nil {
+		return err
+	}
+
+	return response.WriteJSON(w, &responseData{
+		Secret:          totp.EncodeSecret(secret),
+		ProvisioningURI: totp.ProvisioningURI(totpIssuer, user.Email, secret),
+	})
+}
+
+// confirmTOTP enables 2FA with the first code from the authenticator app, and returns recovery codes.
+func (h *Handler) confirmTOTP(w http.ResponseWriter, r *http.Request) error {
+	type requestData struct {
+		Code string `json:"code"`
+	}
+
+	type responseData struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+
+	// Read request body.
+	reqBody, err := request.ReadJSON[requestData](r)
+	if err != nil {
+		return err
+	}
+
+	ctx := r.Context()
+	user, err := h.repository.Get(ctx, request.UserIDFromContext(ctx))
+	if err != nil {
+		return err
+	}
+	if user.TOTPEnabledAt.Valid {
+		return errTOTPEnabled
+	}
+	if user.TOTPSecret == nil {
+		return errTOTPNotEnrolled
+	}
+
+	step, ok := totp.Validate(user.TOTPSecret, reqBody.Code, time.Now(), 1)
+	if !ok {
+		return errMFACode
+	}
+	codes, hashes, err := generateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return err
+	}
+	err = h.repository.EnableTOTP(ctx, user.ID, step, hashes)
+	if err != nil {
+		return err
+	}
+
+	return response.WriteJSON(w, &responseData{RecoveryCodes: codes})
+}
+
+// regenerateRecoveryCodes replaces all recovery codes of the user. It requires a TOTP code.
+func (h *Handler) regenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) error {
+	type requestData struct {
+		Code string `json:"code"`
+	}
+
+	type responseData struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+
+	// Read request body.
+	reqBody, err := request.ReadJSON[requestData](r)
+	if err != nil {
+		return err
+	}
+
+	ctx := r.Context()
+	user, err := h.repository.Get(ctx, request.UserIDFromContext(ctx))
+	if err != nil {
+		return err
+	}
+	if !user.TOTPEnabledAt.Valid {
+		return errTOTPNotEnabled
+	}
+	err = h.useTOTPCode(ctx, user, reqBody.Code)
+	if errors.Is(err, errInvalidMFACode) {
+		return errMFACode
+	}
+	if err != nil {
+		return err
+	}
+
+	codes, hashes, err := generateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return err
+	}
+	err = h.repository.ReplaceRecoveryCodes(ctx, user.ID, hashes)
+	if err != nil {
+		return err
+	}
+
+	return response.WriteJSON(w, &responseData{RecoveryCodes: codes})
+}
+
+// disableTOTP disables 2FA. It requires both the current password and a TOTP code.
+func (h *Handler) disableTOTP(w http.ResponseWriter, r *http.Request) error {
+	type requestData struct {
+		CurrentPassword string `json:"current_password"`
+		Code            string `json:"code"`
+	}
+
+	// Read request body.
+	reqBody, err := request.ReadJSON[requestData](r)
+	if err != nil {
+		return err
+	}
+
+	ctx := r.Context()
+	user, err := h.repository.Get(ctx, request.UserIDFromContext(ctx))
+	if err != nil {
+		return err
+	}
+	if !user.CheckPassword(reqBody.CurrentPassword) {
+		return errCurrentPassword
+	}
+	if !user.TOTPEnabledAt.Valid {
+		return errTOTPNotEnabled
+	}
+	err = h.useTOTPCode(ctx, user, reqBody.Code)
+	if errors.Is(err, errInvalidMFACode) {
+		return errMFACode
+	}
+	if err != nil {
+		return err
+	}
+
+	err = h.repository.DisableTOTP(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	return response.WriteOK(w)
+}
+
+// useTOTPCode validates the code, allowing one time step of clock drift, and prevents its reuse.
+func (h *Handler) useTOTPCode(ctx context.Context, user *User, code string) error {
+	step, ok := totp.Validate(user.TOTPSecret, code, time.Now(), 1)
+	if !ok {
+		return errInvalidMFACode
+	}
+	return h.repository.UseTOTPStep(ctx, user.ID, step)
+}
+
+func (h *Handler) getMe(w http.ResponseWriter, r *http.Request) error {
+	user, err := h.repository.Get(r.Context(), request.UserIDFromContext(r.Context()))
+	if err != nil {
+		return err
+	}
+
+	return response.WriteJSON(w, user)
+}
+
+// updateMe changes email and/or password of the user. The current password must be re-entered.
+// Changing the password logs the user out on all devices.
+func (h *Handler) updateMe(w http.ResponseWriter, r *http.Request) error {
+	type requestData struct {
+		UserUpdate
+		CurrentPassword string `json:"current_password"`
+	}
+
+	// Read request body.
+	reqBody, err := request.ReadJSON[requestData](r)
+	if err != nil {
+		return err
+	}
+
+	// Validate user input.
+	if err := validation.ValidateStruct(reqBody,
+		validation.Field(&reqBody.Email, validation.NilOrNotEmpty, is.Email),
+		validation.Field(&reqBody.Password, validation.NilOrNotEmpty, validation.Length(8, 0)),
+		validation.Field(&reqBody.CurrentPassword, validation.Required),
+	); err != nil {
+		if errs, ok := err.(validation.Errors); ok {
+			return response.ErrDataValidation(errs)
+		}
+		return err
+	}
+
+	ctx := r.Context()
+	userID := request.UserIDFromContext(ctx)
+	err = h.checkPassword(ctx, userID, reqBody.CurrentPassword)
+	if err != nil {
+		return err
+	}
+
+	err = h.repository.Update(ctx, userID, &reqBody.UserUpdate)
+	if err != nil {
+		return err
+	}
+
+	if reqBody.Email != nil {
+		user, err := h.repository.Get(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if !user.VerifiedAt.Valid {
+			err = h.sendVerificationEmail(ctx, user)
+			if err != nil {
+				logger.Error(ctx, fmt.Sprintf("Send verification email error: %s.", err), "category", "internal_error")
+			}
+		}
+	}
+
+	if reqBody.Password != nil {
+		err = h.revokeAllSessions(ctx, userID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return response.WriteOK(w)
+}
+
+// deleteMe deletes the user and all todos owned by the user. The current password must be re-entered.
+func (h *Handler) deleteMe(w http.ResponseWriter, r *http.Request) error {
+	type requestData struct {
+		CurrentPassword string `json:"current_password"`
+	}
+
+	// Read request body.
+	reqBody, err := request.ReadJSON[requestData](r)
+	if err != nil {
+		return err
+	}
+
+	ctx := r.Context()
+	userID := request.UserIDFromContext(ctx)
+	err = h.checkPassword(ctx, userID, reqBody.CurrentPassword)
+	if err != nil {
+		return err
+	}
+
+	// Revoke first, so the tokens are never valid for a deleted user.
+	err = h.revokeAllSessions(ctx, userID)
+	if err != nil {
+		return err
+	}
+	err = h.repository.Delete(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	return response.WriteOK(w)
+}
+
+func (h *Handler) checkPassword(ctx context.Context, userID uuid.UUID, password string) error {
+	user, err := h.repository.Get(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !user.CheckPassword(password) {
+		return errCurrentPassword
+	}
+	return nil
+}
+
+// revokeAllSessions revokes every access and refresh token of the user.
+func (h *Handler) revokeAllSessions(ctx context.Context, userID uuid.UUID) error {
+	err := h.repository.RevokeAllRefreshTokens(ctx, userID)
+	if err != nil {
+		return err
+	}
+	return h.revocations.RevokeAllForUser(ctx, userID, time.Now())
+}
@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/guregu/null/v5"
+	"github.com/nathansiegfrid/todolist/pkg/ratelimit"
+	"github.com/nathansiegfrid/todolist/pkg/token"
+)
+
+// fakeRepository implements the methods used by the tested handlers. Other methods panic.
+type fakeRepository struct {
+	repository
+	user *User
+}
+
+func (f *fakeRepository) Get(ctx context.Context, id uuid.UUID) (*User, error) {
+	return f.user, nil
+}
+
+func (f *fakeRepository) UseTOTPStep(ctx context.Context, userID uuid.UUID, step int64) error {
+	return nil
+}
+
+func (f *fakeRepository) UseRecoveryCode(ctx context.Context, userID uuid.UUID, codeHash []byte) error {
+	return errInvalidMFACode
+}
+
+func TestHandleLoginMFAWrongCode(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"totp code", `"code":"abcdef"`},
+		{"recovery code", `"recovery_code":"wrong-code"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := &User{
+				ID:            uuid.New(),
+				Email:         "user@example.com",
+				TOTPSecret:    []byte("12345678901234567890"),
+				TOTPEnabledAt: null.TimeFrom(time.Now()),
+			}
+			h := &Handler{
+				repository: &fakeRepository{user: user},
+				signer:     token.NewSigner([]byte("test secret")),
+				// Block after the first failed attempt.
+				loginLimiter: ratelimit.NewLimiter(ratelimit.NewMemoryStore(), ratelimit.Policy{
+					Window:    time.Hour,
+					BaseDelay: time.Minute,
+					MaxDelay:  time.Minute,
+				}),
+			}
+			mfaToken, err := h.signActionToken(user, purposeMFA, mfaTokenDuration)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			wantStatus := []int{http.StatusUnauthorized, http.StatusTooManyRequests}
+			for i, want := range wantStatus {
+				body := `{"mfa_token":"` + mfaToken + `",` + tt.body + `}`
+				w := httptest.NewRecorder()
+				h.handleLoginMFA()(w, httptest.NewRequest("POST", "/v1/login/mfa", strings.NewReader(body)))
+				if w.Code != want {
+					t.Fatalf("attempt %d: status = %d, want %d, body %s", i+1, w.Code, want, w.Body)
+				}
+			}
+		})
+	}
+}
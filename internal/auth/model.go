@@ -1,20 +1,31 @@
 package auth
 
 import (
+	"crypto/rand"
 	"crypto/sha256"
+	"encoding/base32"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/guregu/null/v5"
+	"github.com/nathansiegfrid/todolist/pkg/query"
 	"golang.org/x/crypto/bcrypt"
 )
 
 type User struct {
-	ID           uuid.UUID `json:"id"`
-	Email        string    `json:"email"`
-	PasswordHash []byte    `json:"-"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID            uuid.UUID `json:"id"`
+	Email         string    `json:"email"`
+	PasswordHash  []byte    `json:"-"`
+	VerifiedAt    null.Time `json:"verified_at"`
+	TOTPSecret    []byte    `json:"-"` // Set when enrolling, TOTPEnabledAt is set once confirmed.
+	TOTPEnabledAt null.Time `json:"totp_enabled_at"`
+	TOTPLastStep  int64     `json:"-"` // Last used TOTP time step, to reject replayed codes.
+	Role          string    `json:"role"`
+	DisabledAt    null.Time `json:"disabled_at"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
 }
 
 func (u *User) SetNewPassword(p string) {
@@ -32,16 +43,91 @@ func (u *User) CheckPassword(p string) bool {
 	return err == nil
 }
 
+// Roles of users. Admins can manage other users.
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// UserFilter is also recorded in the audit log when admins search users.
 type UserFilter struct {
-	ID     *uuid.UUID `schema:"id"`
-	Email  *string    `schema:"email"`
-	Limit  int        `schema:"limit"`
-	Offset int        `schema:"offset"`
-}
+	ID        *uuid.UUID               `schema:"id" json:"id,omitempty"`
+	Email     *string                  `schema:"email" json:"email,omitempty"`
+	Query     *string                  `schema:"q" json:"q,omitempty"` // Part of email.
+	Role      *string                  `schema:"role" json:"role,omitempty"`
+	Disabled  *bool                    `schema:"disabled" json:"disabled,omitempty"`
+	CreatedAt *query.Filter[time.Time] `schema:"created_at" json:"created_at,omitempty"` // E.g. "created_at[gte]=2024-01-01".
 
-// TODO: User update should require additional short-timed token, which requires re-auth with password.
+	Cursor       string `schema:"cursor" json:"-"`
+	Limit        int    `schema:"limit" json:"limit,omitempty"` // Defaults to query.DefaultLimit, at most query.MaxLimit.
+	IncludeTotal bool   `schema:"include_total" json:"-"`
+}
 
 type UserUpdate struct {
-	Email    *string `json:"id"`
+	Email    *string `json:"email"`
 	Password *string `json:"password"`
 }
+
+// RefreshToken is an opaque, single-use token exchanged for a new access token.
+// Tokens rotated from the same login share a FamilyID, so a replayed token can revoke the whole chain.
+type RefreshToken struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	FamilyID  uuid.UUID
+	TokenHash []byte
+	ExpiresAt time.Time
+	UsedAt    null.Time
+	RevokedAt null.Time
+	CreatedAt time.Time
+}
+
+// UserIdentity links a user to an account at an OpenID provider.
+// Issuer and Subject identify the account, the email may change at the provider.
+type UserIdentity struct {
+	ID            uuid.UUID
+	UserID        uuid.UUID
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool // Not stored, it only decides whether an existing user can be linked.
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// Purposes of action tokens.
+const (
+	purposeVerifyEmail   = "verify_email"
+	purposeResetPassword = "reset_password"
+	purposeMFA           = "mfa" // Completes login after password check when 2FA is enabled.
+)
+
+// actionToken is the payload of a signed, single-use token sent by email.
+type actionToken struct {
+	ID        uuid.UUID `json:"jti"`
+	Purpose   string    `json:"pur"`
+	UserID    uuid.UUID `json:"sub"`
+	ExpiresAt int64     `json:"exp"`
+}
+
+// generateRecoveryCodes returns 2FA recovery codes to be shown once to the user, and their hashes to be stored.
+func generateRecoveryCodes(n int) ([]string, [][]byte, error) {
+	codes := make([]string, n)
+	hashes := make([][]byte, n)
+	for i := range codes {
+		b := make([]byte, 10)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		code := strings.ToLower(base32.StdEncoding.EncodeToString(b)) // 16 characters.
+		codes[i] = code[:8] + "-" + code[8:]
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode normalizes the code before hashing, so it can be entered with or without dashes.
+func hashRecoveryCode(code string) []byte {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(code))
+	return sum[:]
+}
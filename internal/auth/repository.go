@@ -4,81 +4,160 @@ import (
 	"context"
 	"database/sql"
 	"errors"
-	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/guregu/null/v5"
 	"github.com/nathansiegfrid/todolist/pkg/postgres"
+	"github.com/nathansiegfrid/todolist/pkg/query"
 	"github.com/nathansiegfrid/todolist/pkg/request"
 	"github.com/nathansiegfrid/todolist/pkg/response"
+	"github.com/nathansiegfrid/todolist/pkg/token"
 )
 
+// errInvalidMFACode is returned when a TOTP code or recovery code is wrong or already used.
+// Handlers map it to errMFACode, after counting the attempt against the rate limit.
+var errInvalidMFACode = errors.New("invalid MFA code")
+
+// TxHook runs in the transaction of a change before it's committed, e.g. to write an audit log record
+// that is committed only together with the change.
+type TxHook func(ctx context.Context, tx *sql.Tx) error
+
+func runHooks(ctx context.Context, tx *sql.Tx, hooks []TxHook) error {
+	for _, hook := range hooks {
+		if err := hook(ctx, tx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 type Repository struct {
-	db *sql.DB
+	db      *sql.DB
+	cursors *token.Signer
 }
 
-func NewRepository(db *sql.DB) *Repository {
-	return &Repository{db}
+func NewRepository(db *sql.DB, cursors *token.Signer) *Repository {
+	return &Repository{db, cursors}
 }
 
-func (r *Repository) GetAll(ctx context.Context, filter *UserFilter) ([]*User, error) {
+func (r *Repository) GetAll(ctx context.Context, filter *UserFilter) ([]*User, *response.Page, error) {
 	// Translate filter into WHERE conditions and args.
-	where, args, argIndex := []string{"TRUE"}, []any{}, 1
+	b := query.NewBuilder()
 	if v := filter.ID; v != nil {
-		where = append(where, fmt.Sprintf("id = $%d", argIndex))
-		args = append(args, *v)
-		argIndex += 1
+		b.Where("id = " + b.Arg(*v))
 	}
 	if v := filter.Email; v != nil {
-		where = append(where, fmt.Sprintf("email = $%d", argIndex))
-		args = append(args, strings.ToLower(*v))
-		argIndex += 1
+		b.Where("email = " + b.Arg(strings.ToLower(*v)))
+	}
+	if v := filter.Query; v != nil {
+		// Escape LIKE wildcards, so the query only matches literally.
+		b.Where("email LIKE " + b.Arg("%"+query.EscapeLike(strings.ToLower(*v))+"%"))
+	}
+	if v := filter.Role; v != nil {
+		b.Where("role = " + b.Arg(*v))
 	}
+	if v := filter.Disabled; v != nil {
+		if *v {
+			b.Where("disabled_at IS NOT NULL")
+		} else {
+			b.Where("disabled_at IS NULL")
+		}
+	}
+	query.Where(b, "created_at", filter.CreatedAt)
 
-	var limit, offset string
-	if filter.Limit > 0 {
-		limit = fmt.Sprintf(" LIMIT %d ", filter.Limit)
+	// Count before adding the cursor condition, so the total includes all pages.
+	page := &response.Page{}
+	if filter.IncludeTotal {
+		var total int
+		err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM "user" WHERE `+b.SQL(), b.Args()...).Scan(&total)
+		if err != nil {
+			return nil, nil, err
+		}
+		page.Total = &total
 	}
-	if filter.Offset > 0 {
-		offset = fmt.Sprintf(" OFFSET %d ", filter.Offset)
+
+	sort := query.Sort{{Column: "email", Type: "TEXT"}, {Column: "id", Type: "UUID"}}
+	filters := b.Fingerprint()
+	cursor, err := query.DecodeCursor(r.cursors, sort, filters, filter.Cursor)
+	if err != nil {
+		return nil, nil, err
 	}
+	query.After(b, sort, cursor)
+	limit := query.Limit(filter.Limit)
 
 	rows, err := r.db.QueryContext(ctx, `
-		SELECT id, email, password_hash, created_at, updated_at
+		SELECT id, email, password_hash, verified_at, totp_secret, totp_enabled_at, totp_last_step, role, disabled_at,
+			created_at, updated_at
 		FROM "user"
-		WHERE `+strings.Join(where, " AND ")+`
-		ORDER BY email ASC`+
-		limit+offset,
-		args...,
+		WHERE `+b.SQL()+`
+		ORDER BY `+sort.OrderBy(cursor)+`
+		LIMIT `+strconv.Itoa(limit+1),
+		b.Args()...,
 	)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	defer rows.Close()
 
-	var users []*User
+	users := []*User{}
 	for rows.Next() {
 		u := &User{}
-		err := rows.Scan(&u.ID, &u.Email, &u.PasswordHash, &u.CreatedAt, &u.UpdatedAt)
+		err := rows.Scan(
+			&u.ID,
+			&u.Email,
+			&u.PasswordHash,
+			&u.VerifiedAt,
+			&u.TOTPSecret,
+			&u.TOTPEnabledAt,
+			&u.TOTPLastStep,
+			&u.Role,
+			&u.DisabledAt,
+			&u.CreatedAt,
+			&u.UpdatedAt,
+		)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		users = append(users, u)
 	}
-	return users, nil
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	users, next, prev := query.Paginate(users, limit, cursor, func(u *User) []any {
+		return []any{u.Email, u.ID}
+	})
+	page.NextCursor = query.EncodeCursor(r.cursors, sort, filters, next)
+	page.PrevCursor = query.EncodeCursor(r.cursors, sort, filters, prev)
+	return users, page, nil
 }
 
 func (r *Repository) Get(ctx context.Context, id uuid.UUID) (*User, error) {
 	row := r.db.QueryRowContext(ctx, `
-		SELECT id, email, password_hash, created_at, updated_at
+		SELECT id, email, password_hash, verified_at, totp_secret, totp_enabled_at, totp_last_step, role, disabled_at,
+			created_at, updated_at
 		FROM "user"
 		WHERE id = $1`,
 		id,
 	)
 
 	u := &User{}
-	err := row.Scan(&u.ID, &u.Email, &u.PasswordHash, &u.CreatedAt, &u.UpdatedAt)
+	err := row.Scan(
+		&u.ID,
+		&u.Email,
+		&u.PasswordHash,
+		&u.VerifiedAt,
+		&u.TOTPSecret,
+		&u.TOTPEnabledAt,
+		&u.TOTPLastStep,
+		&u.Role,
+		&u.DisabledAt,
+		&u.CreatedAt,
+		&u.UpdatedAt,
+	)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, response.ErrIDNotFound("User", id)
@@ -118,7 +197,8 @@ func (r *Repository) Update(ctx context.Context, id uuid.UUID, update *UserUpdat
 	// FOR UPDATE will lock selected row, which prevents new writes and locks to the same row
 	// before current Tx is done.
 	row := tx.QueryRowContext(ctx, `
-		SELECT id, email, password_hash, created_at, updated_at
+		SELECT id, email, password_hash, verified_at, totp_secret, totp_enabled_at, totp_last_step, role, disabled_at,
+			created_at, updated_at
 		FROM "user"
 		WHERE id = $1
 		FOR UPDATE`,
@@ -126,7 +206,19 @@ func (r *Repository) Update(ctx context.Context, id uuid.UUID, update *UserUpdat
 	)
 
 	u := &User{}
-	err = row.Scan(&u.ID, &u.Email, &u.PasswordHash, &u.CreatedAt, &u.UpdatedAt)
+	err = row.Scan(
+		&u.ID,
+		&u.Email,
+		&u.PasswordHash,
+		&u.VerifiedAt,
+		&u.TOTPSecret,
+		&u.TOTPEnabledAt,
+		&u.TOTPLastStep,
+		&u.Role,
+		&u.DisabledAt,
+		&u.CreatedAt,
+		&u.UpdatedAt,
+	)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return response.ErrIDNotFound("User", id)
@@ -142,8 +234,9 @@ func (r *Repository) Update(ctx context.Context, id uuid.UUID, update *UserUpdat
 
 	// Apply patch update.
 	var updated bool
-	if v := update.Email; v != nil {
+	if v := update.Email; v != nil && !strings.EqualFold(*v, u.Email) {
 		u.Email = *v
+		u.VerifiedAt = null.Time{} // New email must be verified again.
 		updated = true
 	}
 	if v := update.Password; v != nil {
@@ -157,9 +250,520 @@ func (r *Repository) Update(ctx context.Context, id uuid.UUID, update *UserUpdat
 
 	result, err := tx.ExecContext(ctx, `
 		UPDATE "user"
-		SET email = $1, password_hash = $2, updated_at = $3
-		WHERE id = $4`,
-		strings.ToLower(u.Email), u.PasswordHash, u.UpdatedAt, id,
+		SET email = $1, password_hash = $2, verified_at = $3, updated_at = $4
+		WHERE id = $5`,
+		strings.ToLower(u.Email), u.PasswordHash, u.VerifiedAt, u.UpdatedAt, id,
+	)
+	if err != nil {
+		if postgres.IsUniqueViolation(err) {
+			return response.ErrConflict("Email", u.Email)
+		}
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return response.ErrIDNotFound("User", id)
+	}
+
+	return tx.Commit()
+}
+
+// Delete deletes the user. Todos owned by the user are deleted with it.
+func (r *Repository) Delete(ctx context.Context, id uuid.UUID, hooks ...TxHook) error {
+	// Check if resource is owned by user. Admins can delete any user.
+	userID := request.UserIDFromContext(ctx)
+	if userID == uuid.Nil || (id != userID && request.RoleFromContext(ctx) != RoleAdmin) {
+		return response.ErrPermission()
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Personal todos are deleted with the user, but todos in workspaces belong to the workspace.
+	_, err = tx.ExecContext(ctx, "UPDATE todo SET user_id = NULL, version = version + 1 WHERE user_id = $1 AND workspace_id IS NOT NULL", id)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM "user" WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return response.ErrIDNotFound("User", id)
+	}
+
+	err = runHooks(ctx, tx, hooks)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *Repository) CreateRefreshToken(ctx context.Context, t *RefreshToken) error {
+	t.ID = uuid.New()
+	t.CreatedAt = time.Now()
+
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO refresh_token (id, user_id, family_id, token_hash, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		t.ID, t.UserID, t.FamilyID, t.TokenHash, t.ExpiresAt, t.CreatedAt,
+	)
+	return err
+}
+
+// RotateRefreshToken marks the token with tokenHash as used and stores next in the same family.
+// If the token has been used before, the whole family is revoked, because either the legitimate
+// client or an attacker is replaying a stolen token.
+func (r *Repository) RotateRefreshToken(ctx context.Context, tokenHash []byte, next *RefreshToken) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	row := tx.QueryRowContext(ctx, `
+		SELECT id, user_id, family_id, token_hash, expires_at, used_at, revoked_at, created_at
+		FROM refresh_token
+		WHERE token_hash = $1
+		FOR UPDATE`,
+		tokenHash,
+	)
+
+	t := &RefreshToken{}
+	err = row.Scan(&t.ID, &t.UserID, &t.FamilyID, &t.TokenHash, &t.ExpiresAt, &t.UsedAt, &t.RevokedAt, &t.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return errRefreshTokenInvalid
+		}
+		return err
+	}
+
+	if t.RevokedAt.Valid {
+		return errRefreshTokenInvalid
+	}
+	if t.UsedAt.Valid {
+		_, err := tx.ExecContext(ctx, `
+			UPDATE refresh_token
+			SET revoked_at = NOW()
+			WHERE family_id = $1 AND revoked_at IS NULL`,
+			t.FamilyID,
+		)
+		if err != nil {
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		return errRefreshTokenReused
+	}
+	if time.Now().After(t.ExpiresAt) {
+		return errRefreshTokenExpired
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE refresh_token SET used_at = NOW() WHERE id = $1", t.ID)
+	if err != nil {
+		return err
+	}
+
+	next.ID = uuid.New()
+	next.UserID = t.UserID
+	next.FamilyID = t.FamilyID
+	next.CreatedAt = time.Now()
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO refresh_token (id, user_id, family_id, token_hash, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		next.ID, next.UserID, next.FamilyID, next.TokenHash, next.ExpiresAt, next.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RevokeRefreshTokenFamily revokes the family of the refresh token with tokenHash.
+// Only tokens of the user from context are revoked.
+func (r *Repository) RevokeRefreshTokenFamily(ctx context.Context, tokenHash []byte) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE refresh_token
+		SET revoked_at = NOW()
+		WHERE revoked_at IS NULL AND family_id = (
+			SELECT family_id FROM refresh_token WHERE token_hash = $1 AND user_id = $2
+		)`,
+		tokenHash, request.UserIDFromContext(ctx),
+	)
+	return err
+}
+
+func (r *Repository) RevokeAllRefreshTokens(ctx context.Context, userID uuid.UUID) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE refresh_token
+		SET revoked_at = NOW()
+		WHERE user_id = $1 AND revoked_at IS NULL`,
+		userID,
+	)
+	return err
+}
+
+// VerifyEmail marks the email of the user as verified and uses up the action token.
+func (r *Repository) VerifyEmail(ctx context.Context, userID uuid.UUID, t *actionToken) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = useActionToken(ctx, tx, t)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE "user"
+		SET verified_at = COALESCE(verified_at, NOW()), updated_at = NOW()
+		WHERE id = $1`,
+		userID,
+	)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ResetPassword sets a new password hash for the user and uses up the action token.
+func (r *Repository) ResetPassword(ctx context.Context, userID uuid.UUID, passwordHash []byte, t *actionToken) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = useActionToken(ctx, tx, t)
+	if err != nil {
+		return err
+	}
+
+	// Receiving the reset email proves ownership of the address as well.
+	_, err = tx.ExecContext(ctx, `
+		UPDATE "user"
+		SET password_hash = $1, verified_at = COALESCE(verified_at, NOW()), updated_at = NOW()
+		WHERE id = $2`,
+		passwordHash, userID,
+	)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func useActionToken(ctx context.Context, tx *sql.Tx, t *actionToken) error {
+	// Used tokens of the past are useless once expired, clean them up on the way.
+	_, err := tx.ExecContext(ctx, "DELETE FROM used_action_token WHERE expires_at < NOW()")
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO used_action_token (id, expires_at)
+		VALUES ($1, $2)
+		ON CONFLICT (id) DO NOTHING`,
+		t.ID, time.Unix(t.ExpiresAt, 0),
+	)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return errActionTokenUsed
+	}
+	return nil
+}
+
+// SetTOTPSecret stores a pending TOTP secret, replacing any earlier unconfirmed one.
+func (r *Repository) SetTOTPSecret(ctx context.Context, userID uuid.UUID, secret []byte) error {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE "user"
+		SET totp_secret = $1, updated_at = NOW()
+		WHERE id = $2 AND totp_enabled_at IS NULL`,
+		secret, userID,
+	)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return errTOTPEnabled
+	}
+	return nil
+}
+
+// EnableTOTP confirms the pending TOTP secret and stores the recovery codes.
+func (r *Repository) EnableTOTP(ctx context.Context, userID uuid.UUID, step int64, codeHashes [][]byte) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE "user"
+		SET totp_enabled_at = NOW(), totp_last_step = $1, updated_at = NOW()
+		WHERE id = $2 AND totp_secret IS NOT NULL AND totp_enabled_at IS NULL`,
+		step, userID,
+	)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return errTOTPEnabled
+	}
+
+	err = replaceRecoveryCodes(ctx, tx, userID, codeHashes)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DisableTOTP removes the TOTP secret and recovery codes of the user.
+func (r *Repository) DisableTOTP(ctx context.Context, userID uuid.UUID) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE "user"
+		SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = 0, updated_at = NOW()
+		WHERE id = $1`,
+		userID,
+	)
+	if err != nil {
+		return err
+	}
+
+	err = replaceRecoveryCodes(ctx, tx, userID, nil)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ReplaceRecoveryCodes invalidates all recovery codes of the user and stores new ones.
+func (r *Repository) ReplaceRecoveryCodes(ctx context.Context, userID uuid.UUID, codeHashes [][]byte) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = replaceRecoveryCodes(ctx, tx, userID, codeHashes)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UseTOTPStep records the time step of a valid TOTP code.
+// Codes from the same or earlier time step are rejected, so an intercepted code can't be replayed.
+func (r *Repository) UseTOTPStep(ctx context.Context, userID uuid.UUID, step int64) error {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE "user"
+		SET totp_last_step = $1
+		WHERE id = $2 AND totp_last_step < $1`,
+		step, userID,
+	)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return errInvalidMFACode
+	}
+	return nil
+}
+
+// UseRecoveryCode marks an unused recovery code of the user as used.
+func (r *Repository) UseRecoveryCode(ctx context.Context, userID uuid.UUID, codeHash []byte) error {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE recovery_code
+		SET used_at = NOW()
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`,
+		userID, codeHash,
+	)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return errInvalidMFACode
+	}
+	return nil
+}
+
+// UseActionToken makes the action token unusable, for tokens that don't change user state when used.
+func (r *Repository) UseActionToken(ctx context.Context, t *actionToken) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = useActionToken(ctx, tx, t)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx *sql.Tx, userID uuid.UUID, codeHashes [][]byte) error {
+	_, err := tx.ExecContext(ctx, "DELETE FROM recovery_code WHERE user_id = $1", userID)
+	if err != nil {
+		return err
+	}
+
+	for _, h := range codeHashes {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO recovery_code (id, user_id, code_hash, created_at)
+			VALUES ($1, $2, $3, NOW())`,
+			uuid.New(), userID, h,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoginWithIdentity returns the ID of the user linked to the identity. If there's none, the identity is
+// linked to the user with the same email, or to a new user without password.
+func (r *Repository) LoginWithIdentity(ctx context.Context, identity *UserIdentity) (uuid.UUID, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	defer tx.Rollback()
+
+	var userID uuid.UUID
+	err = tx.QueryRowContext(ctx, `
+		UPDATE user_identity
+		SET email = $1, updated_at = NOW()
+		WHERE issuer = $2 AND subject = $3
+		RETURNING user_id`,
+		identity.Email, identity.Issuer, identity.Subject,
+	).Scan(&userID)
+	if err == nil {
+		return userID, tx.Commit()
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return uuid.Nil, err
+	}
+
+	if identity.Email == "" {
+		return uuid.Nil, errIdentityEmailMissing
+	}
+	err = tx.QueryRowContext(ctx, `SELECT id FROM "user" WHERE email = $1 FOR UPDATE`,
+		strings.ToLower(identity.Email),
+	).Scan(&userID)
+	switch {
+	case err == nil:
+		// Linking to an unverified email would let anyone take over the account
+		// by registering its email at a provider that doesn't verify emails.
+		if !identity.EmailVerified {
+			return uuid.Nil, errIdentityEmailUnverified
+		}
+		_, err = tx.ExecContext(ctx, `
+			UPDATE "user"
+			SET verified_at = COALESCE(verified_at, NOW()), updated_at = NOW()
+			WHERE id = $1`,
+			userID,
+		)
+		if err != nil {
+			return uuid.Nil, err
+		}
+	case errors.Is(err, sql.ErrNoRows):
+		userID = uuid.New()
+		var verifiedAt null.Time
+		if identity.EmailVerified {
+			verifiedAt = null.TimeFrom(time.Now())
+		}
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO "user" (id, email, verified_at, created_at, updated_at)
+			VALUES ($1, $2, $3, NOW(), NOW())`,
+			userID, strings.ToLower(identity.Email), verifiedAt,
+		)
+		if err != nil {
+			return uuid.Nil, err
+		}
+	default:
+		return uuid.Nil, err
+	}
+
+	identity.ID = uuid.New()
+	identity.UserID = userID
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO user_identity (id, user_id, issuer, subject, email, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, NOW(), NOW())`,
+		identity.ID, identity.UserID, identity.Issuer, identity.Subject, identity.Email,
+	)
+	if err != nil {
+		if postgres.IsUniqueViolation(err) {
+			return uuid.Nil, response.ErrConflict("Identity", identity.Subject)
+		}
+		return uuid.Nil, err
+	}
+	return userID, tx.Commit()
+}
+
+// SetDisabled disables or enables the user. Disabling also revokes all refresh tokens of the user,
+// access tokens must be revoked by the caller.
+func (r *Repository) SetDisabled(ctx context.Context, id uuid.UUID, disabled bool, hooks ...TxHook) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE "user"
+		SET disabled_at = CASE WHEN $1 THEN COALESCE(disabled_at, NOW()) END, updated_at = NOW()
+		WHERE id = $2`,
+		disabled, id,
 	)
 	if err != nil {
 		return err
@@ -173,5 +777,53 @@ func (r *Repository) Update(ctx context.Context, id uuid.UUID, update *UserUpdat
 		return response.ErrIDNotFound("User", id)
 	}
 
+	if disabled {
+		_, err = tx.ExecContext(ctx, `
+			UPDATE refresh_token
+			SET revoked_at = NOW()
+			WHERE user_id = $1 AND revoked_at IS NULL`,
+			id,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = runHooks(ctx, tx, hooks)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *Repository) SetRole(ctx context.Context, id uuid.UUID, role string, hooks ...TxHook) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE "user"
+		SET role = $1, updated_at = NOW()
+		WHERE id = $2`,
+		role, id,
+	)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return response.ErrIDNotFound("User", id)
+	}
+
+	err = runHooks(ctx, tx, hooks)
+	if err != nil {
+		return err
+	}
 	return tx.Commit()
 }
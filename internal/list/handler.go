@@ -0,0 +1,175 @@
+package list
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"regexp"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/google/uuid"
+	"github.com/nathansiegfrid/todolist/pkg/handler"
+	"github.com/nathansiegfrid/todolist/pkg/request"
+	"github.com/nathansiegfrid/todolist/pkg/response"
+)
+
+// Colors are hex RGB, e.g. "#1e90ff".
+var colorRegexp = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+type repository interface {
+	GetAll(ctx context.Context, filter *ListFilter) ([]*List, error)
+	Get(ctx context.Context, id uuid.UUID) (*List, error)
+	Create(ctx context.Context, l *List) error
+	Update(ctx context.Context, id uuid.UUID, update *ListUpdate) error
+	Delete(ctx context.Context, id uuid.UUID, mode string) error
+}
+
+type Handler struct {
+	repository repository
+}
+
+func NewHandler(db *sql.DB) *Handler {
+	return &Handler{
+		repository: NewRepository(db),
+	}
+}
+
+func (h *Handler) HandleListsRoute() http.HandlerFunc {
+	return handler.MethodHandler{
+		"GET":  handler.ErrorHandlerFunc(h.getAllLists),
+		"POST": handler.ErrorHandlerFunc(h.createList),
+	}.HandlerFunc()
+}
+
+func (h *Handler) HandleListsIDRoute() http.HandlerFunc {
+	return handler.MethodHandler{
+		"GET":    handler.ErrorHandlerFunc(h.getList),
+		"PATCH":  handler.ErrorHandlerFunc(h.updateList),
+		"DELETE": handler.ErrorHandlerFunc(h.deleteList),
+	}.HandlerFunc()
+}
+
+func (h *Handler) getAllLists(w http.ResponseWriter, r *http.Request) error {
+	// Read URL query.
+	filter, err := request.ReadURLQuery[ListFilter](r)
+	if err != nil {
+		return err
+	}
+
+	lists, err := h.repository.GetAll(r.Context(), filter)
+	if err != nil {
+		return err
+	}
+
+	return response.WriteJSON(w, lists)
+}
+
+func (h *Handler) getList(w http.ResponseWriter, r *http.Request) error {
+	// Read request param "id".
+	id, err := request.ReadID(r)
+	if err != nil {
+		return err
+	}
+
+	l, err := h.repository.Get(r.Context(), id)
+	if err != nil {
+		return err
+	}
+
+	return response.WriteJSON(w, l)
+}
+
+func (h *Handler) createList(w http.ResponseWriter, r *http.Request) error {
+	// Read request body.
+	l, err := request.ReadJSON[List](r)
+	if err != nil {
+		return err
+	}
+
+	// Validate user input.
+	if err := validation.ValidateStruct(l,
+		validation.Field(&l.Name, validation.Required, validation.Length(0, 100)),
+		validation.Field(&l.Color, validation.Match(colorRegexp).Error("must be a hex color like #1e90ff")),
+		validation.Field(&l.Icon, validation.Length(0, 50)),
+	); err != nil {
+		if errs, ok := err.(validation.Errors); ok {
+			return response.ErrDataValidation(errs)
+		}
+		return err
+	}
+
+	err = h.repository.Create(r.Context(), l)
+	if err != nil {
+		return err
+	}
+
+	return response.WriteJSON(w, l)
+}
+
+func (h *Handler) updateList(w http.ResponseWriter, r *http.Request) error {
+	// Read request param "id".
+	id, err := request.ReadID(r)
+	if err != nil {
+		return err
+	}
+
+	// Read request body.
+	update, err := request.ReadJSON[ListUpdate](r)
+	if err != nil {
+		return err
+	}
+
+	// Validate user input.
+	if err := validation.ValidateStruct(update,
+		validation.Field(&update.Name, validation.NilOrNotEmpty, validation.Length(0, 100)),
+		validation.Field(&update.Color, validation.Match(colorRegexp).Error("must be a hex color like #1e90ff")),
+		validation.Field(&update.Icon, validation.Length(0, 50)),
+		validation.Field(&update.Position, validation.Min(0)),
+	); err != nil {
+		if errs, ok := err.(validation.Errors); ok {
+			return response.ErrDataValidation(errs)
+		}
+		return err
+	}
+
+	err = h.repository.Update(r.Context(), id, update)
+	if err != nil {
+		return err
+	}
+
+	return response.WriteOK(w)
+}
+
+func (h *Handler) deleteList(w http.ResponseWriter, r *http.Request) error {
+	// Read request param "id".
+	id, err := request.ReadID(r)
+	if err != nil {
+		return err
+	}
+
+	// Read URL query.
+	opts, err := request.ReadURLQuery[DeleteOptions](r)
+	if err != nil {
+		return err
+	}
+	if opts.Mode == "" {
+		opts.Mode = DeleteModeInbox
+	}
+
+	// Validate user input.
+	if err := validation.ValidateStruct(opts,
+		validation.Field(&opts.Mode, validation.In(DeleteModeInbox, DeleteModeCascade)),
+	); err != nil {
+		if errs, ok := err.(validation.Errors); ok {
+			return response.ErrDataValidation(errs)
+		}
+		return err
+	}
+
+	err = h.repository.Delete(r.Context(), id, opts.Mode)
+	if err != nil {
+		return err
+	}
+
+	return response.WriteOK(w)
+}
@@ -0,0 +1,43 @@
+package list
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/guregu/null/v5"
+	"github.com/nathansiegfrid/todolist/pkg/field"
+)
+
+// Delete modes, deciding what happens to the todos of a deleted list.
+const (
+	DeleteModeInbox   = "inbox"   // Move todos to the inbox.
+	DeleteModeCascade = "cascade" // Delete todos with the list.
+)
+
+// List groups todos. Personal lists belong to their user, other lists belong to a workspace.
+type List struct {
+	ID          uuid.UUID     `json:"id"`
+	UserID      uuid.NullUUID `json:"user_id"`
+	WorkspaceID uuid.NullUUID `json:"workspace_id"`
+	Name        string        `json:"name"`
+	Color       null.String   `json:"color"`
+	Icon        null.String   `json:"icon"`
+	Position    int           `json:"position"`
+	CreatedAt   time.Time     `json:"created_at"`
+	UpdatedAt   time.Time     `json:"updated_at"`
+}
+
+type ListUpdate struct {
+	Name     field.Option[string]      `json:"name"`
+	Color    field.Option[null.String] `json:"color"`
+	Icon     field.Option[null.String] `json:"icon"`
+	Position field.Option[int]         `json:"position"`
+}
+
+type ListFilter struct {
+	WorkspaceID *uuid.NullUUID `schema:"workspace_id"`
+}
+
+type DeleteOptions struct {
+	Mode string `schema:"mode"`
+}
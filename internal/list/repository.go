@@ -0,0 +1,289 @@
+package list
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nathansiegfrid/todolist/internal/todo"
+	"github.com/nathansiegfrid/todolist/pkg/request"
+	"github.com/nathansiegfrid/todolist/pkg/response"
+)
+
+// visibleToUser is the condition for lists the user with ID $1 can read: their personal lists,
+// and lists in workspaces they're a member of.
+const visibleToUser = `(
+	(workspace_id IS NULL AND user_id = $1)
+	OR EXISTS (SELECT 1 FROM workspace_member m WHERE m.workspace_id = list.workspace_id AND m.user_id = $1)
+)`
+
+type Repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{db}
+}
+
+func (r *Repository) GetAll(ctx context.Context, filter *ListFilter) ([]*List, error) {
+	// Only return lists visible to the user.
+	where := []string{visibleToUser}
+	args, argIndex := []any{request.UserIDFromContext(ctx)}, 2
+
+	// Translate filter into WHERE conditions and args.
+	if v := filter.WorkspaceID; v != nil {
+		if !v.Valid {
+			where = append(where, "workspace_id IS NULL")
+		} else {
+			where = append(where, fmt.Sprintf("workspace_id = $%d", argIndex))
+			args = append(args, *v)
+			argIndex++
+		}
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, user_id, workspace_id, name, color, icon, position, created_at, updated_at
+		FROM list
+		WHERE `+strings.Join(where, " AND ")+`
+		ORDER BY workspace_id NULLS FIRST, position ASC, created_at ASC`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lists := []*List{}
+	for rows.Next() {
+		l := &List{}
+		err := rows.Scan(
+			&l.ID,
+			&l.UserID,
+			&l.WorkspaceID,
+			&l.Name,
+			&l.Color,
+			&l.Icon,
+			&l.Position,
+			&l.CreatedAt,
+			&l.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		lists = append(lists, l)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return lists, nil
+}
+
+func (r *Repository) Get(ctx context.Context, id uuid.UUID) (*List, error) {
+	// Lists not visible to the user are reported as not found to avoid leaking their existence.
+	l := &List{}
+	err := r.db.QueryRowContext(ctx, `
+		SELECT id, user_id, workspace_id, name, color, icon, position, created_at, updated_at
+		FROM list
+		WHERE id = $2 AND `+visibleToUser,
+		request.UserIDFromContext(ctx), id,
+	).Scan(
+		&l.ID,
+		&l.UserID,
+		&l.WorkspaceID,
+		&l.Name,
+		&l.Color,
+		&l.Icon,
+		&l.Position,
+		&l.CreatedAt,
+		&l.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, response.ErrIDNotFound("List", id)
+		}
+		return nil, err
+	}
+	return l, nil
+}
+
+// Create creates a personal list, or a list in l.WorkspaceID if set. The list is added after
+// the existing lists. Creating lists in a workspace requires editor role.
+func (r *Repository) Create(ctx context.Context, l *List) error {
+	l.ID = uuid.New()
+	l.UserID = uuid.NullUUID{}
+	if !l.WorkspaceID.Valid {
+		l.UserID = uuid.NullUUID{UUID: request.UserIDFromContext(ctx), Valid: true}
+	}
+	l.CreatedAt = time.Now()
+	l.UpdatedAt = l.CreatedAt
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if l.WorkspaceID.Valid {
+		err = checkWorkspaceEditor(ctx, tx, l.WorkspaceID.UUID)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO list (id, user_id, workspace_id, name, color, icon, position, created_at, updated_at)
+		SELECT $1, $2, $3, $4, $5, $6, COALESCE(MAX(position) + 1, 0), $7, $8
+		FROM list
+		WHERE user_id IS NOT DISTINCT FROM $2 AND workspace_id IS NOT DISTINCT FROM $3
+		RETURNING position`,
+		l.ID,
+		l.UserID,
+		l.WorkspaceID,
+		l.Name,
+		l.Color,
+		l.Icon,
+		l.CreatedAt,
+		l.UpdatedAt,
+	).Scan(&l.Position)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *Repository) Update(ctx context.Context, id uuid.UUID, update *ListUpdate) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	l, err := getListForUpdate(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+
+	l.Name = update.Name.ValueOr(l.Name)
+	l.Color = update.Color.ValueOr(l.Color)
+	l.Icon = update.Icon.ValueOr(l.Icon)
+	l.Position = update.Position.ValueOr(l.Position)
+	l.UpdatedAt = time.Now()
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE list
+		SET name = $2, color = $3, icon = $4, position = $5, updated_at = $6
+		WHERE id = $1`,
+		id,
+		l.Name,
+		l.Color,
+		l.Icon,
+		l.Position,
+		l.UpdatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Delete deletes the list. Depending on mode, its todos are moved to the inbox or deleted.
+func (r *Repository) Delete(ctx context.Context, id uuid.UUID, mode string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = getListForUpdate(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+
+	// Deleted todos change the subtask counts of their ancestors, and remaining todos change their list ID,
+	// so their ETags change.
+	if mode == DeleteModeCascade {
+		err = todo.BumpAncestorVersions(ctx, tx, "list_id = $1", id)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, "DELETE FROM todo WHERE list_id = $1", id)
+		if err != nil {
+			return err
+		}
+	} else {
+		err = todo.BumpVersions(ctx, tx, "list_id = $1", id)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Remaining todos are moved to the inbox by the foreign key.
+	_, err = tx.ExecContext(ctx, "DELETE FROM list WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// getListForUpdate locks the list and returns an error if the user from context can't change it.
+// Personal lists can only be changed by their user, workspace lists by editors and owners.
+func getListForUpdate(ctx context.Context, tx *sql.Tx, id uuid.UUID) (*List, error) {
+	l := &List{}
+	err := tx.QueryRowContext(ctx, `
+		SELECT id, user_id, workspace_id, name, color, icon, position, created_at, updated_at
+		FROM list
+		WHERE id = $2 AND `+visibleToUser+`
+		FOR UPDATE`,
+		request.UserIDFromContext(ctx), id,
+	).Scan(
+		&l.ID,
+		&l.UserID,
+		&l.WorkspaceID,
+		&l.Name,
+		&l.Color,
+		&l.Icon,
+		&l.Position,
+		&l.CreatedAt,
+		&l.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, response.ErrIDNotFound("List", id)
+		}
+		return nil, err
+	}
+
+	if l.WorkspaceID.Valid {
+		err = checkWorkspaceEditor(ctx, tx, l.WorkspaceID.UUID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// checkWorkspaceEditor returns an error if the user from context isn't an editor or owner of the workspace.
+func checkWorkspaceEditor(ctx context.Context, tx *sql.Tx, workspaceID uuid.UUID) error {
+	var role string
+	err := tx.QueryRowContext(ctx, `
+		SELECT role
+		FROM workspace_member
+		WHERE workspace_id = $1 AND user_id = $2`,
+		workspaceID, request.UserIDFromContext(ctx),
+	).Scan(&role)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return response.ErrIDNotFound("Workspace", workspaceID)
+		}
+		return err
+	}
+
+	if role == "viewer" {
+		return response.ErrPermission()
+	}
+	return nil
+}
@@ -0,0 +1,230 @@
+package reminder
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/guregu/null/v5"
+	"github.com/nathansiegfrid/todolist/pkg/notifier"
+)
+
+const (
+	batchSize   = 10
+	maxAttempts = 5
+
+	// deliveryTimeout bounds each delivery, so one in progress finishes within the graceful shutdown timeout.
+	deliveryTimeout = 10 * time.Second
+	// claimDuration is how long a claimed reminder is left to its worker. It's longer than a batch takes,
+	// and reminders of a worker that stopped without releasing them are claimed again after it.
+	claimDuration = 2 * time.Minute
+)
+
+// Worker sends due reminders. Multiple app instances can run it at the same time,
+// each reminder is claimed by one of them by setting "claimed_until".
+type Worker struct {
+	db       *sql.DB
+	notifier notifier.Notifier
+	interval time.Duration
+}
+
+func NewWorker(db *sql.DB, n notifier.Notifier, interval time.Duration) *Worker {
+	return &Worker{db, n, interval}
+}
+
+// Run polls for due reminders every interval until ctx is canceled. On shutdown, the delivery in progress
+// is finished and recorded, and the rest of the claimed batch is released for other workers.
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		for {
+			n, err := w.sendBatch(ctx)
+			if err != nil {
+				slog.Error(fmt.Sprintf("Reminder worker error: %s.", err), "category", "reminder")
+				break
+			}
+			if n < batchSize {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+type dueReminder struct {
+	id       uuid.UUID
+	todoID   uuid.UUID
+	userID   uuid.UUID
+	attempts int
+	email    string
+	subject  string
+	dueDate  null.Time
+	skip     string // Reason to not send the reminder, if any.
+}
+
+// sendBatch claims and sends up to batchSize due reminders, and returns how many were claimed.
+// The result of each delivery is recorded right after it, so a shutdown doesn't undo it.
+func (w *Worker) sendBatch(ctx context.Context) (int, error) {
+	if ctx.Err() != nil {
+		return 0, nil
+	}
+	reminders, err := w.claim(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	// Recording results isn't canceled on shutdown, so nothing delivered is sent again.
+	recordCtx := context.WithoutCancel(ctx)
+	for i, reminder := range reminders {
+		if ctx.Err() != nil {
+			return len(reminders), w.release(recordCtx, reminders[i:])
+		}
+		err := w.send(recordCtx, reminder)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(reminders), nil
+}
+
+// claim selects due reminders which aren't claimed by another worker, and claims them.
+func (w *Worker) claim(ctx context.Context) ([]*dueReminder, error) {
+	tx, err := w.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Reminders of users who lost access to the todo, e.g. by an unshare, are skipped.
+	rows, err := tx.QueryContext(ctx, `
+		SELECT r.id, r.todo_id, r.user_id, r.attempts, u.email, t.subject, t.due_date,
+			CASE
+				WHEN u.disabled_at IS NOT NULL THEN 'user disabled'
+				WHEN t.completed THEN 'todo completed'
+				WHEN NOT (
+					(t.workspace_id IS NULL AND t.user_id = r.user_id)
+					OR EXISTS (SELECT 1 FROM workspace_member m WHERE m.workspace_id = t.workspace_id AND m.user_id = r.user_id)
+					OR EXISTS (SELECT 1 FROM todo_share s WHERE s.todo_id = t.id AND s.user_id = r.user_id)
+				) THEN 'todo not accessible'
+				ELSE ''
+			END
+		FROM reminder r
+		JOIN todo t ON t.id = r.todo_id
+		JOIN "user" u ON u.id = r.user_id
+		WHERE r.fire_at <= NOW() AND r.sent_at IS NULL AND r.failed_at IS NULL
+			AND (r.claimed_until IS NULL OR r.claimed_until < NOW())
+		ORDER BY r.fire_at ASC
+		LIMIT $1
+		FOR UPDATE OF r SKIP LOCKED`,
+		batchSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reminders := []*dueReminder{}
+	for rows.Next() {
+		reminder := &dueReminder{}
+		err := rows.Scan(
+			&reminder.id,
+			&reminder.todoID,
+			&reminder.userID,
+			&reminder.attempts,
+			&reminder.email,
+			&reminder.subject,
+			&reminder.dueDate,
+			&reminder.skip,
+		)
+		if err != nil {
+			return nil, err
+		}
+		reminders = append(reminders, reminder)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	claimedUntil := time.Now().Add(claimDuration)
+	for _, reminder := range reminders {
+		_, err := tx.ExecContext(ctx, "UPDATE reminder SET claimed_until = $2 WHERE id = $1", reminder.id, claimedUntil)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return reminders, tx.Commit()
+}
+
+// release makes claimed reminders that weren't sent available to other workers.
+func (w *Worker) release(ctx context.Context, reminders []*dueReminder) error {
+	for _, reminder := range reminders {
+		_, err := w.db.ExecContext(ctx, "UPDATE reminder SET claimed_until = NULL WHERE id = $1", reminder.id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// send notifies the user and records the result. Failed deliveries are retried with backoff
+// by moving fire_at, up to maxAttempts times.
+func (w *Worker) send(ctx context.Context, reminder *dueReminder) error {
+	if reminder.skip != "" {
+		_, err := w.db.ExecContext(ctx,
+			"UPDATE reminder SET failed_at = NOW(), last_error = $2 WHERE id = $1",
+			reminder.id, reminder.skip,
+		)
+		return err
+	}
+
+	body := fmt.Sprintf("Reminder: %s", reminder.subject)
+	if reminder.dueDate.Valid {
+		body += fmt.Sprintf("\nDue: %s", reminder.dueDate.Time.UTC().Format(time.RFC1123))
+	}
+	deliveryCtx, cancel := context.WithTimeout(ctx, deliveryTimeout)
+	defer cancel()
+	err := w.notifier.Notify(deliveryCtx, &notifier.Notification{
+		Type:    "reminder",
+		UserID:  reminder.userID,
+		Email:   reminder.email,
+		Subject: fmt.Sprintf("Reminder: %s", reminder.subject),
+		Body:    body,
+		Data: map[string]any{
+			"reminder_id": reminder.id,
+			"todo_id":     reminder.todoID,
+			"due_date":    reminder.dueDate,
+		},
+	})
+	if err == nil {
+		_, err := w.db.ExecContext(ctx, "UPDATE reminder SET sent_at = NOW(), last_error = NULL WHERE id = $1", reminder.id)
+		return err
+	}
+
+	attempts := reminder.attempts + 1
+	slog.Warn(
+		fmt.Sprintf("Reminder %s delivery failed (attempt %d): %s.", reminder.id, attempts, err),
+		"category", "reminder",
+	)
+	if attempts >= maxAttempts {
+		_, err = w.db.ExecContext(ctx,
+			"UPDATE reminder SET attempts = $2, last_error = $3, failed_at = NOW() WHERE id = $1",
+			reminder.id, attempts, err.Error(),
+		)
+		return err
+	}
+	backoff := time.Duration(attempts*attempts) * time.Minute
+	_, err = w.db.ExecContext(ctx,
+		"UPDATE reminder SET attempts = $2, last_error = $3, fire_at = $4, claimed_until = NULL WHERE id = $1",
+		reminder.id, attempts, err.Error(), time.Now().Add(backoff),
+	)
+	return err
+}
@@ -12,21 +12,36 @@ import (
 )
 
 type Todo struct {
-	ID          uuid.UUID
-	UserID      uuid.NullUUID
-	Subject     string
-	Description string
-	Priority    int32
-	DueDate     sql.NullTime
-	Completed   bool
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
-}
-
-type User struct {
 	ID           uuid.UUID
-	Email        string
-	PasswordHash []byte
+	UserID       uuid.NullUUID
+	Subject      string
+	Description  string
+	Priority     int32
+	DueDate      sql.NullTime
+	Completed    bool
 	CreatedAt    time.Time
 	UpdatedAt    time.Time
+	WorkspaceID  uuid.NullUUID
+	ListID       uuid.NullUUID
+	ParentID     uuid.NullUUID
+	AutoComplete bool
+	Recurrence   sql.NullString
+	Timezone     sql.NullString
+	Search       interface{}
+	Rank         sql.NullString
+	Version      int32
+}
+
+type User struct {
+	ID            uuid.UUID
+	Email         string
+	PasswordHash  []byte
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	VerifiedAt    sql.NullTime
+	TotpSecret    []byte
+	TotpEnabledAt sql.NullTime
+	TotpLastStep  int64
+	Role          string
+	DisabledAt    sql.NullTime
 }
@@ -49,7 +49,7 @@ func (q *Queries) DeleteTodo(ctx context.Context, id uuid.UUID) (int64, error) {
 }
 
 const getAllTodos = `-- name: GetAllTodos :many
-SELECT id, user_id, subject, description, priority, due_date, completed, created_at, updated_at FROM todo
+SELECT id, user_id, subject, description, priority, due_date, completed, created_at, updated_at, workspace_id, list_id, parent_id, auto_complete, recurrence, timezone, search, rank, version FROM todo
 `
 
 func (q *Queries) GetAllTodos(ctx context.Context) ([]Todo, error) {
@@ -71,6 +71,15 @@ func (q *Queries) GetAllTodos(ctx context.Context) ([]Todo, error) {
 			&i.Completed,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.WorkspaceID,
+			&i.ListID,
+			&i.ParentID,
+			&i.AutoComplete,
+			&i.Recurrence,
+			&i.Timezone,
+			&i.Search,
+			&i.Rank,
+			&i.Version,
 		); err != nil {
 			return nil, err
 		}
@@ -86,7 +95,7 @@ func (q *Queries) GetAllTodos(ctx context.Context) ([]Todo, error) {
 }
 
 const getTodoByID = `-- name: GetTodoByID :one
-SELECT id, user_id, subject, description, priority, due_date, completed, created_at, updated_at FROM todo WHERE id = $1
+SELECT id, user_id, subject, description, priority, due_date, completed, created_at, updated_at, workspace_id, list_id, parent_id, auto_complete, recurrence, timezone, search, rank, version FROM todo WHERE id = $1
 `
 
 func (q *Queries) GetTodoByID(ctx context.Context, id uuid.UUID) (Todo, error) {
@@ -102,12 +111,21 @@ func (q *Queries) GetTodoByID(ctx context.Context, id uuid.UUID) (Todo, error) {
 		&i.Completed,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.WorkspaceID,
+		&i.ListID,
+		&i.ParentID,
+		&i.AutoComplete,
+		&i.Recurrence,
+		&i.Timezone,
+		&i.Search,
+		&i.Rank,
+		&i.Version,
 	)
 	return i, err
 }
 
 const getTodoByUserID = `-- name: GetTodoByUserID :many
-SELECT id, user_id, subject, description, priority, due_date, completed, created_at, updated_at FROM todo WHERE user_id = $1
+SELECT id, user_id, subject, description, priority, due_date, completed, created_at, updated_at, workspace_id, list_id, parent_id, auto_complete, recurrence, timezone, search, rank, version FROM todo WHERE user_id = $1
 `
 
 func (q *Queries) GetTodoByUserID(ctx context.Context, userID uuid.NullUUID) ([]Todo, error) {
@@ -129,6 +147,15 @@ func (q *Queries) GetTodoByUserID(ctx context.Context, userID uuid.NullUUID) ([]
 			&i.Completed,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.WorkspaceID,
+			&i.ListID,
+			&i.ParentID,
+			&i.AutoComplete,
+			&i.Recurrence,
+			&i.Timezone,
+			&i.Search,
+			&i.Rank,
+			&i.Version,
 		); err != nil {
 			return nil, err
 		}
@@ -151,7 +178,8 @@ SET user_id = $2,
     priority = $5,
     due_date = $6,
     completed = $7,
-    updated_at = NOW()
+    updated_at = NOW(),
+    version = version + 1
 WHERE id = $1
 `
 
@@ -41,7 +41,7 @@ func (q *Queries) DeleteUser(ctx context.Context, id uuid.UUID) (int64, error) {
 }
 
 const getAllUsers = `-- name: GetAllUsers :many
-SELECT id, email, password_hash, created_at, updated_at FROM "user"
+SELECT id, email, password_hash, created_at, updated_at, verified_at, totp_secret, totp_enabled_at, totp_last_step, role, disabled_at FROM "user"
 `
 
 func (q *Queries) GetAllUsers(ctx context.Context) ([]User, error) {
@@ -59,6 +59,12 @@ func (q *Queries) GetAllUsers(ctx context.Context) ([]User, error) {
 			&i.PasswordHash,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.VerifiedAt,
+			&i.TotpSecret,
+			&i.TotpEnabledAt,
+			&i.TotpLastStep,
+			&i.Role,
+			&i.DisabledAt,
 		); err != nil {
 			return nil, err
 		}
@@ -74,7 +80,7 @@ func (q *Queries) GetAllUsers(ctx context.Context) ([]User, error) {
 }
 
 const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id, email, password_hash, created_at, updated_at FROM "user" WHERE email = LOWER($1)
+SELECT id, email, password_hash, created_at, updated_at, verified_at, totp_secret, totp_enabled_at, totp_last_step, role, disabled_at FROM "user" WHERE email = LOWER($1)
 `
 
 func (q *Queries) GetUserByEmail(ctx context.Context, lower string) (User, error) {
@@ -86,12 +92,18 @@ func (q *Queries) GetUserByEmail(ctx context.Context, lower string) (User, error
 		&i.PasswordHash,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.VerifiedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.Role,
+		&i.DisabledAt,
 	)
 	return i, err
 }
 
 const getUserByID = `-- name: GetUserByID :one
-SELECT id, email, password_hash, created_at, updated_at FROM "user" WHERE id = $1
+SELECT id, email, password_hash, created_at, updated_at, verified_at, totp_secret, totp_enabled_at, totp_last_step, role, disabled_at FROM "user" WHERE id = $1
 `
 
 func (q *Queries) GetUserByID(ctx context.Context, id uuid.UUID) (User, error) {
@@ -103,6 +115,12 @@ func (q *Queries) GetUserByID(ctx context.Context, id uuid.UUID) (User, error) {
 		&i.PasswordHash,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.VerifiedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.Role,
+		&i.DisabledAt,
 	)
 	return i, err
 }
@@ -0,0 +1,147 @@
+package tag
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"regexp"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/google/uuid"
+	"github.com/nathansiegfrid/todolist/pkg/handler"
+	"github.com/nathansiegfrid/todolist/pkg/request"
+	"github.com/nathansiegfrid/todolist/pkg/response"
+)
+
+// Colors are hex RGB, e.g. "#1e90ff".
+var colorRegexp = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+type repository interface {
+	GetAll(ctx context.Context) ([]*Tag, error)
+	Get(ctx context.Context, id uuid.UUID) (*Tag, error)
+	Create(ctx context.Context, t *Tag) error
+	Update(ctx context.Context, id uuid.UUID, update *TagUpdate) error
+	Delete(ctx context.Context, id uuid.UUID) error
+}
+
+type Handler struct {
+	repository repository
+}
+
+func NewHandler(db *sql.DB) *Handler {
+	return &Handler{
+		repository: NewRepository(db),
+	}
+}
+
+func (h *Handler) HandleTagsRoute() http.HandlerFunc {
+	return handler.MethodHandler{
+		"GET":  handler.ErrorHandlerFunc(h.getAllTags),
+		"POST": handler.ErrorHandlerFunc(h.createTag),
+	}.HandlerFunc()
+}
+
+func (h *Handler) HandleTagsIDRoute() http.HandlerFunc {
+	return handler.MethodHandler{
+		"GET":    handler.ErrorHandlerFunc(h.getTag),
+		"PATCH":  handler.ErrorHandlerFunc(h.updateTag),
+		"DELETE": handler.ErrorHandlerFunc(h.deleteTag),
+	}.HandlerFunc()
+}
+
+func (h *Handler) getAllTags(w http.ResponseWriter, r *http.Request) error {
+	tags, err := h.repository.GetAll(r.Context())
+	if err != nil {
+		return err
+	}
+
+	return response.WriteJSON(w, tags)
+}
+
+func (h *Handler) getTag(w http.ResponseWriter, r *http.Request) error {
+	// Read request param "id".
+	id, err := request.ReadID(r)
+	if err != nil {
+		return err
+	}
+
+	t, err := h.repository.Get(r.Context(), id)
+	if err != nil {
+		return err
+	}
+
+	return response.WriteJSON(w, t)
+}
+
+func (h *Handler) createTag(w http.ResponseWriter, r *http.Request) error {
+	// Read request body.
+	t, err := request.ReadJSON[Tag](r)
+	if err != nil {
+		return err
+	}
+
+	// Validate user input.
+	if err := validation.ValidateStruct(t,
+		validation.Field(&t.Name, validation.Required, validation.Length(0, 50)),
+		validation.Field(&t.Color, validation.Match(colorRegexp).Error("must be a hex color like #1e90ff")),
+	); err != nil {
+		if errs, ok := err.(validation.Errors); ok {
+			return response.ErrDataValidation(errs)
+		}
+		return err
+	}
+
+	err = h.repository.Create(r.Context(), t)
+	if err != nil {
+		return err
+	}
+
+	return response.WriteJSON(w, t)
+}
+
+func (h *Handler) updateTag(w http.ResponseWriter, r *http.Request) error {
+	// Read request param "id".
+	id, err := request.ReadID(r)
+	if err != nil {
+		return err
+	}
+
+	// Read request body.
+	update, err := request.ReadJSON[TagUpdate](r)
+	if err != nil {
+		return err
+	}
+
+	// Validate user input.
+	if err := validation.ValidateStruct(update,
+		validation.Field(&update.Name, validation.NilOrNotEmpty, validation.Length(0, 50)),
+		validation.Field(&update.Color, validation.Match(colorRegexp).Error("must be a hex color like #1e90ff")),
+	); err != nil {
+		if errs, ok := err.(validation.Errors); ok {
+			return response.ErrDataValidation(errs)
+		}
+		return err
+	}
+
+	err = h.repository.Update(r.Context(), id, update)
+	if err != nil {
+		return err
+	}
+
+	return response.WriteOK(w)
+}
+
+func (h *Handler) deleteTag(w http.ResponseWriter, r *http.Request) error {
+	// Read request param "id".
+	id, err := request.ReadID(r)
+	if err != nil {
+		return err
+	}
+
+	err = h.repository.Delete(r.Context(), id)
+	if err != nil {
+		return err
+	}
+
+	return response.WriteOK(w)
+}
@@ -0,0 +1,24 @@
+package tag
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/guregu/null/v5"
+	"github.com/nathansiegfrid/todolist/pkg/field"
+)
+
+// Tag labels todos. Tags are personal to their user, and assigned to todos by name.
+type Tag struct {
+	ID        uuid.UUID   `json:"id"`
+	UserID    uuid.UUID   `json:"user_id"`
+	Name      string      `json:"name"`
+	Color     null.String `json:"color"`
+	CreatedAt time.Time   `json:"created_at"`
+	UpdatedAt time.Time   `json:"updated_at"`
+}
+
+type TagUpdate struct {
+	Name  field.Option[string]      `json:"name"`
+	Color field.Option[null.String] `json:"color"`
+}
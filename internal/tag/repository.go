@@ -0,0 +1,168 @@
+package tag
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nathansiegfrid/todolist/internal/todo"
+	"github.com/nathansiegfrid/todolist/pkg/postgres"
+	"github.com/nathansiegfrid/todolist/pkg/request"
+	"github.com/nathansiegfrid/todolist/pkg/response"
+)
+
+type Repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{db}
+}
+
+func (r *Repository) GetAll(ctx context.Context) ([]*Tag, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, user_id, name, color, created_at, updated_at
+		FROM tag
+		WHERE user_id = $1
+		ORDER BY name ASC`,
+		request.UserIDFromContext(ctx),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []*Tag{}
+	for rows.Next() {
+		t := &Tag{}
+		err := rows.Scan(&t.ID, &t.UserID, &t.Name, &t.Color, &t.CreatedAt, &t.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+func (r *Repository) Get(ctx context.Context, id uuid.UUID) (*Tag, error) {
+	t := &Tag{}
+	err := r.db.QueryRowContext(ctx, `
+		SELECT id, user_id, name, color, created_at, updated_at
+		FROM tag
+		WHERE id = $1 AND user_id = $2`,
+		id, request.UserIDFromContext(ctx),
+	).Scan(&t.ID, &t.UserID, &t.Name, &t.Color, &t.CreatedAt, &t.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, response.ErrIDNotFound("Tag", id)
+		}
+		return nil, err
+	}
+	return t, nil
+}
+
+func (r *Repository) Create(ctx context.Context, t *Tag) error {
+	t.ID = uuid.New()
+	t.UserID = request.UserIDFromContext(ctx)
+	t.CreatedAt = time.Now()
+	t.UpdatedAt = t.CreatedAt
+
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO tag (id, user_id, name, color, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		t.ID, t.UserID, t.Name, t.Color, t.CreatedAt, t.UpdatedAt,
+	)
+	if err != nil {
+		if postgres.IsUniqueViolation(err) {
+			return response.ErrConflict("Tag", t.Name)
+		}
+		return err
+	}
+	return nil
+}
+
+func (r *Repository) Update(ctx context.Context, id uuid.UUID, update *TagUpdate) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	t := &Tag{}
+	err = tx.QueryRowContext(ctx, `
+		SELECT name, color
+		FROM tag
+		WHERE id = $1 AND user_id = $2
+		FOR UPDATE`,
+		id, request.UserIDFromContext(ctx),
+	).Scan(&t.Name, &t.Color)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return response.ErrIDNotFound("Tag", id)
+		}
+		return err
+	}
+
+	t.Name = update.Name.ValueOr(t.Name)
+	t.Color = update.Color.ValueOr(t.Color)
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE tag
+		SET name = $2, color = $3, updated_at = NOW()
+		WHERE id = $1`,
+		id, t.Name, t.Color,
+	)
+	if err != nil {
+		if postgres.IsUniqueViolation(err) {
+			return response.ErrConflict("Tag", t.Name)
+		}
+		return err
+	}
+
+	// Tag names are part of the todos, so their ETags change.
+	err = todo.BumpVersions(ctx, tx, "id IN (SELECT todo_id FROM todo_tag WHERE tag_id = $1)", id)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Delete deletes the tag and removes it from all todos.
+func (r *Repository) Delete(ctx context.Context, id uuid.UUID) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Tag names are part of the todos, so their ETags change.
+	err = todo.BumpVersions(ctx, tx, `id IN (
+		SELECT tt.todo_id FROM todo_tag tt JOIN tag ON tag.id = tt.tag_id
+		WHERE tag.id = $1 AND tag.user_id = $2
+	)`, id, request.UserIDFromContext(ctx))
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx,
+		"DELETE FROM tag WHERE id = $1 AND user_id = $2",
+		id, request.UserIDFromContext(ctx),
+	)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return response.ErrIDNotFound("Tag", id)
+	}
+	return tx.Commit()
+}
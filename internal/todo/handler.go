@@ -3,30 +3,80 @@ package todo
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	"net/http"
+	"net/url"
+	"time"
 
 	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/go-ozzo/ozzo-validation/v4/is"
 	"github.com/google/uuid"
 	"github.com/nathansiegfrid/todolist/pkg/handler"
 	"github.com/nathansiegfrid/todolist/pkg/request"
 	"github.com/nathansiegfrid/todolist/pkg/response"
+	"github.com/nathansiegfrid/todolist/pkg/rrule"
+	"github.com/nathansiegfrid/todolist/pkg/token"
 )
 
+// validTags validates tag names. validation.Each doesn't read field.Option, so the value is unwrapped first.
+var validTags = validation.By(func(value any) error {
+	tags, isNil := validation.Indirect(value)
+	if isNil || tags == nil {
+		return nil
+	}
+	return validation.Validate(tags, validation.Length(0, 20), validation.Each(validation.Required, validation.Length(0, 50)))
+})
+
+// validRecurrence validates RRULE strings, see package rrule for the supported subset.
+var validRecurrence = validation.By(func(value any) error {
+	v, isNil := validation.Indirect(value)
+	if s, ok := v.(string); ok && !isNil {
+		if _, err := rrule.Parse(s); err != nil {
+			return validation.NewError("validation_rrule", "must be a valid RRULE: "+err.Error())
+		}
+	}
+	return nil
+})
+
+// validTimezone validates IANA timezone names, e.g. "Asia/Jakarta".
+var validTimezone = validation.By(func(value any) error {
+	v, isNil := validation.Indirect(value)
+	if s, ok := v.(string); ok && !isNil {
+		if _, err := time.LoadLocation(s); err != nil || s == "" || s == "Local" {
+			return validation.NewError("validation_timezone", "must be a valid IANA timezone")
+		}
+	}
+	return nil
+})
+
 type repository interface {
-	GetAll(ctx context.Context, filter *TodoFilter) ([]*Todo, error)
+	GetAll(ctx context.Context, filter *TodoFilter) ([]*Todo, *response.Page, error)
 	Get(ctx context.Context, id uuid.UUID) (*Todo, error)
 	Create(ctx context.Context, todo *Todo) error
-	Update(ctx context.Context, id uuid.UUID, update *TodoUpdate) error
-	Delete(ctx context.Context, id uuid.UUID) error
+	Update(ctx context.Context, id uuid.UUID, update *TodoUpdate, ifMatch request.ETags) error
+	Delete(ctx context.Context, id uuid.UUID, ifMatch request.ETags) error
+	GetSubtree(ctx context.Context, id uuid.UUID) (*Todo, error)
+	Move(ctx context.Context, id uuid.UUID, move *TodoMove) error
+	Batch(ctx context.Context, batch *TodoBatch) ([]*TodoBatchResult, error)
+	GetShares(ctx context.Context, todoID uuid.UUID) ([]*TodoShare, error)
+	PutShare(ctx context.Context, todoID uuid.UUID, share *TodoShare) error
+	DeleteShare(ctx context.Context, todoID uuid.UUID, userID uuid.UUID) error
+	GetReminders(ctx context.Context, todoID uuid.UUID) ([]*Reminder, error)
+	CreateReminder(ctx context.Context, todoID uuid.UUID, reminder *Reminder) error
+	DeleteReminder(ctx context.Context, todoID uuid.UUID, reminderID uuid.UUID) error
+}
+
+type Config struct {
+	Cursors *token.Signer // Signs pagination cursors.
 }
 
 type Handler struct {
 	repository repository
 }
 
-func NewHandler(db *sql.DB) *Handler {
+func NewHandler(db *sql.DB, config *Config) *Handler {
 	return &Handler{
-		repository: NewRepository(db),
+		repository: NewRepository(db, config.Cursors),
 	}
 }
 
@@ -37,6 +87,19 @@ func (h *Handler) HandleTodosRoute() http.HandlerFunc {
 	}.HandlerFunc()
 }
 
+func (h *Handler) HandleTodosBatchRoute() http.HandlerFunc {
+	return handler.MethodHandler{
+		"POST": handler.ErrorHandlerFunc(h.batchTodos),
+	}.HandlerFunc()
+}
+
+func (h *Handler) HandleWorkspacesIDTodosRoute() http.HandlerFunc {
+	return handler.MethodHandler{
+		"GET":  handler.ErrorHandlerFunc(h.getAllWorkspaceTodos),
+		"POST": handler.ErrorHandlerFunc(h.createWorkspaceTodo),
+	}.HandlerFunc()
+}
+
 func (h *Handler) HandleTodosIDRoute() http.HandlerFunc {
 	return handler.MethodHandler{
 		"GET":    handler.ErrorHandlerFunc(h.getTodo),
@@ -45,6 +108,50 @@ func (h *Handler) HandleTodosIDRoute() http.HandlerFunc {
 	}.HandlerFunc()
 }
 
+func (h *Handler) HandleTodosIDSubtreeRoute() http.HandlerFunc {
+	return handler.MethodHandler{
+		"GET": handler.ErrorHandlerFunc(h.getSubtree),
+	}.HandlerFunc()
+}
+
+func (h *Handler) HandleTodosIDMoveRoute() http.HandlerFunc {
+	return handler.MethodHandler{
+		"POST": handler.ErrorHandlerFunc(h.moveTodo),
+	}.HandlerFunc()
+}
+
+func (h *Handler) HandleTodosIDOccurrencesRoute() http.HandlerFunc {
+	return handler.MethodHandler{
+		"GET": handler.ErrorHandlerFunc(h.getOccurrences),
+	}.HandlerFunc()
+}
+
+func (h *Handler) HandleTodosIDSharesRoute() http.HandlerFunc {
+	return handler.MethodHandler{
+		"GET":  handler.ErrorHandlerFunc(h.getAllShares),
+		"POST": handler.ErrorHandlerFunc(h.putShare),
+	}.HandlerFunc()
+}
+
+func (h *Handler) HandleTodosIDSharesUserIDRoute() http.HandlerFunc {
+	return handler.MethodHandler{
+		"DELETE": handler.ErrorHandlerFunc(h.deleteShare),
+	}.HandlerFunc()
+}
+
+func (h *Handler) HandleTodosIDRemindersRoute() http.HandlerFunc {
+	return handler.MethodHandler{
+		"GET":  handler.ErrorHandlerFunc(h.getAllReminders),
+		"POST": handler.ErrorHandlerFunc(h.createReminder),
+	}.HandlerFunc()
+}
+
+func (h *Handler) HandleTodosIDRemindersReminderIDRoute() http.HandlerFunc {
+	return handler.MethodHandler{
+		"DELETE": handler.ErrorHandlerFunc(h.deleteReminder),
+	}.HandlerFunc()
+}
+
 func (h *Handler) getAllTodos(w http.ResponseWriter, r *http.Request) error {
 	// Read URL query.
 	filter, err := request.ReadURLQuery[TodoFilter](r)
@@ -52,12 +159,18 @@ func (h *Handler) getAllTodos(w http.ResponseWriter, r *http.Request) error {
 		return err
 	}
 
-	todos, err := h.repository.GetAll(r.Context(), filter)
+	todos, page, err := h.repository.GetAll(r.Context(), filter)
 	if err != nil {
 		return err
 	}
 
-	return response.WriteJSON(w, todos)
+	// Lists have no version, so the ETag is hashed from the page.
+	etag := response.WeakETag(todos, page)
+	if request.ReadIfNoneMatch(r).MatchWeak(etag) {
+		return response.WriteNotModified(w, etag)
+	}
+	w.Header().Set("ETag", etag)
+	return response.WritePage(w, r, todos, page)
 }
 
 func (h *Handler) getTodo(w http.ResponseWriter, r *http.Request) error {
@@ -72,20 +185,52 @@ func (h *Handler) getTodo(w http.ResponseWriter, r *http.Request) error {
 		return err
 	}
 
+	etag := todoETag(r.Context(), todo)
+	if request.ReadIfNoneMatch(r).MatchWeak(etag) {
+		return response.WriteNotModified(w, etag)
+	}
+	w.Header().Set("ETag", etag)
 	return response.WriteJSON(w, todo)
 }
 
-func (h *Handler) createTodo(w http.ResponseWriter, r *http.Request) error {
-	// Read request body.
-	todo, err := request.ReadJSON[Todo](r)
+func (h *Handler) getSubtree(w http.ResponseWriter, r *http.Request) error {
+	// Read request param "id".
+	id, err := request.ReadID(r)
+	if err != nil {
+		return err
+	}
+
+	todo, err := h.repository.GetSubtree(r.Context(), id)
+	if err != nil {
+		return err
+	}
+
+	return response.WriteJSON(w, todo)
+}
+
+func (h *Handler) getOccurrences(w http.ResponseWriter, r *http.Request) error {
+	type urlQuery struct {
+		Count int `schema:"count"`
+	}
+
+	// Read request param "id".
+	id, err := request.ReadID(r)
+	if err != nil {
+		return err
+	}
+
+	// Read URL query.
+	query, err := request.ReadURLQuery[urlQuery](r)
 	if err != nil {
 		return err
 	}
+	if query.Count == 0 {
+		query.Count = 10
+	}
 
 	// Validate user input.
-	if err := validation.ValidateStruct(todo,
-		validation.Field(&todo.Subject, validation.Required, validation.Length(0, 100)),
-		validation.Field(&todo.Description, validation.Length(0, 1000)),
+	if err := validation.ValidateStruct(query,
+		validation.Field(&query.Count, validation.Min(1), validation.Max(100)),
 	); err != nil {
 		if errs, ok := err.(validation.Errors); ok {
 			return response.ErrDataValidation(errs)
@@ -93,7 +238,81 @@ func (h *Handler) createTodo(w http.ResponseWriter, r *http.Request) error {
 		return err
 	}
 
-	err = h.repository.Create(r.Context(), todo)
+	todo, err := h.repository.Get(r.Context(), id)
+	if err != nil {
+		return err
+	}
+
+	occurrences, err := todo.Occurrences(query.Count)
+	if err != nil {
+		return err
+	}
+
+	return response.WriteJSON(w, occurrences)
+}
+
+func (h *Handler) getAllWorkspaceTodos(w http.ResponseWriter, r *http.Request) error {
+	// Read request param "id".
+	workspaceID, err := request.ReadID(r)
+	if err != nil {
+		return err
+	}
+
+	// Read URL query.
+	filter, err := request.ReadURLQuery[TodoFilter](r)
+	if err != nil {
+		return err
+	}
+	filter.WorkspaceID = &uuid.NullUUID{UUID: workspaceID, Valid: true}
+
+	todos, page, err := h.repository.GetAll(r.Context(), filter)
+	if err != nil {
+		return err
+	}
+
+	// Lists have no version, so the ETag is hashed from the page.
+	etag := response.WeakETag(todos, page)
+	if request.ReadIfNoneMatch(r).MatchWeak(etag) {
+		return response.WriteNotModified(w, etag)
+	}
+	w.Header().Set("ETag", etag)
+	return response.WritePage(w, r, todos, page)
+}
+
+func (h *Handler) createTodo(w http.ResponseWriter, r *http.Request) error {
+	// Read request body.
+	todo, err := request.ReadJSON[Todo](r)
+	if err != nil {
+		return err
+	}
+
+	return h.validateAndCreateTodo(w, r, todo)
+}
+
+func (h *Handler) createWorkspaceTodo(w http.ResponseWriter, r *http.Request) error {
+	// Read request param "id".
+	workspaceID, err := request.ReadID(r)
+	if err != nil {
+		return err
+	}
+
+	// Read request body.
+	todo, err := request.ReadJSON[Todo](r)
+	if err != nil {
+		return err
+	}
+	todo.WorkspaceID = uuid.NullUUID{UUID: workspaceID, Valid: true}
+
+	return h.validateAndCreateTodo(w, r, todo)
+}
+
+func (h *Handler) validateAndCreateTodo(w http.ResponseWriter, r *http.Request, todo *Todo) error {
+	// Validate user input.
+	if err := validateTodo(todo); err != nil {
+		return err
+	}
+
+	err := h.repository.Create(r.Context(), todo)
 	if err != nil {
 		return err
 	}
@@ -115,9 +334,42 @@ func (h *Handler) updateTodo(w http.ResponseWriter, r *http.Request) error {
 	}
 
 	// Validate user input.
-	if err := validation.ValidateStruct(update,
-		validation.Field(&update.Subject, validation.NilOrNotEmpty, validation.Length(0, 100)),
-		validation.Field(&update.Description, validation.Length(0, 1000)),
+	if err := validateTodoUpdate(update); err != nil {
+		return err
+	}
+
+	// Only update the version the client has read, if If-Match is set.
+	err = h.repository.Update(r.Context(), id, update, request.ReadIfMatch(r))
+	if err != nil {
+		return err
+	}
+
+	return response.WriteOK(w)
+}
+
+func (h *Handler) moveTodo(w http.ResponseWriter, r *http.Request) error {
+	// Read request param "id".
+	id, err := request.ReadID(r)
+	if err != nil {
+		return err
+	}
+
+	// Read request body.
+	move, err := request.ReadJSON[TodoMove](r)
+	if err != nil {
+		return err
+	}
+
+	// Validate user input. At least one neighbor is required.
+	notSelf := validation.By(func(value any) error {
+		if v, ok := value.(uuid.NullUUID); ok && v.Valid && v.UUID == id {
+			return validation.NewError("validation_move_self", "can't be the moved todo")
+		}
+		return nil
+	})
+	if err := validation.ValidateStruct(move,
+		validation.Field(&move.After, validation.Required.When(!move.Before.Valid).Error("either after or before is required"), notSelf),
+		validation.Field(&move.Before, notSelf),
 	); err != nil {
 		if errs, ok := err.(validation.Errors); ok {
 			return response.ErrDataValidation(errs)
@@ -125,7 +377,7 @@ func (h *Handler) updateTodo(w http.ResponseWriter, r *http.Request) error {
 		return err
 	}
 
-	err = h.repository.Update(r.Context(), id, update)
+	err = h.repository.Move(r.Context(), id, move)
 	if err != nil {
 		return err
 	}
@@ -140,10 +392,269 @@ func (h *Handler) deleteTodo(w http.ResponseWriter, r *http.Request) error {
 		return err
 	}
 
-	err = h.repository.Delete(r.Context(), id)
+	// Only delete the version the client has read, if If-Match is set.
+	err = h.repository.Delete(r.Context(), id, request.ReadIfMatch(r))
+	if err != nil {
+		return err
+	}
+
+	return response.WriteOK(w)
+}
+
+func (h *Handler) getAllShares(w http.ResponseWriter, r *http.Request) error {
+	// Read request param "id".
+	id, err := request.ReadID(r)
+	if err != nil {
+		return err
+	}
+
+	shares, err := h.repository.GetShares(r.Context(), id)
+	if err != nil {
+		return err
+	}
+
+	return response.WriteJSON(w, shares)
+}
+
+func (h *Handler) putShare(w http.ResponseWriter, r *http.Request) error {
+	// Read request param "id".
+	id, err := request.ReadID(r)
+	if err != nil {
+		return err
+	}
+
+	// Read request body.
+	share, err := request.ReadJSON[TodoShare](r)
+	if err != nil {
+		return err
+	}
+
+	// Validate user input.
+	if err := validation.ValidateStruct(share,
+		validation.Field(&share.Email, validation.Required, is.Email),
+		validation.Field(&share.Permission, validation.Required, validation.In(PermissionRead, PermissionWrite)),
+	); err != nil {
+		if errs, ok := err.(validation.Errors); ok {
+			return response.ErrDataValidation(errs)
+		}
+		return err
+	}
+
+	err = h.repository.PutShare(r.Context(), id, share)
+	if err != nil {
+		return err
+	}
+
+	return response.WriteJSON(w, share)
+}
+
+func (h *Handler) deleteShare(w http.ResponseWriter, r *http.Request) error {
+	// Read request params "id" and "user_id".
+	id, err := request.ReadID(r)
+	if err != nil {
+		return err
+	}
+	userID, err := request.ReadIDParam(r, "user_id")
+	if err != nil {
+		return err
+	}
+
+	err = h.repository.DeleteShare(r.Context(), id, userID)
 	if err != nil {
 		return err
 	}
 
 	return response.WriteOK(w)
 }
+
+func (h *Handler) getAllReminders(w http.ResponseWriter, r *http.Request) error {
+	// Read request param "id".
+	id, err := request.ReadID(r)
+	if err != nil {
+		return err
+	}
+
+	reminders, err := h.repository.GetReminders(r.Context(), id)
+	if err != nil {
+		return err
+	}
+
+	return response.WriteJSON(w, reminders)
+}
+
+func (h *Handler) createReminder(w http.ResponseWriter, r *http.Request) error {
+	// Read request param "id".
+	id, err := request.ReadID(r)
+	if err != nil {
+		return err
+	}
+
+	// Read request body.
+	reminder, err := request.ReadJSON[Reminder](r)
+	if err != nil {
+		return err
+	}
+
+	// Validate user input. Either remind_at or offset_minutes is required.
+	if err := validation.ValidateStruct(reminder,
+		validation.Field(&reminder.RemindAt,
+			validation.Required.When(!reminder.OffsetMinutes.Valid).Error("either remind_at or offset_minutes is required"),
+			validation.Nil.When(reminder.OffsetMinutes.Valid).Error("can't be used with offset_minutes"),
+			validation.Min(time.Now()).Error("must be in the future"),
+		),
+		validation.Field(&reminder.OffsetMinutes, validation.Min(0), validation.Max(366*24*60)),
+	); err != nil {
+		if errs, ok := err.(validation.Errors); ok {
+			return response.ErrDataValidation(errs)
+		}
+		return err
+	}
+
+	err = h.repository.CreateReminder(r.Context(), id, reminder)
+	if err != nil {
+		return err
+	}
+
+	return response.WriteJSON(w, reminder)
+}
+
+func (h *Handler) deleteReminder(w http.ResponseWriter, r *http.Request) error {
+	// Read request params "id" and "reminder_id".
+	id, err := request.ReadID(r)
+	if err != nil {
+		return err
+	}
+	reminderID, err := request.ReadIDParam(r, "reminder_id")
+	if err != nil {
+		return err
+	}
+
+	err = h.repository.DeleteReminder(r.Context(), id, reminderID)
+	if err != nil {
+		return err
+	}
+
+	return response.WriteOK(w)
+}
+
+func (h *Handler) batchTodos(w http.ResponseWriter, r *http.Request) error {
+	// Read request body.
+	batch, err := request.ReadJSON[TodoBatch](r)
+	if err != nil {
+		return err
+	}
+
+	// Validate user input. Either operations, or filter with action is required.
+	if batch.Mode == "" {
+		batch.Mode = BatchAtomic
+	}
+	if err := validation.ValidateStruct(batch,
+		validation.Field(&batch.Mode, validation.In(BatchAtomic, BatchBestEffort)),
+		validation.Field(&batch.Operations,
+			validation.Required.When(batch.Filter == nil).Error("either operations or filter is required"),
+			validation.Empty.When(batch.Filter != nil).Error("can't be used with filter"),
+			validation.Length(0, maxBatchSize),
+		),
+		validation.Field(&batch.Action, validation.Required.When(batch.Filter != nil)),
+	); err != nil {
+		if errs, ok := err.(validation.Errors); ok {
+			return response.ErrDataValidation(errs)
+		}
+		return err
+	}
+
+	// Null operations can't be reported in results, so they fail the whole batch.
+	nullErrs := validation.Errors{}
+	for i, op := range batch.Operations {
+		if op == nil {
+			nullErrs[fmt.Sprintf("operations[%d]", i)] = validation.ErrRequired
+		}
+	}
+	if len(nullErrs) > 0 {
+		return response.ErrDataValidation(nullErrs)
+	}
+
+	// Operations are validated one by one, so in best-effort mode invalid ones fail on their own.
+	for _, op := range batch.Operations {
+		op.err = validateTodoOperation(op)
+	}
+	if batch.Filter != nil {
+		values, err := url.ParseQuery(*batch.Filter)
+		if err != nil {
+			return response.Error(http.StatusBadRequest, "Invalid filter.")
+		}
+		batch.filter, err = request.DecodeURLQuery[TodoFilter](values)
+		if err != nil {
+			return err
+		}
+		if batch.Action.Op == OpCreate {
+			return response.Error(http.StatusBadRequest, "Action must be update or delete.")
+		}
+		if err := validateTodoOperation(batch.Action); err != nil {
+			return err
+		}
+	}
+
+	results, err := h.repository.Batch(r.Context(), batch)
+	if err != nil {
+		return err
+	}
+
+	return response.WriteJSON(w, results)
+}
+
+// validateTodo validates a new todo from user input.
+func validateTodo(todo *Todo) error {
+	if err := validation.ValidateStruct(todo,
+		validation.Field(&todo.Subject, validation.Required, validation.Length(0, 100)),
+		validation.Field(&todo.Description, validation.Length(0, 1000)),
+		validation.Field(&todo.Tags, validTags),
+		validation.Field(&todo.Recurrence, validRecurrence),
+		validation.Field(&todo.Timezone, validTimezone),
+	); err != nil {
+		if errs, ok := err.(validation.Errors); ok {
+			return response.ErrDataValidation(errs)
+		}
+		return err
+	}
+	return nil
+}
+
+// validateTodoUpdate validates a todo update from user input.
+func validateTodoUpdate(update *TodoUpdate) error {
+	if err := validation.ValidateStruct(update,
+		validation.Field(&update.Subject, validation.NilOrNotEmpty, validation.Length(0, 100)),
+		validation.Field(&update.Description, validation.Length(0, 1000)),
+		validation.Field(&update.Tags, validTags),
+		validation.Field(&update.Recurrence, validRecurrence),
+		validation.Field(&update.Timezone, validTimezone),
+	); err != nil {
+		if errs, ok := err.(validation.Errors); ok {
+			return response.ErrDataValidation(errs)
+		}
+		return err
+	}
+	return nil
+}
+
+// validateTodoOperation validates an operation of a batch, including its todo or update.
+func validateTodoOperation(op *TodoOperation) error {
+	if err := validation.ValidateStruct(op,
+		validation.Field(&op.Op, validation.Required, validation.In(OpCreate, OpUpdate, OpDelete)),
+		validation.Field(&op.Todo, validation.Required.When(op.Op == OpCreate), validation.Nil.When(op.Op != OpCreate)),
+		validation.Field(&op.Update, validation.Required.When(op.Op == OpUpdate), validation.Nil.When(op.Op != OpUpdate)),
+	); err != nil {
+		if errs, ok := err.(validation.Errors); ok {
+			return response.ErrDataValidation(errs)
+		}
+		return err
+	}
+
+	switch op.Op {
+	case OpCreate:
+		return validateTodo(op.Todo)
+	case OpUpdate:
+		return validateTodoUpdate(op.Update)
+	}
+	return nil
+}
@@ -6,6 +6,8 @@ import (
 	"github.com/google/uuid"
 	"github.com/guregu/null/v5"
 	"github.com/nathansiegfrid/todolist/pkg/field"
+	"github.com/nathansiegfrid/todolist/pkg/query"
+	"github.com/nathansiegfrid/todolist/pkg/rrule"
 )
 
 // Types in `guregu/null` package implements `json.Unmarshaler` and `encoding.TextUnmarshaler` interfaces.
@@ -14,6 +16,9 @@ import (
 type Todo struct {
 	ID          uuid.UUID     `json:"id"`
 	UserID      uuid.NullUUID `json:"user_id"`
+	WorkspaceID uuid.NullUUID `json:"workspace_id"`
+	ListID      uuid.NullUUID `json:"list_id"`
+	ParentID    uuid.NullUUID `json:"parent_id"`
 	Subject     string        `json:"subject"`
 	Description string        `json:"description"`
 	Priority    int           `json:"priority"`
@@ -21,22 +26,189 @@ type Todo struct {
 	Completed   bool          `json:"completed"`
 	CreatedAt   time.Time     `json:"created_at"`
 	UpdatedAt   time.Time     `json:"updated_at"`
+
+	// Recurrence is an RRULE like "FREQ=WEEKLY;BYDAY=MO". Completing a recurring todo creates a new todo
+	// due at the next occurrence, computed in Timezone (UTC if null).
+	Recurrence null.String `json:"recurrence"`
+	Timezone   null.String `json:"timezone"`
+
+	// Rank is the position of the todo in manual order, changed by moving it. Sort by "rank" to use it.
+	Rank null.String `json:"rank"`
+
+	// Version is incremented on every change, and returned as ETag. Send it as If-Match to update or delete
+	// the todo only if it wasn't changed since it was read.
+	Version int `json:"version"`
+
+	// Tags are names of the current user's tags. Other users' tags on the todo aren't visible.
+	Tags []string `json:"tags"`
+
+	// AutoComplete completes the todo when all its subtasks are completed.
+	AutoComplete      bool    `json:"auto_complete"`
+	SubtasksTotal     int     `json:"subtasks_total"`     // Computed, including nested subtasks.
+	SubtasksCompleted int     `json:"subtasks_completed"` // Computed, including nested subtasks.
+	Subtasks          []*Todo `json:"subtasks,omitempty"` // Only set by GetSubtree.
+
+	// SearchRank is the relevance of the todo to TodoFilter.Q, and Snippet the part of the todo matching it,
+	// with matches wrapped in <mark></mark>. Only set when searching.
+	SearchRank *float64 `json:"search_rank,omitempty"`
+	Snippet    *string  `json:"snippet,omitempty"`
 }
 
 type TodoUpdate struct {
-	Subject     field.Option[string]    `json:"subject"`
-	Description field.Option[string]    `json:"description"`
-	Priority    field.Option[int]       `json:"priority"`
-	DueDate     field.Option[null.Time] `json:"due_date"`
-	Completed   field.Option[bool]      `json:"completed"`
+	Subject      field.Option[string]        `json:"subject"`
+	Description  field.Option[string]        `json:"description"`
+	Priority     field.Option[int]           `json:"priority"`
+	DueDate      field.Option[null.Time]     `json:"due_date"`
+	Completed    field.Option[bool]          `json:"completed"`
+	ListID       field.Option[uuid.NullUUID] `json:"list_id"`
+	ParentID     field.Option[uuid.NullUUID] `json:"parent_id"`
+	AutoComplete field.Option[bool]          `json:"auto_complete"`
+	Tags         field.Option[[]string]      `json:"tags"`
+	Recurrence   field.Option[null.String]   `json:"recurrence"`
+	Timezone     field.Option[null.String]   `json:"timezone"`
+}
+
+// TodoMove is the new position of a todo, between the todos with IDs After and Before.
+// One of them can be null to move the todo right next to the other.
+type TodoMove struct {
+	After  uuid.NullUUID `json:"after"`
+	Before uuid.NullUUID `json:"before"`
+}
+
+// Operations of a batch.
+const (
+	OpCreate = "create"
+	OpUpdate = "update"
+	OpDelete = "delete"
+)
+
+// Modes of a batch. Both run in one transaction.
+const (
+	BatchAtomic     = "atomic"      // If an operation fails, none is applied.
+	BatchBestEffort = "best_effort" // If an operation fails, only it isn't applied.
+)
+
+// TodoBatch is a list of operations, or an action applied to all todos matching a filter.
+type TodoBatch struct {
+	Mode       string           `json:"mode"` // Defaults to BatchAtomic.
+	Operations []*TodoOperation `json:"operations"`
+
+	// Filter is a URL query like in GET /todos, e.g. "list_id=...&due_date[lt]=2024-01-01&completed=false".
+	Filter *string        `json:"filter"`
+	Action *TodoOperation `json:"action"` // Update or delete, without ID.
+	filter *TodoFilter
+}
+
+type TodoOperation struct {
+	Op     string      `json:"op"`
+	ID     uuid.UUID   `json:"id"`     // For update and delete.
+	Todo   *Todo       `json:"todo"`   // For create.
+	Update *TodoUpdate `json:"update"` // For update.
+	err    error       // Validation error, the operation fails without running.
+}
+
+// TodoBatchResult is the result of an operation, in the same order as the operations,
+// or the todos matching the filter.
+type TodoBatchResult struct {
+	ID      uuid.UUID `json:"id"`     // Also of created todos.
+	Status  int       `json:"status"` // HTTP status code, as if the operation was a single request.
+	Message string    `json:"message,omitempty"`
+	Data    any       `json:"data,omitempty"` // E.g. validation errors.
 }
 
 type TodoFilter struct {
-	ID        *uuid.UUID     `schema:"id"`
-	UserID    *uuid.NullUUID `schema:"user_id"`
-	Priority  *int           `schema:"priority"`
-	DueDate   *null.Time     `schema:"due_date"`
-	Completed *bool          `schema:"completed"`
-	Offset    int            `schema:"offset"`
-	Limit     int            `schema:"limit"`
+	ID           *uuid.UUID     `schema:"id"`
+	UserID       *uuid.NullUUID `schema:"user_id"`
+	WorkspaceID  *uuid.NullUUID `schema:"workspace_id"`
+	ListID       *uuid.NullUUID `schema:"list_id"`   // Null for todos in the inbox.
+	ParentID     *uuid.NullUUID `schema:"parent_id"` // Null for top-level todos.
+	Completed    *bool          `schema:"completed"`
+	Tag          []string       `schema:"tag"`      // Todos with any of the tags.
+	TagsAll      []string       `schema:"tags_all"` // Todos with all of the tags.
+	Q            string         `schema:"q"`        // Full-text search in subject and description.
+	Snippet      bool           `schema:"snippet"`  // Return highlighted snippets when searching.
+	Sort         string         `schema:"sort"`     // E.g. "-priority,due_date", "-" for descending.
+	Cursor       string         `schema:"cursor"`
+	Limit        int            `schema:"limit"` // Defaults to query.DefaultLimit, at most query.MaxLimit.
+	IncludeTotal bool           `schema:"include_total"`
+
+	// Filters with operators, e.g. "due_date[lt]=2024-01-01" or "priority[in]=1,2".
+	Subject     *query.Filter[string]    `schema:"subject"`
+	Description *query.Filter[string]    `schema:"description"`
+	Priority    *query.Filter[int]       `schema:"priority"`
+	DueDate     *query.Filter[time.Time] `schema:"due_date"` // Dates like "2024-01-01" compare the day only.
+	CreatedAt   *query.Filter[time.Time] `schema:"created_at"`
+	UpdatedAt   *query.Filter[time.Time] `schema:"updated_at"`
+}
+
+// Occurrences returns the next n due dates of a recurring todo, after its current due date.
+func (t *Todo) Occurrences(n int) ([]time.Time, error) {
+	rule, dueDate, err := t.recurrenceRule()
+	if err != nil {
+		return nil, err
+	}
+	occurrences := rule.Occurrences(dueDate, n+1)
+	if len(occurrences) == 0 {
+		return occurrences, nil // UNTIL is before the due date.
+	}
+	return occurrences[1:], nil
+}
+
+// nextOccurrence returns the recurrence and due date of the todo for the next occurrence,
+// or false if the recurrence has ended.
+func (t *Todo) nextOccurrence() (string, time.Time, bool, error) {
+	rule, dueDate, err := t.recurrenceRule()
+	if err != nil {
+		return "", time.Time{}, false, err
+	}
+	next, ok := rule.Next(dueDate)
+	if rule.Count > 0 {
+		rule.Count-- // COUNT includes the current occurrence.
+	}
+	return rule.String(), next, ok, nil
+}
+
+// recurrenceRule returns the parsed recurrence, and the due date in the timezone of the todo.
+func (t *Todo) recurrenceRule() (*rrule.Rule, time.Time, error) {
+	if !t.Recurrence.Valid || !t.DueDate.Valid {
+		return nil, time.Time{}, errNotRecurring
+	}
+	rule, err := rrule.Parse(t.Recurrence.String)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	loc, err := time.LoadLocation(t.Timezone.ValueOrZero())
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return rule, t.DueDate.Time.In(loc), nil
+}
+
+// Share permissions. PermissionWrite implies PermissionRead.
+const (
+	PermissionRead  = "read"
+	PermissionWrite = "write"
+)
+
+// TodoShare grants a user other than the owner access to a todo.
+type TodoShare struct {
+	TodoID     uuid.UUID `json:"todo_id"`
+	UserID     uuid.UUID `json:"user_id"`
+	Email      string    `json:"email"`
+	Permission string    `json:"permission"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// Reminder notifies its user about a todo, either at RemindAt, or OffsetMinutes before the due date.
+type Reminder struct {
+	ID            uuid.UUID `json:"id"`
+	TodoID        uuid.UUID `json:"todo_id"`
+	UserID        uuid.UUID `json:"user_id"`
+	RemindAt      null.Time `json:"remind_at"`
+	OffsetMinutes null.Int  `json:"offset_minutes"`
+	FireAt        null.Time `json:"fire_at"` // Computed, null if the todo has no due date.
+	SentAt        null.Time `json:"sent_at"`
+	FailedAt      null.Time `json:"failed_at"`
+	CreatedAt     time.Time `json:"created_at"`
 }
@@ -1,86 +1,187 @@
 package todo
 
 import (
+	"cmp"
 	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"html"
+	"net/http"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
+	"unicode"
 
 	"github.com/google/uuid"
+	"github.com/guregu/null/v5"
+	"github.com/nathansiegfrid/todolist/pkg/query"
+	"github.com/nathansiegfrid/todolist/pkg/rank"
 	"github.com/nathansiegfrid/todolist/pkg/request"
 	"github.com/nathansiegfrid/todolist/pkg/response"
+	"github.com/nathansiegfrid/todolist/pkg/token"
+	"github.com/samber/lo"
 )
 
 type Repository struct {
-	db *sql.DB
+	db      *sql.DB
+	cursors *token.Signer
 }
 
-func NewRepository(db *sql.DB) *Repository {
-	return &Repository{db}
-}
+// visibleToUser is the condition for todos the user with ID $1 can read: their personal todos,
+// todos shared with them, and todos in workspaces they're a member of.
+const visibleToUser = `(
+	(workspace_id IS NULL AND user_id = $1)
+	OR EXISTS (SELECT 1 FROM todo_share s WHERE s.todo_id = todo.id AND s.user_id = $1)
+	OR EXISTS (SELECT 1 FROM workspace_member m WHERE m.workspace_id = todo.workspace_id AND m.user_id = $1)
+)`
 
-func (r *Repository) GetAll(ctx context.Context, filter *TodoFilter) ([]*Todo, error) {
-	// Translate filter into WHERE conditions and args.
-	where, args, argIndex := []string{"TRUE"}, []any{}, 1
-	if v := filter.ID; v != nil {
-		where = append(where, fmt.Sprintf("id = $%d", argIndex))
-		args = append(args, *v)
-		argIndex++
-	}
-	if v := filter.UserID; v != nil {
-		where = append(where, fmt.Sprintf("user_id = $%d", argIndex))
-		args = append(args, *v)
-		argIndex++
+// subtaskVisibleToUser is visibleToUser for subtask c.
+const subtaskVisibleToUser = `(
+	(c.workspace_id IS NULL AND c.user_id = $1)
+	OR EXISTS (SELECT 1 FROM todo_share s WHERE s.todo_id = c.id AND s.user_id = $1)
+	OR EXISTS (SELECT 1 FROM workspace_member m WHERE m.workspace_id = c.workspace_id AND m.user_id = $1)
+)`
+
+// subtaskCounts joins the number of subtasks of the todo visible to the user with ID $1, and how many
+// of them are completed. Like in GetSubtree, subtasks of a hidden subtask aren't counted either.
+const subtaskCounts = `LEFT JOIN LATERAL (
+	WITH RECURSIVE subtask AS (
+		SELECT c.id, c.completed FROM todo c WHERE c.parent_id = todo.id AND ` + subtaskVisibleToUser + `
+		UNION ALL
+		SELECT c.id, c.completed FROM todo c JOIN subtask ON c.parent_id = subtask.id WHERE ` + subtaskVisibleToUser + `
+	)
+	SELECT COUNT(*) AS subtasks_total, COUNT(*) FILTER (WHERE subtask.completed) AS subtasks_completed
+	FROM subtask
+) subtasks ON TRUE`
+
+// Snippets are highlighted with private use characters, which are replaced with <mark></mark>
+// after escaping the snippet as HTML.
+const (
+	snippetStart   = "\ue000"
+	snippetStop    = "\ue001"
+	snippetOptions = "StartSel=" + snippetStart + ", StopSel=" + snippetStop + ", MaxFragments=2, MaxWords=20, MinWords=5"
+)
+
+// sortKeys are the fields todos can be sorted by with the sort param. IDs are always the last key,
+// so todos with equal fields have a stable order.
+var (
+	sortKeys = []query.SortKey{
+		{Name: "subject", Column: "subject", Type: "TEXT"},
+		{Name: "description", Column: "description", Type: "TEXT"},
+		{Name: "priority", Column: "priority", Type: "INT"},
+		{Name: "due_date", Column: "due_date", Type: "TIMESTAMPTZ", Nullable: true},
+		{Name: "completed", Column: "completed", Type: "BOOLEAN"},
+		{Name: "created_at", Column: "created_at", Type: "TIMESTAMPTZ"},
+		{Name: "updated_at", Column: "updated_at", Type: "TIMESTAMPTZ"},
+		{Name: "rank", Column: "rank", Type: "TEXT", Nullable: true},
 	}
-	if v := filter.Priority; v != nil {
-		where = append(where, fmt.Sprintf("priority = $%d", argIndex))
-		args = append(args, *v)
-		argIndex++
+	idSortKey = query.SortKey{Name: "id", Column: "id", Type: "UUID"}
+)
+
+// maxSearchWords is the maximum number of words in a search query. The rest are ignored.
+const maxSearchWords = 16
+
+// maxBatchSize is the maximum number of operations in a batch, or todos matching its filter.
+const maxBatchSize = 500
+
+// maxDepth is the maximum number of levels of a todo tree, including the top-level todo.
+const maxDepth = 5
+
+var (
+	errNotMember          = response.Error(http.StatusForbidden, "User is not a member of the workspace.")
+	errWorkspaceTodoShare = response.Error(http.StatusBadRequest, "Todos in a workspace are shared through workspace membership.")
+	errParentScope        = response.Error(http.StatusBadRequest, "Parent must belong to the same user or workspace as the todo.")
+	errParentCycle        = response.Error(http.StatusBadRequest, "Todo can't be a subtask of itself or its subtasks.")
+	errParentDepth        = response.Errorf(http.StatusBadRequest, "Subtasks can't be nested more than %d levels deep.", maxDepth)
+	errRecurrenceDueDate  = response.Error(http.StatusBadRequest, "Recurring todos must have a due date.")
+	errReminderDueDate    = response.Error(http.StatusBadRequest, "Todo must have a due date for reminders relative to it.")
+	errMoveScope          = response.Error(http.StatusBadRequest, "Todos can only be moved next to todos of the same user or workspace.")
+	errMoveOrder          = response.Error(http.StatusConflict, "Todo 'after' must be ranked before todo 'before'. Reload the todos and try again.")
+	errMoveConcurrent     = response.Error(http.StatusConflict, "Todo was moved to another user or workspace. Reload the todos and try again.")
+	errNotRecurring       = response.Error(http.StatusBadRequest, "Todo is not recurring.")
+	errListScope          = response.Error(http.StatusBadRequest, "List must belong to the same user or workspace as the todo.")
+	errBatchSize          = response.Errorf(http.StatusBadRequest, "Filter matches more than %d todos.", maxBatchSize)
+)
+
+func NewRepository(db *sql.DB, cursors *token.Signer) *Repository {
+	return &Repository{db, cursors}
+}
+
+func (r *Repository) GetAll(ctx context.Context, filter *TodoFilter) ([]*Todo, *response.Page, error) {
+	b, tsquery := todoConditions(ctx, filter)
+	searchRank, snippet := "NULL::REAL", "NULL::TEXT"
+	allowedSortKeys, defaultSort := sortKeys, "description"
+	if tsquery != "" {
+		// Search results can also be sorted by rank, which is the default.
+		searchRank = "TS_RANK(search, " + tsquery + ")"
+		allowedSortKeys = append(slices.Clone(sortKeys), query.SortKey{Name: "search_rank", Column: searchRank, Type: "REAL"})
+		defaultSort = "-search_rank," + defaultSort
 	}
-	if v := filter.DueDate; v != nil {
-		if !v.Valid {
-			where = append(where, "due_date IS NULL")
-		} else {
-			where = append(where, fmt.Sprintf("due_date::date = $%d::date", argIndex))
-			args = append(args, *v)
-			argIndex++
+	sort, err := query.ParseSort(cmp.Or(filter.Sort, defaultSort), allowedSortKeys, idSortKey)
+	if err != nil {
+		return nil, nil, response.ErrorResponse{
+			StatusCode: http.StatusBadRequest,
+			Message:    "Invalid URL query.",
+			Data:       map[string]string{"sort": err.Error()},
 		}
 	}
-	if v := filter.Completed; v != nil {
-		where = append(where, fmt.Sprintf("completed = $%d", argIndex))
-		args = append(args, *v)
-		argIndex++
+
+	// Count before adding the cursor condition, so the total includes all pages.
+	page := &response.Page{}
+	if filter.IncludeTotal {
+		var total int
+		err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM todo WHERE "+b.SQL(), b.Args()...).Scan(&total)
+		if err != nil {
+			return nil, nil, err
+		}
+		page.Total = &total
 	}
 
-	var limit, offset string
-	if filter.Limit > 0 {
-		limit = fmt.Sprintf(" LIMIT %d ", filter.Limit)
+	// Fingerprint the filters before adding the snippet options and the cursor condition, which aren't filters.
+	filters := b.Fingerprint()
+
+	// Snippet options are added after counting, which would fail on an unused arg.
+	if filter.Snippet && tsquery != "" {
+		snippet = fmt.Sprintf("TS_HEADLINE('english', subject || ' ' || description, %s, %s)", tsquery, b.Arg(snippetOptions))
 	}
-	if filter.Offset > 0 {
-		offset = fmt.Sprintf(" OFFSET %d ", filter.Offset)
+
+	cursor, err := query.DecodeCursor(r.cursors, sort, filters, filter.Cursor)
+	if err != nil {
+		return nil, nil, err
 	}
+	query.After(b, sort, cursor)
+	limit := query.Limit(filter.Limit)
 
 	rows, err := r.db.QueryContext(ctx, `
-		SELECT id, user_id, subject, description, priority, due_date, completed, created_at, updated_at
-		FROM todo
-		WHERE `+strings.Join(where, " AND ")+`
-		ORDER BY description ASC`+
-		limit+offset,
-		args...,
+		SELECT id, user_id, workspace_id, list_id, parent_id, auto_complete, recurrence, timezone, rank, version, subject, description, priority, due_date, completed, created_at, updated_at,
+			subtasks_total, subtasks_completed, `+searchRank+` AS search_rank, `+snippet+` AS snippet
+		FROM todo `+subtaskCounts+`
+		WHERE `+b.SQL()+`
+		ORDER BY `+sort.OrderBy(cursor)+`
+		LIMIT `+strconv.Itoa(limit+1),
+		b.Args()...,
 	)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	defer rows.Close()
 
-	var todos []*Todo
+	todos := []*Todo{}
 	for rows.Next() {
 		todo := &Todo{}
 		err := rows.Scan(
 			&todo.ID,
 			&todo.UserID,
+			&todo.WorkspaceID,
+			&todo.ListID,
+			&todo.ParentID,
+			&todo.AutoComplete,
+			&todo.Recurrence,
+			&todo.Timezone,
+			&todo.Rank,
+			&todo.Version,
 			&todo.Subject,
 			&todo.Description,
 			&todo.Priority,
@@ -88,27 +189,126 @@ func (r *Repository) GetAll(ctx context.Context, filter *TodoFilter) ([]*Todo, e
 			&todo.Completed,
 			&todo.CreatedAt,
 			&todo.UpdatedAt,
+			&todo.SubtasksTotal,
+			&todo.SubtasksCompleted,
+			&todo.SearchRank,
+			&todo.Snippet,
 		)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
+		}
+		if todo.Snippet != nil {
+			todo.Snippet = lo.ToPtr(highlight(*todo.Snippet))
 		}
 		todos = append(todos, todo)
 	}
-	return todos, nil
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	todos, next, prev := query.Paginate(todos, limit, cursor, func(todo *Todo) []any {
+		values := make([]any, len(sort))
+		for i, key := range sort {
+			values[i] = sortValue(todo, key.Name)
+		}
+		return values
+	})
+	page.NextCursor = query.EncodeCursor(r.cursors, sort, filters, next)
+	page.PrevCursor = query.EncodeCursor(r.cursors, sort, filters, prev)
+
+	err = r.loadTags(ctx, todos)
+	if err != nil {
+		return nil, nil, err
+	}
+	return todos, page, nil
+}
+
+// todoConditions returns the WHERE conditions of todos visible to the user and matching the filter,
+// and the tsquery expression if searching. Cursor, limit and sort of the filter are ignored.
+func todoConditions(ctx context.Context, filter *TodoFilter) (*query.Builder, string) {
+	// Only return todos visible to the user.
+	b := query.NewBuilder(request.UserIDFromContext(ctx))
+	b.Where(visibleToUser)
+
+	// Translate filter into WHERE conditions and args.
+	if v := filter.ID; v != nil {
+		b.Where("id = " + b.Arg(*v))
+	}
+	if v := filter.UserID; v != nil {
+		b.Where("user_id = " + b.Arg(*v))
+	}
+	if v := filter.WorkspaceID; v != nil {
+		if !v.Valid {
+			b.Where("workspace_id IS NULL")
+		} else {
+			b.Where("workspace_id = " + b.Arg(*v))
+		}
+	}
+	if v := filter.ListID; v != nil {
+		if !v.Valid {
+			b.Where("list_id IS NULL")
+		} else {
+			b.Where("list_id = " + b.Arg(*v))
+		}
+	}
+	if v := filter.ParentID; v != nil {
+		if !v.Valid {
+			b.Where("parent_id IS NULL")
+		} else {
+			b.Where("parent_id = " + b.Arg(*v))
+		}
+	}
+	if v := filter.Completed; v != nil {
+		b.Where("completed = " + b.Arg(*v))
+	}
+	query.Where(b, "subject", filter.Subject)
+	query.Where(b, "description", filter.Description)
+	query.Where(b, "priority", filter.Priority)
+	query.Where(b, "due_date", filter.DueDate)
+	query.Where(b, "created_at", filter.CreatedAt)
+	query.Where(b, "updated_at", filter.UpdatedAt)
+	if v := filter.Tag; len(v) > 0 {
+		b.Where(fmt.Sprintf(`EXISTS (
+			SELECT 1 FROM todo_tag tt JOIN tag ON tag.id = tt.tag_id
+			WHERE tt.todo_id = todo.id AND tag.user_id = $1 AND tag.name = ANY(%s)
+		)`, b.Arg(v)))
+	}
+	if v := lo.Uniq(filter.TagsAll); len(v) > 0 {
+		b.Where(fmt.Sprintf(`(
+			SELECT COUNT(*) FROM todo_tag tt JOIN tag ON tag.id = tt.tag_id
+			WHERE tt.todo_id = todo.id AND tag.user_id = $1 AND tag.name = ANY(%s)
+		) = %d`, b.Arg(v), len(v)))
+	}
+	var tsquery string
+	if v := searchQuery(filter.Q); v != "" {
+		tsquery = "TO_TSQUERY('english', " + b.Arg(v) + ")"
+		b.Where("search @@ " + tsquery)
+	}
+	return b, tsquery
 }
 
 func (r *Repository) Get(ctx context.Context, id uuid.UUID) (*Todo, error) {
+	// Todos not visible to the user are reported as not found to avoid leaking their existence.
 	row := r.db.QueryRowContext(ctx, `
-		SELECT id, user_id, subject, description, priority, due_date, completed, created_at, updated_at
-		FROM todo
-		WHERE id = $1`,
-		id,
+		SELECT id, user_id, workspace_id, list_id, parent_id, auto_complete, recurrence, timezone, rank, version, subject, description, priority, due_date, completed, created_at, updated_at,
+			subtasks_total, subtasks_completed
+		FROM todo `+subtaskCounts+`
+		WHERE id = $2 AND `+visibleToUser,
+		request.UserIDFromContext(ctx), id,
 	)
 
 	todo := &Todo{}
 	err := row.Scan(
 		&todo.ID,
 		&todo.UserID,
+		&todo.WorkspaceID,
+		&todo.ListID,
+		&todo.ParentID,
+		&todo.AutoComplete,
+		&todo.Recurrence,
+		&todo.Timezone,
+		&todo.Rank,
+		&todo.Version,
 		&todo.Subject,
 		&todo.Description,
 		&todo.Priority,
@@ -116,6 +316,8 @@ func (r *Repository) Get(ctx context.Context, id uuid.UUID) (*Todo, error) {
 		&todo.Completed,
 		&todo.CreatedAt,
 		&todo.UpdatedAt,
+		&todo.SubtasksTotal,
+		&todo.SubtasksCompleted,
 	)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -123,10 +325,31 @@ func (r *Repository) Get(ctx context.Context, id uuid.UUID) (*Todo, error) {
 		}
 		return nil, err
 	}
+
+	err = r.loadTags(ctx, []*Todo{todo})
+	if err != nil {
+		return nil, err
+	}
 	return todo, nil
 }
 
+// Create creates a personal todo, or a todo in todo.WorkspaceID if set. Creating todos in a workspace
+// requires editor role.
 func (r *Repository) Create(ctx context.Context, todo *Todo) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = createTodo(ctx, tx, todo)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func createTodo(ctx context.Context, tx *sql.Tx, todo *Todo) error {
 	userID := request.UserIDFromContext(ctx)
 	todo.UserID = uuid.NullUUID{
 		UUID:  userID,
@@ -134,14 +357,74 @@ func (r *Repository) Create(ctx context.Context, todo *Todo) error {
 	}
 
 	todo.ID = uuid.New()
+	todo.Rank = null.String{}
+	todo.Version = 1
 	todo.CreatedAt = time.Now()
 	todo.UpdatedAt = todo.CreatedAt
 
-	_, err := r.db.ExecContext(ctx, `
-		INSERT INTO todo (id, user_id, subject, description, priority, due_date, completed, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+	var err error
+	if todo.WorkspaceID.Valid {
+		err = checkWorkspacePermission(ctx, tx, todo.WorkspaceID.UUID, PermissionWrite)
+		if err != nil {
+			return err
+		}
+	}
+	err = checkList(ctx, tx, todo)
+	if err != nil {
+		return err
+	}
+	err = checkParent(ctx, tx, todo, 1)
+	if err != nil {
+		return err
+	}
+	if todo.Recurrence.Valid && !todo.DueDate.Valid {
+		return errRecurrenceDueDate
+	}
+
+	err = insertTodo(ctx, tx, todo)
+	if err != nil {
+		return err
+	}
+
+	if todo.Completed && todo.ParentID.Valid {
+		err = autoCompleteAncestors(ctx, tx, todo.ParentID.UUID)
+		if err != nil {
+			return err
+		}
+	}
+	if len(todo.Tags) > 0 {
+		err = setTags(ctx, tx, todo.ID, todo.Tags)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// insertTodo inserts the todo, ranked last if it has no rank.
+func insertTodo(ctx context.Context, tx *sql.Tx, todo *Todo) error {
+	if !todo.Rank.Valid {
+		scope, arg := rankScope(todo)
+		var last null.String
+		err := tx.QueryRowContext(ctx, "SELECT MAX(rank) FROM todo WHERE "+scope, arg).Scan(&last)
+		if err != nil {
+			return err
+		}
+		todo.Rank = null.StringFrom(rank.Between(last.ValueOrZero(), ""))
+	}
+
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO todo (id, user_id, workspace_id, list_id, parent_id, auto_complete, recurrence, timezone, rank, subject, description, priority, due_date, completed, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)`,
 		todo.ID,
 		todo.UserID,
+		todo.WorkspaceID,
+		todo.ListID,
+		todo.ParentID,
+		todo.AutoComplete,
+		todo.Recurrence,
+		todo.Timezone,
+		todo.Rank,
 		todo.Subject,
 		todo.Description,
 		todo.Priority,
@@ -150,42 +433,174 @@ func (r *Repository) Create(ctx context.Context, todo *Todo) error {
 		todo.CreatedAt,
 		todo.UpdatedAt,
 	)
-	return err
+	if err != nil {
+		return err
+	}
+
+	if todo.ParentID.Valid {
+		return BumpAncestorVersions(ctx, tx, "id = $1", todo.ParentID.UUID)
+	}
+	return nil
 }
 
-func (r *Repository) Update(ctx context.Context, id uuid.UUID, update *TodoUpdate) error {
+// Update updates the todo. If ifMatch isn't nil, it must match the ETag of the todo.
+func (r *Repository) Update(ctx context.Context, id uuid.UUID, update *TodoUpdate, ifMatch request.ETags) error {
 	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
 
-	err = updateTodo(ctx, tx, id, update)
+	err = updateTodo(ctx, tx, id, update, ifMatch)
 	if err != nil {
 		return err
 	}
 	return tx.Commit()
 }
 
-func (r *Repository) Delete(ctx context.Context, id uuid.UUID) error {
+// Delete deletes the todo with its subtasks. If ifMatch isn't nil, it must match the ETag of the todo.
+func (r *Repository) Delete(ctx context.Context, id uuid.UUID, ifMatch request.ETags) error {
 	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
 
-	err = deleteTodo(ctx, tx, id)
+	err = deleteTodo(ctx, tx, id, ifMatch)
 	if err != nil {
 		return err
 	}
 	return tx.Commit()
 }
 
+// Batch runs the operations of the batch, or its action on all todos matching its filter, in one transaction.
+// In atomic mode, the first failed operation rolls back the batch and its error is returned with the results.
+// In best-effort mode, each operation runs in a savepoint, so a failed one is rolled back alone.
+// Unexpected errors always fail the whole batch.
+func (r *Repository) Batch(ctx context.Context, batch *TodoBatch) ([]*TodoBatchResult, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	ops := batch.Operations
+	if batch.filter != nil {
+		ops, err = filterOperations(ctx, tx, batch.filter, batch.Action)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	results := make([]*TodoBatchResult, len(ops))
+	for i, op := range ops {
+		if batch.Mode == BatchBestEffort {
+			if _, err := tx.ExecContext(ctx, "SAVEPOINT batch_operation"); err != nil {
+				return nil, err
+			}
+		}
+
+		err := op.err
+		if err == nil {
+			err = runOperation(ctx, tx, op)
+		}
+		res := response.ErrorResponseFrom(err)
+		if err != nil && res.StatusCode >= http.StatusInternalServerError {
+			return nil, err
+		}
+
+		results[i] = &TodoBatchResult{ID: op.ID, Status: http.StatusOK}
+		if err != nil {
+			results[i] = &TodoBatchResult{ID: op.ID, Status: res.StatusCode, Message: res.Message, Data: res.Data}
+		}
+
+		switch {
+		case err != nil && batch.Mode == BatchAtomic:
+			for j := i + 1; j < len(ops); j++ {
+				results[j] = &TodoBatchResult{ID: ops[j].ID, Status: http.StatusFailedDependency, Message: "Not applied."}
+			}
+			for j := range i {
+				results[j].Status, results[j].Message = http.StatusFailedDependency, "Not applied."
+			}
+			return nil, response.ErrorResponse{
+				StatusCode: res.StatusCode,
+				Message:    fmt.Sprintf("Operation at index %d failed, no operations were applied.", i),
+				Data:       results,
+			}
+		case err != nil:
+			_, err = tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT batch_operation")
+		case batch.Mode == BatchBestEffort:
+			_, err = tx.ExecContext(ctx, "RELEASE SAVEPOINT batch_operation")
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return results, tx.Commit()
+}
+
+func runOperation(ctx context.Context, tx *sql.Tx, op *TodoOperation) error {
+	switch op.Op {
+	case OpCreate:
+		err := createTodo(ctx, tx, op.Todo)
+		if err != nil {
+			return err
+		}
+		op.ID = op.Todo.ID
+		return nil
+	case OpUpdate:
+		return updateTodo(ctx, tx, op.ID, op.Update, nil)
+	case OpDelete:
+		return deleteTodo(ctx, tx, op.ID, nil)
+	}
+	return fmt.Errorf("unknown batch operation '%s'", op.Op)
+}
+
+// filterOperations returns the action as an operation on each todo visible to the user and matching the filter.
+// Subtasks come before their parents, so deleting a parent doesn't delete them before their own operations.
+func filterOperations(ctx context.Context, tx *sql.Tx, filter *TodoFilter, action *TodoOperation) ([]*TodoOperation, error) {
+	b, _ := todoConditions(ctx, filter)
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id FROM todo
+		WHERE `+b.SQL()+`
+		ORDER BY (
+			WITH RECURSIVE ancestor AS (
+				SELECT a.parent_id FROM todo a WHERE a.id = todo.id
+				UNION ALL
+				SELECT a.parent_id FROM todo a JOIN ancestor ON a.id = ancestor.parent_id
+			)
+			SELECT COUNT(*) FROM ancestor WHERE parent_id IS NOT NULL
+		) DESC, id ASC
+		LIMIT `+b.Arg(maxBatchSize+1),
+		b.Args()...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ops := []*TodoOperation{}
+	for rows.Next() {
+		op := *action
+		if err := rows.Scan(&op.ID); err != nil {
+			return nil, err
+		}
+		ops = append(ops, &op)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(ops) > maxBatchSize {
+		return nil, errBatchSize
+	}
+	return ops, nil
+}
+
 func getTodoForUpdate(ctx context.Context, tx *sql.Tx, id uuid.UUID) (*Todo, error) {
 	// FOR UPDATE will lock selected row, which prevents new writes and locks to the same row
 	// before current Tx is done.
 	row := tx.QueryRowContext(ctx, `
-		SELECT id, user_id, subject, description, priority, due_date, completed, created_at, updated_at
+		SELECT id, user_id, workspace_id, list_id, parent_id, auto_complete, recurrence, timezone, rank, version, subject, description, priority, due_date, completed, created_at, updated_at
 		FROM todo
 		WHERE id = $1
 		FOR UPDATE`,
@@ -196,6 +611,14 @@ func getTodoForUpdate(ctx context.Context, tx *sql.Tx, id uuid.UUID) (*Todo, err
 	err := row.Scan(
 		&todo.ID,
 		&todo.UserID,
+		&todo.WorkspaceID,
+		&todo.ListID,
+		&todo.ParentID,
+		&todo.AutoComplete,
+		&todo.Recurrence,
+		&todo.Timezone,
+		&todo.Rank,
+		&todo.Version,
 		&todo.Subject,
 		&todo.Description,
 		&todo.Priority,
@@ -213,30 +636,117 @@ func getTodoForUpdate(ctx context.Context, tx *sql.Tx, id uuid.UUID) (*Todo, err
 	return todo, nil
 }
 
-func updateTodo(ctx context.Context, tx *sql.Tx, id uuid.UUID, update *TodoUpdate) error {
-	todo, err := getTodoForUpdate(ctx, tx, id)
+// checkPermission returns an error if the user from context is neither the owner of the todo,
+// nor a member of its workspace with the requested permission, nor has a share granting it.
+// Users who can't see the todo get the same 404 as Get, so they can't tell which todo IDs exist.
+func checkPermission(ctx context.Context, tx *sql.Tx, todo *Todo, permission string) error {
+	userID := request.UserIDFromContext(ctx)
+	if userID == uuid.Nil {
+		return response.ErrPermission()
+	}
+	if todo.WorkspaceID.Valid {
+		err := checkWorkspacePermission(ctx, tx, todo.WorkspaceID.UUID, permission)
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, errNotMember) {
+			return err
+		}
+	} else if todo.UserID.Valid && todo.UserID.UUID == userID {
+		return nil
+	}
+
+	var granted string
+	err := tx.QueryRowContext(ctx, `
+		SELECT permission
+		FROM todo_share
+		WHERE todo_id = $1 AND user_id = $2`,
+		todo.ID, userID,
+	).Scan(&granted)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return response.ErrIDNotFound("Todo", todo.ID)
+		}
 		return err
 	}
 
-	// Check if resource is owned by user.
-	userID := request.UserIDFromContext(ctx)
-	if userID == uuid.Nil || todo.UserID.UUID != userID {
+	if permission == PermissionWrite && granted != PermissionWrite {
 		return response.ErrPermission()
 	}
+	return nil
+}
+
+func updateTodo(ctx context.Context, tx *sql.Tx, id uuid.UUID, update *TodoUpdate, ifMatch request.ETags) error {
+	todo, err := getTodoForUpdate(ctx, tx, id)
+	if err != nil {
+		return err
+	}
 
+	// Check if user owns the resource or has been granted write access.
+	err = checkPermission(ctx, tx, todo, PermissionWrite)
+	if err != nil {
+		return err
+	}
+
+	// Check if the todo wasn't changed since the client read it. The row is locked, so it can't change after this.
+	if ifMatch != nil && !ifMatch.Match(todoETag(ctx, todo)) {
+		return response.ErrPreconditionFailed("Todo")
+	}
+
+	wasCompleted, oldParentID := todo.Completed, todo.ParentID
 	todo.Subject = update.Subject.ValueOr(todo.Subject)
 	todo.Description = update.Description.ValueOr(todo.Description)
 	todo.Priority = update.Priority.ValueOr(todo.Priority)
 	todo.DueDate = update.DueDate.ValueOr(todo.DueDate)
 	todo.Completed = update.Completed.ValueOr(todo.Completed)
+	todo.ListID = update.ListID.ValueOr(todo.ListID)
+	todo.ParentID = update.ParentID.ValueOr(todo.ParentID)
+	todo.AutoComplete = update.AutoComplete.ValueOr(todo.AutoComplete)
+	todo.Recurrence = update.Recurrence.ValueOr(todo.Recurrence)
+	todo.Timezone = update.Timezone.ValueOr(todo.Timezone)
 	todo.UpdatedAt = time.Now()
 
+	if todo.Recurrence.Valid && !todo.DueDate.Valid {
+		return errRecurrenceDueDate
+	}
+	// Completing a recurring todo moves the recurrence to a new todo for the next occurrence.
+	var next *Todo
+	if todo.Completed && !wasCompleted && todo.Recurrence.Valid {
+		next, err = nextOccurrence(todo)
+		if err != nil {
+			return err
+		}
+		todo.Recurrence = null.String{}
+	}
+
+	if update.ListID.Defined() {
+		err = checkList(ctx, tx, todo)
+		if err != nil {
+			return err
+		}
+	}
+	if update.ParentID.Defined() {
+		height, err := subtreeHeight(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		err = checkParent(ctx, tx, todo, height)
+		if err != nil {
+			return err
+		}
+	}
+
 	result, err := tx.ExecContext(ctx, `
 		UPDATE todo
-		SET subject = $2, description = $3, priority = $4, due_date = $5, completed = $6, updated_at = $7
+		SET list_id = $2, parent_id = $3, auto_complete = $4, recurrence = $5, timezone = $6, subject = $7,
+			description = $8, priority = $9, due_date = $10, completed = $11, updated_at = $12, version = version + 1
 		WHERE id = $1`,
 		id,
+		todo.ListID,
+		todo.ParentID,
+		todo.AutoComplete,
+		todo.Recurrence,
+		todo.Timezone,
 		todo.Subject,
 		todo.Description,
 		todo.Priority,
@@ -255,19 +765,66 @@ func updateTodo(ctx context.Context, tx *sql.Tx, id uuid.UUID, update *TodoUpdat
 	if rowsAffected == 0 {
 		return response.ErrIDNotFound("Todo", id)
 	}
+
+	if todo.ParentID != oldParentID || todo.Completed != wasCompleted {
+		for _, parentID := range lo.Uniq([]uuid.NullUUID{oldParentID, todo.ParentID}) {
+			if !parentID.Valid {
+				continue
+			}
+			err = BumpAncestorVersions(ctx, tx, "id = $1", parentID.UUID)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if update.DueDate.Defined() {
+		err = rescheduleReminders(ctx, tx, id, todo.DueDate)
+		if err != nil {
+			return err
+		}
+	}
+	if update.Tags.Defined() {
+		err = setTags(ctx, tx, id, update.Tags.ValueOrZero())
+		if err != nil {
+			return err
+		}
+	}
+	if next != nil {
+		err = createOccurrence(ctx, tx, id, next)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Completing a subtask, or enabling auto-complete on a todo with completed subtasks,
+	// may complete the todo and its ancestors.
+	if update.AutoComplete.ValueOrZero() {
+		err = autoCompleteAncestors(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+	}
+	if todo.Completed && todo.ParentID.Valid && (update.Completed.Defined() || update.ParentID.Defined()) {
+		return autoCompleteAncestors(ctx, tx, todo.ParentID.UUID)
+	}
 	return nil
 }
 
-func deleteTodo(ctx context.Context, tx *sql.Tx, id uuid.UUID) error {
+func deleteTodo(ctx context.Context, tx *sql.Tx, id uuid.UUID, ifMatch request.ETags) error {
 	todo, err := getTodoForUpdate(ctx, tx, id)
 	if err != nil {
 		return err
 	}
 
-	// Check if resource is owned by user.
-	userID := request.UserIDFromContext(ctx)
-	if userID == uuid.Nil || todo.UserID.UUID != userID {
-		return response.ErrPermission()
+	// Check if user owns the resource or has been granted write access.
+	err = checkPermission(ctx, tx, todo, PermissionWrite)
+	if err != nil {
+		return err
+	}
+
+	// Check if the todo wasn't changed since the client read it. The row is locked, so it can't change after this.
+	if ifMatch != nil && !ifMatch.Match(todoETag(ctx, todo)) {
+		return response.ErrPreconditionFailed("Todo")
 	}
 
 	result, err := tx.ExecContext(ctx, "DELETE FROM todo WHERE id = $1", id)
@@ -280,7 +837,911 @@ func deleteTodo(ctx context.Context, tx *sql.Tx, id uuid.UUID) error {
 		return err
 	}
 	if rowsAffected == 0 {
-		return response.ErrIDNotFound("Task", id)
+		return response.ErrIDNotFound("Todo", id)
+	}
+
+	if todo.ParentID.Valid {
+		return BumpAncestorVersions(ctx, tx, "id = $1", todo.ParentID.UUID)
 	}
 	return nil
 }
+
+func (r *Repository) GetShares(ctx context.Context, todoID uuid.UUID) ([]*TodoShare, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	err = checkOwner(ctx, tx, todoID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT s.todo_id, s.user_id, u.email, s.permission, s.created_at, s.updated_at
+		FROM todo_share s
+		JOIN "user" u ON u.id = s.user_id
+		WHERE s.todo_id = $1
+		ORDER BY u.email ASC`,
+		todoID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var shares []*TodoShare
+	for rows.Next() {
+		share := &TodoShare{}
+		err := rows.Scan(
+			&share.TodoID,
+			&share.UserID,
+			&share.Email,
+			&share.Permission,
+			&share.CreatedAt,
+			&share.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		shares = append(shares, share)
+	}
+	return shares, tx.Commit()
+}
+
+// PutShare grants the user with share.Email access to the todo, or changes the permission
+// of an existing share. Only the owner of the todo can share it.
+func (r *Repository) PutShare(ctx context.Context, todoID uuid.UUID, share *TodoShare) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = checkOwner(ctx, tx, todoID)
+	if err != nil {
+		return err
+	}
+
+	err = tx.QueryRowContext(ctx, `SELECT id, email FROM "user" WHERE email = LOWER($1)`, share.Email).
+		Scan(&share.UserID, &share.Email)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return response.Errorf(http.StatusNotFound, "User with email '%s' not found.", share.Email)
+		}
+		return err
+	}
+	if share.UserID == request.UserIDFromContext(ctx) {
+		return response.Error(http.StatusBadRequest, "Cannot share a todo with its owner.")
+	}
+
+	share.TodoID = todoID
+	share.CreatedAt = time.Now()
+	share.UpdatedAt = share.CreatedAt
+
+	// Existing share keeps its creation time, only the permission is changed.
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO todo_share (todo_id, user_id, permission, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (todo_id, user_id) DO UPDATE
+		SET permission = EXCLUDED.permission, updated_at = EXCLUDED.updated_at
+		RETURNING created_at`,
+		share.TodoID,
+		share.UserID,
+		share.Permission,
+		share.CreatedAt,
+		share.UpdatedAt,
+	).Scan(&share.CreatedAt)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DeleteShare revokes a share. It can be done by the owner of the todo,
+// or by the user the todo is shared with.
+func (r *Repository) DeleteShare(ctx context.Context, todoID uuid.UUID, userID uuid.UUID) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if userID != request.UserIDFromContext(ctx) {
+		err = checkOwner(ctx, tx, todoID)
+		if err != nil {
+			return err
+		}
+	}
+
+	result, err := tx.ExecContext(ctx, "DELETE FROM todo_share WHERE todo_id = $1 AND user_id = $2", todoID, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return response.Errorf(http.StatusNotFound, "Todo with ID '%s' is not shared with user '%s'.", todoID, userID)
+	}
+	return tx.Commit()
+}
+
+// checkOwner locks the todo and returns an error if the user from context doesn't own it.
+// Todos in a workspace have no owner, they're shared through workspace membership.
+func checkOwner(ctx context.Context, tx *sql.Tx, id uuid.UUID) error {
+	todo, err := getTodoForUpdate(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+	// Users who can't see the todo get 404.
+	err = checkPermission(ctx, tx, todo, PermissionRead)
+	if err != nil {
+		return err
+	}
+	if todo.WorkspaceID.Valid {
+		return errWorkspaceTodoShare
+	}
+
+	userID := request.UserIDFromContext(ctx)
+	if userID == uuid.Nil || !todo.UserID.Valid || todo.UserID.UUID != userID {
+		return response.ErrPermission()
+	}
+	return nil
+}
+
+// checkWorkspacePermission returns errNotMember if the user from context isn't a member of the workspace.
+// Viewers only have read permission, editors and owners have write permission.
+func checkWorkspacePermission(ctx context.Context, tx *sql.Tx, workspaceID uuid.UUID, permission string) error {
+	var role string
+	err := tx.QueryRowContext(ctx, `
+		SELECT role
+		FROM workspace_member
+		WHERE workspace_id = $1 AND user_id = $2`,
+		workspaceID, request.UserIDFromContext(ctx),
+	).Scan(&role)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return errNotMember
+		}
+		return err
+	}
+
+	if permission == PermissionWrite && role == "viewer" {
+		return response.ErrPermission()
+	}
+	return nil
+}
+
+// checkList returns an error if the list of the todo doesn't exist, or isn't in the same workspace.
+// Personal todos can only be in personal lists of their owner.
+func checkList(ctx context.Context, tx *sql.Tx, todo *Todo) error {
+	if !todo.ListID.Valid {
+		return nil
+	}
+
+	var userID, workspaceID uuid.NullUUID
+	err := tx.QueryRowContext(ctx, `
+		SELECT user_id, workspace_id
+		FROM list
+		WHERE id = $1
+		FOR SHARE`,
+		todo.ListID,
+	).Scan(&userID, &workspaceID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return response.ErrIDNotFound("List", todo.ListID.UUID)
+		}
+		return err
+	}
+
+	if todo.WorkspaceID.Valid {
+		if workspaceID != todo.WorkspaceID {
+			return errListScope
+		}
+	} else if workspaceID.Valid || userID != todo.UserID {
+		return errListScope
+	}
+	return nil
+}
+
+// GetSubtree returns the todo with its subtasks nested in Subtasks. Subtasks not visible to the user
+// are left out together with their own subtasks.
+func (r *Repository) GetSubtree(ctx context.Context, id uuid.UUID) (*Todo, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		WITH RECURSIVE tree AS (
+			SELECT id AS tree_id, 1 AS depth FROM todo WHERE id = $2
+			UNION ALL
+			SELECT c.id, tree.depth + 1 FROM todo c JOIN tree ON c.parent_id = tree.tree_id
+			WHERE tree.depth < $3
+		)
+		SELECT id, user_id, workspace_id, list_id, parent_id, auto_complete, recurrence, timezone, rank, version, subject, description, priority, due_date, completed, created_at, updated_at,
+			subtasks_total, subtasks_completed
+		FROM todo JOIN tree ON tree.tree_id = todo.id `+subtaskCounts+`
+		WHERE `+visibleToUser+`
+		ORDER BY tree.depth ASC, created_at ASC`,
+		request.UserIDFromContext(ctx), id, maxDepth,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// Rows are ordered by depth, so parents are read before their subtasks.
+	todos := map[uuid.UUID]*Todo{}
+	for rows.Next() {
+		todo := &Todo{}
+		err := rows.Scan(
+			&todo.ID,
+			&todo.UserID,
+			&todo.WorkspaceID,
+			&todo.ListID,
+			&todo.ParentID,
+			&todo.AutoComplete,
+			&todo.Recurrence,
+			&todo.Timezone,
+			&todo.Rank,
+			&todo.Version,
+			&todo.Subject,
+			&todo.Description,
+			&todo.Priority,
+			&todo.DueDate,
+			&todo.Completed,
+			&todo.CreatedAt,
+			&todo.UpdatedAt,
+			&todo.SubtasksTotal,
+			&todo.SubtasksCompleted,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if todo.ID == id {
+			todos[todo.ID] = todo
+			continue
+		}
+		if parent := todos[todo.ParentID.UUID]; parent != nil {
+			parent.Subtasks = append(parent.Subtasks, todo)
+			todos[todo.ID] = todo
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	root := todos[id]
+	if root == nil {
+		return nil, response.ErrIDNotFound("Todo", id)
+	}
+
+	err = r.loadTags(ctx, lo.Values(todos))
+	if err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+// checkParent returns an error if the parent of the todo doesn't exist, isn't in the same workspace,
+// would create a cycle, or would nest the todo and its subtasks (height levels) too deep.
+// The parent is locked, so concurrent changes can't create a cycle.
+func checkParent(ctx context.Context, tx *sql.Tx, todo *Todo, height int) error {
+	if !todo.ParentID.Valid {
+		return nil
+	}
+
+	parent, err := getTodoForUpdate(ctx, tx, todo.ParentID.UUID)
+	if err != nil {
+		return err
+	}
+	err = checkPermission(ctx, tx, parent, PermissionWrite)
+	if err != nil {
+		return err
+	}
+	if todo.WorkspaceID.Valid {
+		if parent.WorkspaceID != todo.WorkspaceID {
+			return errParentScope
+		}
+	} else if parent.WorkspaceID.Valid || parent.UserID != todo.UserID {
+		return errParentScope
+	}
+
+	// Walk up from the parent. The todo being one of its ancestors means a cycle.
+	var depth int
+	var cycle bool
+	err = tx.QueryRowContext(ctx, `
+		WITH RECURSIVE ancestor AS (
+			SELECT id, parent_id, 1 AS depth FROM todo WHERE id = $1
+			UNION ALL
+			SELECT t.id, t.parent_id, ancestor.depth + 1 FROM todo t JOIN ancestor ON t.id = ancestor.parent_id
+			WHERE ancestor.depth <= $3
+		)
+		SELECT MAX(depth), COALESCE(BOOL_OR(id = $2), FALSE) FROM ancestor`,
+		parent.ID, todo.ID, maxDepth,
+	).Scan(&depth, &cycle)
+	if err != nil {
+		return err
+	}
+	if cycle {
+		return errParentCycle
+	}
+	if depth+height > maxDepth {
+		return errParentDepth
+	}
+	return nil
+}
+
+// subtreeHeight returns the number of levels of the todo and its subtasks.
+func subtreeHeight(ctx context.Context, tx *sql.Tx, id uuid.UUID) (int, error) {
+	var height int
+	err := tx.QueryRowContext(ctx, `
+		WITH RECURSIVE subtask AS (
+			SELECT id, 1 AS depth FROM todo WHERE id = $1
+			UNION ALL
+			SELECT c.id, subtask.depth + 1 FROM todo c JOIN subtask ON c.parent_id = subtask.id
+			WHERE subtask.depth <= $2
+		)
+		SELECT MAX(depth) FROM subtask`,
+		id, maxDepth,
+	).Scan(&height)
+	return height, err
+}
+
+// autoCompleteAncestors completes the todo if auto-complete is enabled and all its subtasks are completed,
+// then does the same for its parent, and so on.
+func autoCompleteAncestors(ctx context.Context, tx *sql.Tx, id uuid.UUID) error {
+	// Only one subtask of each ancestor is in the chain, so the ancestor is completed if all other
+	// subtasks already are.
+	_, err := tx.ExecContext(ctx, `
+		WITH RECURSIVE chain AS (
+			SELECT t.id, t.parent_id FROM todo t
+			WHERE t.id = $1 AND t.auto_complete AND NOT t.completed
+				AND EXISTS (SELECT 1 FROM todo c WHERE c.parent_id = t.id)
+				AND NOT EXISTS (SELECT 1 FROM todo c WHERE c.parent_id = t.id AND NOT c.completed)
+			UNION ALL
+			SELECT t.id, t.parent_id FROM todo t JOIN chain ON t.id = chain.parent_id
+			WHERE t.auto_complete AND NOT t.completed
+				AND NOT EXISTS (SELECT 1 FROM todo c WHERE c.parent_id = t.id AND NOT c.completed AND c.id <> chain.id)
+		)
+		UPDATE todo SET completed = TRUE, updated_at = NOW(), version = version + 1
+		FROM chain
+		WHERE todo.id = chain.id`,
+		id,
+	)
+	return err
+}
+
+// BumpVersions increments the versions of todos matching cond, a condition on the todo table with args,
+// after a change of their representation outside this package, e.g. renaming a tag. Cached ETags of the
+// todos stop matching. Run it in the transaction of the change.
+func BumpVersions(ctx context.Context, tx *sql.Tx, cond string, args ...any) error {
+	_, err := tx.ExecContext(ctx, "UPDATE todo SET version = version + 1 WHERE "+cond, args...)
+	return err
+}
+
+// BumpAncestorVersions is like BumpVersions, and also increments the versions of the ancestors of the todos,
+// whose computed subtask counts change when the todos are added, deleted or completed.
+func BumpAncestorVersions(ctx context.Context, tx *sql.Tx, cond string, args ...any) error {
+	_, err := tx.ExecContext(ctx, `
+		WITH RECURSIVE ancestor AS (
+			SELECT id, parent_id FROM todo WHERE `+cond+`
+			UNION
+			SELECT t.id, t.parent_id FROM todo t JOIN ancestor ON t.id = ancestor.parent_id
+		)
+		UPDATE todo SET version = version + 1
+		FROM ancestor
+		WHERE todo.id = ancestor.id`,
+		args...,
+	)
+	return err
+}
+
+// todoETag returns the ETag of the todo for the user from context. Tags are the user's own,
+// so the same version is a different representation for each user.
+func todoETag(ctx context.Context, todo *Todo) string {
+	return response.ETag(todo.Version, request.UserIDFromContext(ctx).String())
+}
+
+// loadTags sets Tags of the todos to the names of the user's tags, in a single query.
+func (r *Repository) loadTags(ctx context.Context, todos []*Todo) error {
+	if len(todos) == 0 {
+		return nil
+	}
+
+	byID := make(map[uuid.UUID]*Todo, len(todos))
+	for _, todo := range todos {
+		todo.Tags = []string{}
+		byID[todo.ID] = todo
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT tt.todo_id, tag.name
+		FROM todo_tag tt
+		JOIN tag ON tag.id = tt.tag_id
+		WHERE tag.user_id = $1 AND tt.todo_id = ANY($2)
+		ORDER BY tag.name ASC`,
+		request.UserIDFromContext(ctx), lo.Keys(byID),
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var todoID uuid.UUID
+		var name string
+		err := rows.Scan(&todoID, &name)
+		if err != nil {
+			return err
+		}
+		byID[todoID].Tags = append(byID[todoID].Tags, name)
+	}
+	return rows.Err()
+}
+
+// setTags replaces the user's tags on the todo. Tags that don't exist yet are created.
+// Tags of other users on the todo are kept.
+func setTags(ctx context.Context, tx *sql.Tx, todoID uuid.UUID, names []string) error {
+	userID := request.UserIDFromContext(ctx)
+	names = lo.Uniq(names)
+
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO tag (id, user_id, name, created_at, updated_at)
+		SELECT GEN_RANDOM_UUID(), $1, name, NOW(), NOW()
+		FROM UNNEST($2::TEXT[]) AS name
+		ON CONFLICT (user_id, name) DO NOTHING`,
+		userID, names,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM todo_tag
+		WHERE todo_id = $1 AND tag_id IN (SELECT id FROM tag WHERE user_id = $2)`,
+		todoID, userID,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO todo_tag (todo_id, tag_id)
+		SELECT $1, id FROM tag WHERE user_id = $2 AND name = ANY($3)`,
+		todoID, userID, names,
+	)
+	return err
+}
+
+// nextOccurrence returns a copy of the todo due at its next occurrence, or nil if the recurrence has ended.
+func nextOccurrence(todo *Todo) (*Todo, error) {
+	recurrence, dueDate, ok, err := todo.nextOccurrence()
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	next := *todo
+	next.ID = uuid.New()
+	next.Recurrence = null.StringFrom(recurrence)
+	next.DueDate = null.TimeFrom(dueDate)
+	next.Completed = false
+	// The occurrence is ranked last in its scope by insertTodo, rather than sharing the rank of the completed todo.
+	next.Rank = null.String{}
+	next.Version = 1
+	next.CreatedAt = time.Now()
+	next.UpdatedAt = next.CreatedAt
+	return &next, nil
+}
+
+// createOccurrence inserts the next occurrence of the todo with ID prevID, with the same tags and shares.
+func createOccurrence(ctx context.Context, tx *sql.Tx, prevID uuid.UUID, todo *Todo) error {
+	err := insertTodo(ctx, tx, todo)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO todo_tag (todo_id, tag_id)
+		SELECT $1, tag_id FROM todo_tag WHERE todo_id = $2`,
+		todo.ID, prevID,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO todo_share (todo_id, user_id, permission, created_at, updated_at)
+		SELECT $1, user_id, permission, NOW(), NOW() FROM todo_share WHERE todo_id = $2`,
+		todo.ID, prevID,
+	)
+	if err != nil {
+		return err
+	}
+
+	// Reminders relative to the due date repeat, reminders at an absolute time don't.
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO reminder (id, todo_id, user_id, offset_minutes, fire_at, created_at)
+		SELECT GEN_RANDOM_UUID(), $1, user_id, offset_minutes, $3::TIMESTAMPTZ - MAKE_INTERVAL(mins => offset_minutes), NOW()
+		FROM reminder
+		WHERE todo_id = $2 AND offset_minutes IS NOT NULL`,
+		todo.ID, prevID, todo.DueDate,
+	)
+	return err
+}
+
+// GetReminders returns the user's reminders on the todo.
+func (r *Repository) GetReminders(ctx context.Context, todoID uuid.UUID) ([]*Reminder, error) {
+	// Check if the todo is visible to the user.
+	_, err := r.Get(ctx, todoID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, todo_id, user_id, remind_at, offset_minutes, fire_at, sent_at, failed_at, created_at
+		FROM reminder
+		WHERE todo_id = $1 AND user_id = $2
+		ORDER BY fire_at ASC NULLS LAST, created_at ASC`,
+		todoID, request.UserIDFromContext(ctx),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reminders := []*Reminder{}
+	for rows.Next() {
+		reminder := &Reminder{}
+		err := rows.Scan(
+			&reminder.ID,
+			&reminder.TodoID,
+			&reminder.UserID,
+			&reminder.RemindAt,
+			&reminder.OffsetMinutes,
+			&reminder.FireAt,
+			&reminder.SentAt,
+			&reminder.FailedAt,
+			&reminder.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		reminders = append(reminders, reminder)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return reminders, nil
+}
+
+// CreateReminder creates a reminder for the user. Any user who can read the todo can be reminded of it.
+func (r *Repository) CreateReminder(ctx context.Context, todoID uuid.UUID, reminder *Reminder) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	todo, err := getTodoForUpdate(ctx, tx, todoID)
+	if err != nil {
+		return err
+	}
+	err = checkPermission(ctx, tx, todo, PermissionRead)
+	if err != nil {
+		return err
+	}
+
+	reminder.ID = uuid.New()
+	reminder.TodoID = todoID
+	reminder.UserID = request.UserIDFromContext(ctx)
+	reminder.FireAt = reminder.RemindAt
+	reminder.SentAt = null.Time{}
+	reminder.FailedAt = null.Time{}
+	reminder.CreatedAt = time.Now()
+	if reminder.OffsetMinutes.Valid {
+		if !todo.DueDate.Valid {
+			return errReminderDueDate
+		}
+		offset := time.Duration(reminder.OffsetMinutes.Int64) * time.Minute
+		reminder.FireAt = null.TimeFrom(todo.DueDate.Time.Add(-offset))
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO reminder (id, todo_id, user_id, remind_at, offset_minutes, fire_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		reminder.ID,
+		reminder.TodoID,
+		reminder.UserID,
+		reminder.RemindAt,
+		reminder.OffsetMinutes,
+		reminder.FireAt,
+		reminder.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DeleteReminder deletes the user's reminder.
+func (r *Repository) DeleteReminder(ctx context.Context, todoID uuid.UUID, reminderID uuid.UUID) error {
+	result, err := r.db.ExecContext(ctx,
+		"DELETE FROM reminder WHERE id = $1 AND todo_id = $2 AND user_id = $3",
+		reminderID, todoID, request.UserIDFromContext(ctx),
+	)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return response.ErrIDNotFound("Reminder", reminderID)
+	}
+	return nil
+}
+
+// rescheduleReminders moves reminders relative to the due date. Reminders moved to the future
+// are sent again, even if they were sent for the old due date.
+func rescheduleReminders(ctx context.Context, tx *sql.Tx, todoID uuid.UUID, dueDate null.Time) error {
+	_, err := tx.ExecContext(ctx, `
+		UPDATE reminder
+		SET fire_at = $2::TIMESTAMPTZ - MAKE_INTERVAL(mins => offset_minutes), attempts = 0, last_error = NULL,
+			sent_at = CASE WHEN $2::TIMESTAMPTZ - MAKE_INTERVAL(mins => offset_minutes) > NOW() THEN NULL ELSE sent_at END,
+			failed_at = NULL
+		WHERE todo_id = $1 AND offset_minutes IS NOT NULL`,
+		todoID, dueDate,
+	)
+	return err
+}
+
+// searchQuery converts user input into a tsquery matching todos with all words, each as a prefix,
+// e.g. "invoice 2024" into "invoice:* & 2024:*". Characters other than letters and digits separate words,
+// so the input can't inject tsquery operators.
+func searchQuery(q string) string {
+	words := strings.FieldsFunc(q, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) > maxSearchWords {
+		words = words[:maxSearchWords]
+	}
+	for i, word := range words {
+		words[i] = word + ":*"
+	}
+	return strings.Join(words, " & ")
+}
+
+// highlight escapes a snippet as HTML and replaces its highlight characters with <mark></mark>.
+func highlight(snippet string) string {
+	return strings.NewReplacer(snippetStart, "<mark>", snippetStop, "</mark>").Replace(html.EscapeString(snippet))
+}
+
+// sortValue returns the value of a sort key of the todo, for pagination cursors.
+func sortValue(todo *Todo, name string) any {
+	switch name {
+	case "subject":
+		return todo.Subject
+	case "description":
+		return todo.Description
+	case "priority":
+		return todo.Priority
+	case "due_date":
+		return todo.DueDate
+	case "completed":
+		return todo.Completed
+	case "created_at":
+		return todo.CreatedAt
+	case "updated_at":
+		return todo.UpdatedAt
+	case "rank":
+		return todo.Rank
+	case "search_rank":
+		return lo.FromPtr(todo.SearchRank)
+	default:
+		return todo.ID
+	}
+}
+
+// Move ranks the todo between the todos move.After and move.Before. If only one of them is set,
+// the todo is ranked right next to it.
+func (r *Repository) Move(ctx context.Context, id uuid.UUID, move *TodoMove) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Moves in the same scope are serialized by locking it before any todo, so concurrent moves
+	// can't compute the same rank, and can't deadlock when locking each other's todos.
+	scope, err := lockRankScope(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+	todo, err := getTodoForUpdate(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+	err = checkPermission(ctx, tx, todo, PermissionWrite)
+	if err != nil {
+		return err
+	}
+	if todo.WorkspaceID != scope.WorkspaceID || (!scope.WorkspaceID.Valid && todo.UserID != scope.UserID) {
+		return errMoveConcurrent
+	}
+
+	// Lock the neighbors, so they aren't moved away before the todo is ranked next to them.
+	for _, neighborID := range []uuid.NullUUID{move.After, move.Before} {
+		if !neighborID.Valid {
+			continue
+		}
+		neighbor, err := getTodoForUpdate(ctx, tx, neighborID.UUID)
+		if err != nil {
+			return err
+		}
+		err = checkPermission(ctx, tx, neighbor, PermissionRead)
+		if err != nil {
+			return err
+		}
+		if neighbor.WorkspaceID != todo.WorkspaceID || (!todo.WorkspaceID.Valid && neighbor.UserID != todo.UserID) {
+			return errMoveScope
+		}
+	}
+
+	// Todos created before ranks were added have no rank yet.
+	var unranked bool
+	scopeCond, arg := rankScope(todo)
+	err = tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM todo WHERE rank IS NULL AND "+scopeCond+")", arg).Scan(&unranked)
+	if err != nil {
+		return err
+	}
+	if unranked {
+		err = rebalanceRanks(ctx, tx, todo)
+		if err != nil {
+			return err
+		}
+	}
+
+	newRank, err := rankBetween(ctx, tx, todo, move)
+	if err != nil {
+		return err
+	}
+	// Ranks get longer when todos are moved between the same neighbors repeatedly,
+	// and can be equal when todos are created at the same time.
+	if newRank == "" || len(newRank) > rank.MaxLength {
+		err = rebalanceRanks(ctx, tx, todo)
+		if err != nil {
+			return err
+		}
+		newRank, err = rankBetween(ctx, tx, todo, move)
+		if err != nil {
+			return err
+		}
+		if newRank == "" {
+			return errMoveOrder
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE todo SET rank = $2, version = version + 1 WHERE id = $1", id, newRank)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// rankScope returns the condition for todos ranked together with the todo, with $1 as the arg:
+// todos in the same workspace, or personal todos of the same user.
+func rankScope(todo *Todo) (string, any) {
+	if todo.WorkspaceID.Valid {
+		return "workspace_id = $1", todo.WorkspaceID.UUID
+	}
+	return "workspace_id IS NULL AND user_id = $1", todo.UserID
+}
+
+// lockRankScope locks the workspace or user whose todos are ranked together with the todo,
+// and returns the todo with only WorkspaceID and UserID set, read before locking.
+func lockRankScope(ctx context.Context, tx *sql.Tx, id uuid.UUID) (*Todo, error) {
+	scope := &Todo{}
+	err := tx.QueryRowContext(ctx, "SELECT workspace_id, user_id FROM todo WHERE id = $1", id).Scan(&scope.WorkspaceID, &scope.UserID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, response.ErrIDNotFound("Todo", id)
+		}
+		return nil, err
+	}
+
+	// NO KEY UPDATE doesn't block inserting todos referencing the row.
+	if scope.WorkspaceID.Valid {
+		_, err = tx.ExecContext(ctx, "SELECT 1 FROM workspace WHERE id = $1 FOR NO KEY UPDATE", scope.WorkspaceID)
+	} else {
+		_, err = tx.ExecContext(ctx, `SELECT 1 FROM "user" WHERE id = $1 FOR NO KEY UPDATE`, scope.UserID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return scope, nil
+}
+
+// rankBetween returns a rank for the todo between its new neighbors, or empty string if they have the same rank.
+// The neighbor not set in move is the todo ranked right before or after the other.
+func rankBetween(ctx context.Context, tx *sql.Tx, todo *Todo, move *TodoMove) (string, error) {
+	scope, arg := rankScope(todo)
+	var after, before null.String
+	if move.After.Valid {
+		err := tx.QueryRowContext(ctx, "SELECT rank FROM todo WHERE id = $1", move.After.UUID).Scan(&after)
+		if err != nil {
+			return "", err
+		}
+	}
+	if move.Before.Valid {
+		err := tx.QueryRowContext(ctx, "SELECT rank FROM todo WHERE id = $1", move.Before.UUID).Scan(&before)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	var err error
+	switch {
+	case !move.Before.Valid:
+		err = tx.QueryRowContext(ctx,
+			"SELECT MIN(rank) FROM todo WHERE rank > $2 AND id <> $3 AND "+scope,
+			arg, after, todo.ID,
+		).Scan(&before)
+	case !move.After.Valid:
+		err = tx.QueryRowContext(ctx,
+			"SELECT MAX(rank) FROM todo WHERE rank < $2 AND id <> $3 AND "+scope,
+			arg, before, todo.ID,
+		).Scan(&after)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	a, b := after.ValueOrZero(), before.ValueOrZero()
+	if b != "" && a > b {
+		return "", errMoveOrder
+	}
+	if b != "" && a == b {
+		return "", nil
+	}
+	return rank.Between(a, b), nil
+}
+
+// rebalanceRanks spaces ranks of todos ranked together with the todo evenly, keeping their order.
+// Todos without rank are ranked last, in order of creation.
+func rebalanceRanks(ctx context.Context, tx *sql.Tx, todo *Todo) error {
+	scope, arg := rankScope(todo)
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id FROM todo
+		WHERE `+scope+`
+		ORDER BY rank ASC NULLS LAST, created_at ASC, id ASC
+		FOR UPDATE`,
+		arg,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE todo SET rank = r.rank, version = version + 1
+		FROM UNNEST($1::UUID[], $2::TEXT[]) AS r (id, rank)
+		WHERE todo.id = r.id`,
+		ids, rank.Even(len(ids)),
+	)
+	return err
+}
@@ -0,0 +1,69 @@
+package todo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/guregu/null/v5"
+)
+
+func TestNextOccurrence(t *testing.T) {
+	dueDate := time.Date(2024, time.January, 31, 9, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name           string
+		recurrence     string
+		timezone       string
+		wantDueDate    time.Time
+		wantRecurrence string
+		wantEnded      bool
+	}{
+		{"daily", "FREQ=DAILY", "", dueDate.AddDate(0, 0, 1), "FREQ=DAILY", false},
+		{"count is decremented", "FREQ=WEEKLY;COUNT=3", "", dueDate.AddDate(0, 0, 7), "FREQ=WEEKLY;COUNT=2", false},
+		{"last of count", "FREQ=WEEKLY;COUNT=1", "", time.Time{}, "", true},
+		{"month without the day is skipped", "FREQ=MONTHLY", "", time.Date(2024, time.March, 31, 9, 0, 0, 0, time.UTC), "FREQ=MONTHLY", false},
+		{"until passed", "FREQ=DAILY;UNTIL=20240131", "", time.Time{}, "", true},
+		// 9:00 UTC is 18:00 in Tokyo, so the next weekday there is Thursday, February 1.
+		{"weekdays in timezone", "FREQ=WEEKLY;BYDAY=TH", "Asia/Tokyo", time.Date(2024, time.February, 1, 9, 0, 0, 0, time.UTC), "FREQ=WEEKLY;BYDAY=TH", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			todo := &Todo{
+				ID:         uuid.New(),
+				Subject:    "Water plants",
+				DueDate:    null.TimeFrom(dueDate),
+				Recurrence: null.StringFrom(tt.recurrence),
+				Timezone:   null.NewString(tt.timezone, tt.timezone != ""),
+				Completed:  true,
+				Rank:       null.StringFrom("i"),
+				Version:    7,
+			}
+			next, err := nextOccurrence(todo)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantEnded {
+				if next != nil {
+					t.Fatalf("next = %+v, want nil", next)
+				}
+				return
+			}
+
+			if !next.DueDate.Time.Equal(tt.wantDueDate) {
+				t.Errorf("due date = %s, want %s", next.DueDate.Time, tt.wantDueDate)
+			}
+			if next.Recurrence.String != tt.wantRecurrence {
+				t.Errorf("recurrence = %q, want %q", next.Recurrence.String, tt.wantRecurrence)
+			}
+			if next.ID == todo.ID || next.Completed || next.Subject != todo.Subject {
+				t.Errorf("next = %+v, want a new uncompleted copy", next)
+			}
+			if next.Rank.Valid {
+				t.Errorf("rank = %q, want null so the occurrence is ranked last", next.Rank.String)
+			}
+			if next.Version != 1 {
+				t.Errorf("version = %d, want 1", next.Version)
+			}
+		})
+	}
+}
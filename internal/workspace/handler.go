@@ -0,0 +1,396 @@
+package workspace
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/go-ozzo/ozzo-validation/v4/is"
+	"github.com/google/uuid"
+	"github.com/nathansiegfrid/todolist/pkg/handler"
+	"github.com/nathansiegfrid/todolist/pkg/mailer"
+	"github.com/nathansiegfrid/todolist/pkg/request"
+	"github.com/nathansiegfrid/todolist/pkg/response"
+	"github.com/nathansiegfrid/todolist/pkg/token"
+)
+
+const invitationDuration = 7 * 24 * time.Hour
+
+type repository interface {
+	GetAll(ctx context.Context) ([]*Workspace, error)
+	Get(ctx context.Context, id uuid.UUID) (*Workspace, error)
+	Create(ctx context.Context, ws *Workspace) error
+	Update(ctx context.Context, id uuid.UUID, update *WorkspaceUpdate) error
+	Delete(ctx context.Context, id uuid.UUID) error
+	GetMembers(ctx context.Context, id uuid.UUID) ([]*Member, error)
+	UpdateMember(ctx context.Context, id uuid.UUID, userID uuid.UUID, role string) error
+	DeleteMember(ctx context.Context, id uuid.UUID, userID uuid.UUID) error
+	GetInvitations(ctx context.Context, id uuid.UUID) ([]*Invitation, error)
+	CreateInvitation(ctx context.Context, inv *Invitation) error
+	DeleteInvitation(ctx context.Context, id uuid.UUID, invitationID uuid.UUID) error
+	AcceptInvitation(ctx context.Context, tokenHash []byte) (uuid.UUID, error)
+}
+
+// Config contains the dependencies and settings of Handler.
+type Config struct {
+	Mailer mailer.Mailer
+	AppURL string // Base URL of the web app, used for links in emails.
+}
+
+type Handler struct {
+	repository repository
+	mailer     mailer.Mailer
+	appURL     string
+}
+
+func NewHandler(db *sql.DB, config *Config) *Handler {
+	return &Handler{
+		repository: NewRepository(db),
+		mailer:     config.Mailer,
+		appURL:     strings.TrimSuffix(config.AppURL, "/"),
+	}
+}
+
+func (h *Handler) HandleWorkspacesRoute() http.HandlerFunc {
+	return handler.MethodHandler{
+		"GET":  handler.ErrorHandlerFunc(h.getAllWorkspaces),
+		"POST": handler.ErrorHandlerFunc(h.createWorkspace),
+	}.HandlerFunc()
+}
+
+func (h *Handler) HandleWorkspacesIDRoute() http.HandlerFunc {
+	return handler.MethodHandler{
+		"GET":    handler.ErrorHandlerFunc(h.getWorkspace),
+		"PATCH":  handler.ErrorHandlerFunc(h.updateWorkspace),
+		"DELETE": handler.ErrorHandlerFunc(h.deleteWorkspace),
+	}.HandlerFunc()
+}
+
+func (h *Handler) HandleWorkspacesIDMembersRoute() http.HandlerFunc {
+	return handler.MethodHandler{
+		"GET": handler.ErrorHandlerFunc(h.getAllMembers),
+	}.HandlerFunc()
+}
+
+func (h *Handler) HandleWorkspacesIDMembersUserIDRoute() http.HandlerFunc {
+	return handler.MethodHandler{
+		"PATCH":  handler.ErrorHandlerFunc(h.updateMember),
+		"DELETE": handler.ErrorHandlerFunc(h.deleteMember),
+	}.HandlerFunc()
+}
+
+func (h *Handler) HandleWorkspacesIDInvitationsRoute() http.HandlerFunc {
+	return handler.MethodHandler{
+		"GET":  handler.ErrorHandlerFunc(h.getAllInvitations),
+		"POST": handler.ErrorHandlerFunc(h.createInvitation),
+	}.HandlerFunc()
+}
+
+func (h *Handler) HandleWorkspacesIDInvitationsInvitationIDRoute() http.HandlerFunc {
+	return handler.MethodHandler{
+		"DELETE": handler.ErrorHandlerFunc(h.deleteInvitation),
+	}.HandlerFunc()
+}
+
+func (h *Handler) HandleInvitationsAcceptRoute() http.HandlerFunc {
+	return handler.MethodHandler{
+		"POST": handler.ErrorHandlerFunc(h.acceptInvitation),
+	}.HandlerFunc()
+}
+
+func (h *Handler) getAllWorkspaces(w http.ResponseWriter, r *http.Request) error {
+	workspaces, err := h.repository.GetAll(r.Context())
+	if err != nil {
+		return err
+	}
+
+	return response.WriteJSON(w, workspaces)
+}
+
+func (h *Handler) getWorkspace(w http.ResponseWriter, r *http.Request) error {
+	// Read request param "id".
+	id, err := request.ReadID(r)
+	if err != nil {
+		return err
+	}
+
+	ws, err := h.repository.Get(r.Context(), id)
+	if err != nil {
+		return err
+	}
+
+	return response.WriteJSON(w, ws)
+}
+
+func (h *Handler) createWorkspace(w http.ResponseWriter, r *http.Request) error {
+	// Read request body.
+	ws, err := request.ReadJSON[Workspace](r)
+	if err != nil {
+		return err
+	}
+
+	// Validate user input.
+	if err := validation.ValidateStruct(ws,
+		validation.Field(&ws.Name, validation.Required, validation.Length(0, 100)),
+	); err != nil {
+		if errs, ok := err.(validation.Errors); ok {
+			return response.ErrDataValidation(errs)
+		}
+		return err
+	}
+
+	err = h.repository.Create(r.Context(), ws)
+	if err != nil {
+		return err
+	}
+
+	return response.WriteJSON(w, ws)
+}
+
+func (h *Handler) updateWorkspace(w http.ResponseWriter, r *http.Request) error {
+	// Read request param "id".
+	id, err := request.ReadID(r)
+	if err != nil {
+		return err
+	}
+
+	// Read request body.
+	update, err := request.ReadJSON[WorkspaceUpdate](r)
+	if err != nil {
+		return err
+	}
+
+	// Validate user input.
+	if err := validation.ValidateStruct(update,
+		validation.Field(&update.Name, validation.NilOrNotEmpty, validation.Length(0, 100)),
+	); err != nil {
+		if errs, ok := err.(validation.Errors); ok {
+			return response.ErrDataValidation(errs)
+		}
+		return err
+	}
+
+	err = h.repository.Update(r.Context(), id, update)
+	if err != nil {
+		return err
+	}
+
+	return response.WriteOK(w)
+}
+
+func (h *Handler) deleteWorkspace(w http.ResponseWriter, r *http.Request) error {
+	// Read request param "id".
+	id, err := request.ReadID(r)
+	if err != nil {
+		return err
+	}
+
+	err = h.repository.Delete(r.Context(), id)
+	if err != nil {
+		return err
+	}
+
+	return response.WriteOK(w)
+}
+
+func (h *Handler) getAllMembers(w http.ResponseWriter, r *http.Request) error {
+	// Read request param "id".
+	id, err := request.ReadID(r)
+	if err != nil {
+		return err
+	}
+
+	members, err := h.repository.GetMembers(r.Context(), id)
+	if err != nil {
+		return err
+	}
+
+	return response.WriteJSON(w, members)
+}
+
+func (h *Handler) updateMember(w http.ResponseWriter, r *http.Request) error {
+	type requestBody struct {
+		Role string `json:"role"`
+	}
+
+	// Read request params "id" and "user_id".
+	id, err := request.ReadID(r)
+	if err != nil {
+		return err
+	}
+	userID, err := request.ReadIDParam(r, "user_id")
+	if err != nil {
+		return err
+	}
+
+	// Read request body.
+	reqBody, err := request.ReadJSON[requestBody](r)
+	if err != nil {
+		return err
+	}
+
+	// Validate user input.
+	if err := validation.ValidateStruct(reqBody,
+		validation.Field(&reqBody.Role, validation.Required, validation.In(RoleOwner, RoleEditor, RoleViewer)),
+	); err != nil {
+		if errs, ok := err.(validation.Errors); ok {
+			return response.ErrDataValidation(errs)
+		}
+		return err
+	}
+
+	err = h.repository.UpdateMember(r.Context(), id, userID, reqBody.Role)
+	if err != nil {
+		return err
+	}
+
+	return response.WriteOK(w)
+}
+
+func (h *Handler) deleteMember(w http.ResponseWriter, r *http.Request) error {
+	// Read request params "id" and "user_id".
+	id, err := request.ReadID(r)
+	if err != nil {
+		return err
+	}
+	userID, err := request.ReadIDParam(r, "user_id")
+	if err != nil {
+		return err
+	}
+
+	err = h.repository.DeleteMember(r.Context(), id, userID)
+	if err != nil {
+		return err
+	}
+
+	return response.WriteOK(w)
+}
+
+func (h *Handler) getAllInvitations(w http.ResponseWriter, r *http.Request) error {
+	// Read request param "id".
+	id, err := request.ReadID(r)
+	if err != nil {
+		return err
+	}
+
+	invitations, err := h.repository.GetInvitations(r.Context(), id)
+	if err != nil {
+		return err
+	}
+
+	return response.WriteJSON(w, invitations)
+}
+
+func (h *Handler) createInvitation(w http.ResponseWriter, r *http.Request) error {
+	// Read request param "id".
+	id, err := request.ReadID(r)
+	if err != nil {
+		return err
+	}
+
+	// Read request body.
+	inv, err := request.ReadJSON[Invitation](r)
+	if err != nil {
+		return err
+	}
+
+	// Validate user input.
+	if err := validation.ValidateStruct(inv,
+		validation.Field(&inv.Email, validation.Required, is.Email),
+		validation.Field(&inv.Role, validation.Required, validation.In(RoleOwner, RoleEditor, RoleViewer)),
+	); err != nil {
+		if errs, ok := err.(validation.Errors); ok {
+			return response.ErrDataValidation(errs)
+		}
+		return err
+	}
+
+	ws, err := h.repository.Get(r.Context(), id)
+	if err != nil {
+		return err
+	}
+
+	invitationToken, tokenHash, err := token.GenerateOpaqueToken()
+	if err != nil {
+		return err
+	}
+	inv.WorkspaceID = id
+	inv.TokenHash = tokenHash
+	inv.ExpiresAt = time.Now().Add(invitationDuration)
+
+	err = h.repository.CreateInvitation(r.Context(), inv)
+	if err != nil {
+		return err
+	}
+
+	err = h.mailer.Send(r.Context(), &mailer.Message{
+		To:      inv.Email,
+		Subject: "You have been invited to " + ws.Name,
+		Body: "You have been invited to join the workspace \"" + ws.Name + "\" as " + inv.Role + ". " +
+			"Open the link below to accept the invitation:\n\n" +
+			h.appURL + "/invitations/accept?token=" + url.QueryEscape(invitationToken) + "\n\n" +
+			"The link expires in 7 days.",
+	})
+	if err != nil {
+		return err
+	}
+
+	return response.WriteJSON(w, inv)
+}
+
+func (h *Handler) deleteInvitation(w http.ResponseWriter, r *http.Request) error {
+	// Read request params "id" and "invitation_id".
+	id, err := request.ReadID(r)
+	if err != nil {
+		return err
+	}
+	invitationID, err := request.ReadIDParam(r, "invitation_id")
+	if err != nil {
+		return err
+	}
+
+	err = h.repository.DeleteInvitation(r.Context(), id, invitationID)
+	if err != nil {
+		return err
+	}
+
+	return response.WriteOK(w)
+}
+
+func (h *Handler) acceptInvitation(w http.ResponseWriter, r *http.Request) error {
+	type requestBody struct {
+		Token string `json:"token"`
+	}
+
+	// Read request body.
+	reqBody, err := request.ReadJSON[requestBody](r)
+	if err != nil {
+		return err
+	}
+
+	// Validate user input.
+	if err := validation.ValidateStruct(reqBody,
+		validation.Field(&reqBody.Token, validation.Required),
+	); err != nil {
+		if errs, ok := err.(validation.Errors); ok {
+			return response.ErrDataValidation(errs)
+		}
+		return err
+	}
+
+	id, err := h.repository.AcceptInvitation(r.Context(), token.HashOpaqueToken(reqBody.Token))
+	if err != nil {
+		return err
+	}
+
+	ws, err := h.repository.Get(r.Context(), id)
+	if err != nil {
+		return err
+	}
+
+	return response.WriteJSON(w, ws)
+}
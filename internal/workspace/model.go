@@ -0,0 +1,50 @@
+package workspace
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/guregu/null/v5"
+	"github.com/nathansiegfrid/todolist/pkg/field"
+)
+
+// Member roles. Owners manage the workspace and its members, editors manage todos, viewers can only read.
+const (
+	RoleOwner  = "owner"
+	RoleEditor = "editor"
+	RoleViewer = "viewer"
+)
+
+type Workspace struct {
+	ID        uuid.UUID `json:"id"`
+	Name      string    `json:"name"`
+	Role      string    `json:"role"` // Role of the current user.
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type WorkspaceUpdate struct {
+	Name field.Option[string] `json:"name"`
+}
+
+type Member struct {
+	WorkspaceID uuid.UUID `json:"workspace_id"`
+	UserID      uuid.UUID `json:"user_id"`
+	Email       string    `json:"email"`
+	Role        string    `json:"role"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Invitation is sent by email. The invited user joins the workspace by accepting it with the token from the email.
+type Invitation struct {
+	ID          uuid.UUID     `json:"id"`
+	WorkspaceID uuid.UUID     `json:"workspace_id"`
+	Email       string        `json:"email"`
+	Role        string        `json:"role"`
+	TokenHash   []byte        `json:"-"`
+	InvitedBy   uuid.NullUUID `json:"invited_by"`
+	ExpiresAt   time.Time     `json:"expires_at"`
+	AcceptedAt  null.Time     `json:"accepted_at"`
+	CreatedAt   time.Time     `json:"created_at"`
+}
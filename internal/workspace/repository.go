@@ -0,0 +1,489 @@
+package workspace
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nathansiegfrid/todolist/pkg/request"
+	"github.com/nathansiegfrid/todolist/pkg/response"
+)
+
+var (
+	errLastOwner         = response.Error(http.StatusBadRequest, "Workspace must have at least one owner.")
+	errInvitationInvalid = response.Error(http.StatusBadRequest, "Invitation is invalid or has expired.")
+	errInvitationEmail   = response.Error(http.StatusForbidden, "Invitation was sent to a different email address.")
+)
+
+type Repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{db}
+}
+
+// GetAll returns the workspaces the user is a member of.
+func (r *Repository) GetAll(ctx context.Context) ([]*Workspace, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT w.id, w.name, m.role, w.created_at, w.updated_at
+		FROM workspace w
+		JOIN workspace_member m ON m.workspace_id = w.id
+		WHERE m.user_id = $1
+		ORDER BY w.name ASC`,
+		request.UserIDFromContext(ctx),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	workspaces := []*Workspace{}
+	for rows.Next() {
+		ws := &Workspace{}
+		err := rows.Scan(&ws.ID, &ws.Name, &ws.Role, &ws.CreatedAt, &ws.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		workspaces = append(workspaces, ws)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return workspaces, nil
+}
+
+// Get returns the workspace. Workspaces the user isn't a member of are reported as not found.
+func (r *Repository) Get(ctx context.Context, id uuid.UUID) (*Workspace, error) {
+	ws := &Workspace{}
+	err := r.db.QueryRowContext(ctx, `
+		SELECT w.id, w.name, m.role, w.created_at, w.updated_at
+		FROM workspace w
+		JOIN workspace_member m ON m.workspace_id = w.id
+		WHERE w.id = $1 AND m.user_id = $2`,
+		id, request.UserIDFromContext(ctx),
+	).Scan(&ws.ID, &ws.Name, &ws.Role, &ws.CreatedAt, &ws.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, response.ErrIDNotFound("Workspace", id)
+		}
+		return nil, err
+	}
+	return ws, nil
+}
+
+// Create creates the workspace with the user as owner.
+func (r *Repository) Create(ctx context.Context, ws *Workspace) error {
+	ws.ID = uuid.New()
+	ws.Role = RoleOwner
+	ws.CreatedAt = time.Now()
+	ws.UpdatedAt = ws.CreatedAt
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO workspace (id, name, created_at, updated_at)
+		VALUES ($1, $2, $3, $4)`,
+		ws.ID, ws.Name, ws.CreatedAt, ws.UpdatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO workspace_member (workspace_id, user_id, role, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5)`,
+		ws.ID, request.UserIDFromContext(ctx), ws.Role, ws.CreatedAt, ws.UpdatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *Repository) Update(ctx context.Context, id uuid.UUID, update *WorkspaceUpdate) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = checkRole(ctx, tx, id, RoleOwner)
+	if err != nil {
+		return err
+	}
+
+	if update.Name.Defined() {
+		_, err = tx.ExecContext(ctx,
+			"UPDATE workspace SET name = $1, updated_at = NOW() WHERE id = $2",
+			update.Name.ValueOrZero(), id,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Delete deletes the workspace with all its todos.
+func (r *Repository) Delete(ctx context.Context, id uuid.UUID) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = checkRole(ctx, tx, id, RoleOwner)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM workspace WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *Repository) GetMembers(ctx context.Context, id uuid.UUID) ([]*Member, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	err = checkRole(ctx, tx, id, RoleOwner, RoleEditor, RoleViewer)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT m.workspace_id, m.user_id, u.email, m.role, m.created_at, m.updated_at
+		FROM workspace_member m
+		JOIN "user" u ON u.id = m.user_id
+		WHERE m.workspace_id = $1
+		ORDER BY u.email ASC`,
+		id,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []*Member{}
+	for rows.Next() {
+		m := &Member{}
+		err := rows.Scan(&m.WorkspaceID, &m.UserID, &m.Email, &m.Role, &m.CreatedAt, &m.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return members, tx.Commit()
+}
+
+// UpdateMember changes the role of a member. Only owners can change roles.
+func (r *Repository) UpdateMember(ctx context.Context, id uuid.UUID, userID uuid.UUID, role string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = checkRole(ctx, tx, id, RoleOwner)
+	if err != nil {
+		return err
+	}
+	if role != RoleOwner {
+		err = checkOtherOwner(ctx, tx, id, userID)
+		if err != nil {
+			return err
+		}
+	}
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE workspace_member
+		SET role = $1, updated_at = NOW()
+		WHERE workspace_id = $2 AND user_id = $3`,
+		role, id, userID,
+	)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return response.Errorf(http.StatusNotFound, "User '%s' is not a member of workspace '%s'.", userID, id)
+	}
+	return tx.Commit()
+}
+
+// DeleteMember removes a member from the workspace. It can be done by owners, or by the member to leave.
+func (r *Repository) DeleteMember(ctx context.Context, id uuid.UUID, userID uuid.UUID) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if userID == request.UserIDFromContext(ctx) {
+		err = checkRole(ctx, tx, id, RoleOwner, RoleEditor, RoleViewer)
+	} else {
+		err = checkRole(ctx, tx, id, RoleOwner)
+	}
+	if err != nil {
+		return err
+	}
+	err = checkOtherOwner(ctx, tx, id, userID)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, "DELETE FROM workspace_member WHERE workspace_id = $1 AND user_id = $2", id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return response.Errorf(http.StatusNotFound, "User '%s' is not a member of workspace '%s'.", userID, id)
+	}
+	return tx.Commit()
+}
+
+func (r *Repository) GetInvitations(ctx context.Context, id uuid.UUID) ([]*Invitation, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	err = checkRole(ctx, tx, id, RoleOwner)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id, workspace_id, email, role, invited_by, expires_at, accepted_at, created_at
+		FROM workspace_invitation
+		WHERE workspace_id = $1
+		ORDER BY created_at DESC`,
+		id,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invitations := []*Invitation{}
+	for rows.Next() {
+		inv := &Invitation{}
+		err := rows.Scan(
+			&inv.ID,
+			&inv.WorkspaceID,
+			&inv.Email,
+			&inv.Role,
+			&inv.InvitedBy,
+			&inv.ExpiresAt,
+			&inv.AcceptedAt,
+			&inv.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, inv)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return invitations, tx.Commit()
+}
+
+// CreateInvitation stores an invitation to inv.WorkspaceID. Only owners can invite.
+func (r *Repository) CreateInvitation(ctx context.Context, inv *Invitation) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = checkRole(ctx, tx, inv.WorkspaceID, RoleOwner)
+	if err != nil {
+		return err
+	}
+
+	var isMember bool
+	err = tx.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1
+			FROM workspace_member m
+			JOIN "user" u ON u.id = m.user_id
+			WHERE m.workspace_id = $1 AND u.email = LOWER($2)
+		)`,
+		inv.WorkspaceID, inv.Email,
+	).Scan(&isMember)
+	if err != nil {
+		return err
+	}
+	if isMember {
+		return response.ErrConflict("Member", inv.Email)
+	}
+
+	inv.ID = uuid.New()
+	inv.Email = strings.ToLower(inv.Email)
+	inv.InvitedBy = uuid.NullUUID{UUID: request.UserIDFromContext(ctx), Valid: true}
+	inv.CreatedAt = time.Now()
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO workspace_invitation (id, workspace_id, email, role, token_hash, invited_by, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		inv.ID, inv.WorkspaceID, inv.Email, inv.Role, inv.TokenHash, inv.InvitedBy, inv.ExpiresAt, inv.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *Repository) DeleteInvitation(ctx context.Context, id uuid.UUID, invitationID uuid.UUID) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = checkRole(ctx, tx, id, RoleOwner)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx,
+		"DELETE FROM workspace_invitation WHERE id = $1 AND workspace_id = $2",
+		invitationID, id,
+	)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return response.ErrIDNotFound("Invitation", invitationID)
+	}
+	return tx.Commit()
+}
+
+// AcceptInvitation adds the user to the workspace of the invitation, and returns the workspace ID.
+// The invitation can only be accepted once, by the user with the invited email. Existing members keep their role.
+func (r *Repository) AcceptInvitation(ctx context.Context, tokenHash []byte) (uuid.UUID, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	defer tx.Rollback()
+
+	inv := &Invitation{}
+	err = tx.QueryRowContext(ctx, `
+		SELECT id, workspace_id, email, role
+		FROM workspace_invitation
+		WHERE token_hash = $1 AND accepted_at IS NULL AND expires_at > NOW()
+		FOR UPDATE`,
+		tokenHash,
+	).Scan(&inv.ID, &inv.WorkspaceID, &inv.Email, &inv.Role)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return uuid.Nil, errInvitationInvalid
+		}
+		return uuid.Nil, err
+	}
+
+	userID := request.UserIDFromContext(ctx)
+	var email string
+	err = tx.QueryRowContext(ctx, `SELECT email FROM "user" WHERE id = $1`, userID).Scan(&email)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if email != inv.Email {
+		return uuid.Nil, errInvitationEmail
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO workspace_member (workspace_id, user_id, role, created_at, updated_at)
+		VALUES ($1, $2, $3, NOW(), NOW())
+		ON CONFLICT (workspace_id, user_id) DO NOTHING`,
+		inv.WorkspaceID, userID, inv.Role,
+	)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE workspace_invitation SET accepted_at = NOW() WHERE id = $1", inv.ID)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return inv.WorkspaceID, tx.Commit()
+}
+
+// checkRole locks the workspace and returns an error if the user from context doesn't have one of the roles.
+// Workspaces the user isn't a member of are reported as not found.
+func checkRole(ctx context.Context, tx *sql.Tx, id uuid.UUID, roles ...string) error {
+	var role string
+	err := tx.QueryRowContext(ctx, `
+		SELECT m.role
+		FROM workspace w
+		JOIN workspace_member m ON m.workspace_id = w.id
+		WHERE w.id = $1 AND m.user_id = $2
+		FOR UPDATE OF w`,
+		id, request.UserIDFromContext(ctx),
+	).Scan(&role)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return response.ErrIDNotFound("Workspace", id)
+		}
+		return err
+	}
+
+	if !slices.Contains(roles, role) {
+		return response.ErrPermission()
+	}
+	return nil
+}
+
+// checkOtherOwner returns an error if the user is the only owner of the workspace.
+// It must be called after checkRole, which locks the workspace against concurrent changes of members.
+func checkOtherOwner(ctx context.Context, tx *sql.Tx, id uuid.UUID, userID uuid.UUID) error {
+	var otherOwners int
+	err := tx.QueryRowContext(ctx, `
+		SELECT COUNT(*)
+		FROM workspace_member
+		WHERE workspace_id = $1 AND role = $2 AND user_id <> $3`,
+		id, RoleOwner, userID,
+	).Scan(&otherOwners)
+	if err != nil {
+		return err
+	}
+	if otherOwners == 0 {
+		return errLastOwner
+	}
+	return nil
+}
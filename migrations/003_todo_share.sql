@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE "todo_share"
+(
+    "todo_id" UUID NOT NULL REFERENCES "todo" ON DELETE CASCADE,
+    "user_id" UUID NOT NULL REFERENCES "user" ON DELETE CASCADE,
+    "permission" TEXT NOT NULL CHECK ("permission" IN ('read', 'write')),
+    "created_at" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    "updated_at" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY ("todo_id", "user_id")
+);
+CREATE INDEX "todo_share_user_id_idx" ON "todo_share" ("user_id");
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS "todo_share";
+-- +goose StatementEnd
@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE "refresh_token"
+(
+    "id" UUID PRIMARY KEY DEFAULT GEN_RANDOM_UUID() CHECK ("id" <> '00000000-0000-0000-0000-000000000000'),
+    "user_id" UUID NOT NULL REFERENCES "user" ON DELETE CASCADE,
+    "family_id" UUID NOT NULL,
+    "token_hash" BYTEA UNIQUE NOT NULL,
+    "expires_at" TIMESTAMPTZ NOT NULL,
+    "used_at" TIMESTAMPTZ,
+    "revoked_at" TIMESTAMPTZ,
+    "created_at" TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX "refresh_token_family_id_idx" ON "refresh_token" ("family_id");
+CREATE INDEX "refresh_token_user_id_idx" ON "refresh_token" ("user_id");
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS "refresh_token";
+-- +goose StatementEnd
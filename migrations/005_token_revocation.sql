@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE "revoked_token"
+(
+    "token_id" TEXT PRIMARY KEY,
+    "expires_at" TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX "revoked_token_expires_at_idx" ON "revoked_token" ("expires_at");
+
+CREATE TABLE "user_token_revocation"
+(
+    "user_id" UUID PRIMARY KEY REFERENCES "user" ON DELETE CASCADE,
+    "revoked_before" TIMESTAMPTZ NOT NULL
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS "user_token_revocation";
+DROP TABLE IF EXISTS "revoked_token";
+-- +goose StatementEnd
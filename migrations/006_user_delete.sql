@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Deleting a user deletes their todos instead of leaving them without an owner.
+ALTER TABLE "todo" DROP CONSTRAINT "todo_user_id_fkey";
+ALTER TABLE "todo" ADD CONSTRAINT "todo_user_id_fkey" FOREIGN KEY ("user_id") REFERENCES "user" ON DELETE CASCADE;
+
+-- Revocations must outlive the user, so tokens issued before deletion stay invalid.
+ALTER TABLE "user_token_revocation" DROP CONSTRAINT "user_token_revocation_user_id_fkey";
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM "user_token_revocation" r WHERE NOT EXISTS (SELECT 1 FROM "user" u WHERE u.id = r.user_id);
+ALTER TABLE "user_token_revocation" ADD CONSTRAINT "user_token_revocation_user_id_fkey" FOREIGN KEY ("user_id") REFERENCES "user" ON DELETE CASCADE;
+
+ALTER TABLE "todo" DROP CONSTRAINT "todo_user_id_fkey";
+ALTER TABLE "todo" ADD CONSTRAINT "todo_user_id_fkey" FOREIGN KEY ("user_id") REFERENCES "user" ON DELETE SET NULL;
+-- +goose StatementEnd
@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE "rate_limit"
+(
+    "key" TEXT PRIMARY KEY,
+    "count" INT NOT NULL DEFAULT 0,
+    "last_hit_at" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    "locked_until" TIMESTAMPTZ
+);
+CREATE INDEX "rate_limit_last_hit_at_idx" ON "rate_limit" ("last_hit_at");
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS "rate_limit";
+-- +goose StatementEnd
@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE "user" ADD COLUMN "verified_at" TIMESTAMPTZ;
+
+-- Signed action tokens (e.g. email verification, password reset) are stateless,
+-- only their IDs are stored once used to make them single-use.
+CREATE TABLE "used_action_token"
+(
+    "id" UUID PRIMARY KEY,
+    "expires_at" TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX "used_action_token_expires_at_idx" ON "used_action_token" ("expires_at");
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS "used_action_token";
+ALTER TABLE "user" DROP COLUMN IF EXISTS "verified_at";
+-- +goose StatementEnd
@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE "user" ADD COLUMN "totp_secret" BYTEA;
+ALTER TABLE "user" ADD COLUMN "totp_enabled_at" TIMESTAMPTZ;
+ALTER TABLE "user" ADD COLUMN "totp_last_step" BIGINT NOT NULL DEFAULT 0;
+
+CREATE TABLE "recovery_code"
+(
+    "id" UUID PRIMARY KEY DEFAULT GEN_RANDOM_UUID() CHECK ("id" <> '00000000-0000-0000-0000-000000000000'),
+    "user_id" UUID NOT NULL REFERENCES "user" ON DELETE CASCADE,
+    "code_hash" BYTEA NOT NULL,
+    "used_at" TIMESTAMPTZ,
+    "created_at" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE ("user_id", "code_hash")
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS "recovery_code";
+ALTER TABLE "user" DROP COLUMN IF EXISTS "totp_last_step";
+ALTER TABLE "user" DROP COLUMN IF EXISTS "totp_enabled_at";
+ALTER TABLE "user" DROP COLUMN IF EXISTS "totp_secret";
+-- +goose StatementEnd
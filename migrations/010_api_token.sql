@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE "api_token"
+(
+    "id" UUID PRIMARY KEY DEFAULT GEN_RANDOM_UUID() CHECK ("id" <> '00000000-0000-0000-0000-000000000000'),
+    "user_id" UUID NOT NULL REFERENCES "user" ON DELETE CASCADE,
+    "name" TEXT NOT NULL,
+    "token_hash" BYTEA UNIQUE NOT NULL,
+    "scopes" TEXT NOT NULL,
+    "expires_at" TIMESTAMPTZ,
+    "last_used_at" TIMESTAMPTZ,
+    "created_at" TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX "api_token_user_id_idx" ON "api_token" ("user_id");
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS "api_token";
+-- +goose StatementEnd
@@ -0,0 +1,31 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Promote the first admin manually: UPDATE "user" SET role = 'admin' WHERE email = '...';
+ALTER TABLE "user"
+    ADD COLUMN "role" TEXT NOT NULL DEFAULT 'user' CHECK ("role" IN ('user', 'admin')),
+    ADD COLUMN "disabled_at" TIMESTAMPTZ;
+
+-- Audit log has no foreign keys, so entries outlive deleted users.
+CREATE TABLE "audit_log"
+(
+    "id" UUID PRIMARY KEY DEFAULT GEN_RANDOM_UUID() CHECK ("id" <> '00000000-0000-0000-0000-000000000000'),
+    "actor_id" UUID NOT NULL,
+    "action" TEXT NOT NULL,
+    "target_id" UUID,
+    "details" JSONB NOT NULL DEFAULT '{}',
+    "ip" TEXT NOT NULL,
+    "request_id" TEXT NOT NULL,
+    "created_at" TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX "audit_log_created_at_idx" ON "audit_log" ("created_at");
+CREATE INDEX "audit_log_actor_id_idx" ON "audit_log" ("actor_id");
+CREATE INDEX "audit_log_target_id_idx" ON "audit_log" ("target_id");
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS "audit_log";
+ALTER TABLE "user"
+    DROP COLUMN IF EXISTS "disabled_at",
+    DROP COLUMN IF EXISTS "role";
+-- +goose StatementEnd
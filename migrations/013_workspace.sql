@@ -0,0 +1,47 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE "workspace"
+(
+    "id" UUID PRIMARY KEY DEFAULT GEN_RANDOM_UUID() CHECK ("id" <> '00000000-0000-0000-0000-000000000000'),
+    "name" TEXT NOT NULL CHECK ("name" <> ''),
+    "created_at" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    "updated_at" TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE "workspace_member"
+(
+    "workspace_id" UUID NOT NULL REFERENCES "workspace" ON DELETE CASCADE,
+    "user_id" UUID NOT NULL REFERENCES "user" ON DELETE CASCADE,
+    "role" TEXT NOT NULL CHECK ("role" IN ('owner', 'editor', 'viewer')),
+    "created_at" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    "updated_at" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY ("workspace_id", "user_id")
+);
+CREATE INDEX "workspace_member_user_id_idx" ON "workspace_member" ("user_id");
+
+CREATE TABLE "workspace_invitation"
+(
+    "id" UUID PRIMARY KEY DEFAULT GEN_RANDOM_UUID() CHECK ("id" <> '00000000-0000-0000-0000-000000000000'),
+    "workspace_id" UUID NOT NULL REFERENCES "workspace" ON DELETE CASCADE,
+    "email" TEXT NOT NULL,
+    "role" TEXT NOT NULL CHECK ("role" IN ('owner', 'editor', 'viewer')),
+    "token_hash" BYTEA UNIQUE NOT NULL,
+    "invited_by" UUID REFERENCES "user" ON DELETE SET NULL,
+    "expires_at" TIMESTAMPTZ NOT NULL,
+    "accepted_at" TIMESTAMPTZ,
+    "created_at" TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX "workspace_invitation_workspace_id_idx" ON "workspace_invitation" ("workspace_id");
+
+-- Todos without workspace are personal todos of their user.
+ALTER TABLE "todo" ADD COLUMN "workspace_id" UUID REFERENCES "workspace" ON DELETE CASCADE;
+CREATE INDEX "todo_workspace_id_idx" ON "todo" ("workspace_id");
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE "todo" DROP COLUMN IF EXISTS "workspace_id";
+DROP TABLE IF EXISTS "workspace_invitation";
+DROP TABLE IF EXISTS "workspace_member";
+DROP TABLE IF EXISTS "workspace";
+-- +goose StatementEnd
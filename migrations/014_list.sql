@@ -0,0 +1,29 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Lists belong either to a user (personal lists) or to a workspace.
+CREATE TABLE "list"
+(
+    "id" UUID PRIMARY KEY DEFAULT GEN_RANDOM_UUID() CHECK ("id" <> '00000000-0000-0000-0000-000000000000'),
+    "user_id" UUID REFERENCES "user" ON DELETE CASCADE,
+    "workspace_id" UUID REFERENCES "workspace" ON DELETE CASCADE,
+    "name" TEXT NOT NULL CHECK ("name" <> ''),
+    "color" TEXT,
+    "icon" TEXT,
+    "position" INT NOT NULL DEFAULT 0,
+    "created_at" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    "updated_at" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK (("user_id" IS NULL) <> ("workspace_id" IS NULL))
+);
+CREATE INDEX "list_user_id_idx" ON "list" ("user_id");
+CREATE INDEX "list_workspace_id_idx" ON "list" ("workspace_id");
+
+-- Todos without list are in the inbox.
+ALTER TABLE "todo" ADD COLUMN "list_id" UUID REFERENCES "list" ON DELETE SET NULL;
+CREATE INDEX "todo_list_id_idx" ON "todo" ("list_id");
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE "todo" DROP COLUMN IF EXISTS "list_id";
+DROP TABLE IF EXISTS "list";
+-- +goose StatementEnd
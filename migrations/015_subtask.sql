@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Deleting a todo deletes its subtasks.
+ALTER TABLE "todo" ADD COLUMN "parent_id" UUID REFERENCES "todo" ON DELETE CASCADE CHECK ("parent_id" <> "id");
+ALTER TABLE "todo" ADD COLUMN "auto_complete" BOOLEAN NOT NULL DEFAULT FALSE;
+CREATE INDEX "todo_parent_id_idx" ON "todo" ("parent_id");
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE "todo" DROP COLUMN IF EXISTS "auto_complete";
+ALTER TABLE "todo" DROP COLUMN IF EXISTS "parent_id";
+-- +goose StatementEnd
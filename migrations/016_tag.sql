@@ -0,0 +1,28 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE "tag"
+(
+    "id" UUID PRIMARY KEY DEFAULT GEN_RANDOM_UUID() CHECK ("id" <> '00000000-0000-0000-0000-000000000000'),
+    "user_id" UUID NOT NULL REFERENCES "user" ON DELETE CASCADE,
+    "name" TEXT NOT NULL CHECK ("name" <> ''),
+    "color" TEXT,
+    "created_at" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    "updated_at" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE ("user_id", "name")
+);
+
+-- Tags are personal, so users with access to the same todo each see only their own tags on it.
+CREATE TABLE "todo_tag"
+(
+    "todo_id" UUID NOT NULL REFERENCES "todo" ON DELETE CASCADE,
+    "tag_id" UUID NOT NULL REFERENCES "tag" ON DELETE CASCADE,
+    PRIMARY KEY ("todo_id", "tag_id")
+);
+CREATE INDEX "todo_tag_tag_id_idx" ON "todo_tag" ("tag_id");
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS "todo_tag";
+DROP TABLE IF EXISTS "tag";
+-- +goose StatementEnd
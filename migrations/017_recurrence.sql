@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Recurrence is an RRULE, due dates are computed in the timezone (UTC if NULL).
+ALTER TABLE "todo" ADD COLUMN "recurrence" TEXT;
+ALTER TABLE "todo" ADD COLUMN "timezone" TEXT;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE "todo" DROP COLUMN IF EXISTS "timezone";
+ALTER TABLE "todo" DROP COLUMN IF EXISTS "recurrence";
+-- +goose StatementEnd
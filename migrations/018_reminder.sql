@@ -0,0 +1,29 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Reminders are either at an absolute time, or an offset before the due date of the todo.
+-- fire_at is when the reminder is due, recomputed when the due date changes.
+-- claimed_until is set by the worker sending it, so other workers skip it until then.
+CREATE TABLE "reminder"
+(
+    "id" UUID PRIMARY KEY DEFAULT GEN_RANDOM_UUID() CHECK ("id" <> '00000000-0000-0000-0000-000000000000'),
+    "todo_id" UUID NOT NULL REFERENCES "todo" ON DELETE CASCADE,
+    "user_id" UUID NOT NULL REFERENCES "user" ON DELETE CASCADE,
+    "remind_at" TIMESTAMPTZ,
+    "offset_minutes" INT CHECK ("offset_minutes" >= 0),
+    "fire_at" TIMESTAMPTZ,
+    "attempts" INT NOT NULL DEFAULT 0,
+    "last_error" TEXT,
+    "sent_at" TIMESTAMPTZ,
+    "failed_at" TIMESTAMPTZ,
+    "claimed_until" TIMESTAMPTZ,
+    "created_at" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK (("remind_at" IS NULL) <> ("offset_minutes" IS NULL))
+);
+CREATE INDEX "reminder_todo_id_idx" ON "reminder" ("todo_id");
+CREATE INDEX "reminder_fire_at_idx" ON "reminder" ("fire_at") WHERE "sent_at" IS NULL AND "failed_at" IS NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS "reminder";
+-- +goose StatementEnd
@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Subject matches rank higher than description matches.
+ALTER TABLE "todo" ADD COLUMN "search" TSVECTOR GENERATED ALWAYS AS (
+    SETWEIGHT(TO_TSVECTOR('english', "subject"), 'A') || SETWEIGHT(TO_TSVECTOR('english', "description"), 'B')
+) STORED;
+CREATE INDEX "todo_search_idx" ON "todo" USING GIN ("search");
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS "todo_search_idx";
+ALTER TABLE "todo" DROP COLUMN IF EXISTS "search";
+-- +goose StatementEnd
@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Rank is the manual order of todos, compared bytewise. Existing todos are ranked on their first move.
+ALTER TABLE "todo" ADD COLUMN "rank" TEXT COLLATE "C";
+CREATE INDEX "todo_rank_idx" ON "todo" ("rank");
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS "todo_rank_idx";
+ALTER TABLE "todo" DROP COLUMN IF EXISTS "rank";
+-- +goose StatementEnd
@@ -0,0 +1,10 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Version is incremented on every change of a todo, and returned as its ETag for conditional requests.
+ALTER TABLE "todo" ADD COLUMN "version" INT NOT NULL DEFAULT 1;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE "todo" DROP COLUMN IF EXISTS "version";
+-- +goose StatementEnd
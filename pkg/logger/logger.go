@@ -17,6 +17,10 @@ func Logger(ctx context.Context) *slog.Logger {
 	if v := request.UserIDFromContext(ctx); v != uuid.Nil {
 		logger = logger.With("user_id", v)
 	}
+	// Requests made while impersonating can be traced back to the admin.
+	if v := request.ActorIDFromContext(ctx); v != uuid.Nil {
+		logger = logger.With("actor_id", v)
+	}
 	return logger
 }
 
@@ -2,10 +2,13 @@ package middleware
 
 import (
 	"context"
+	"fmt"
 	"net/http"
+	"slices"
 	"strings"
 
 	"github.com/google/uuid"
+	"github.com/nathansiegfrid/todolist/pkg/logger"
 	"github.com/nathansiegfrid/todolist/pkg/request"
 	"github.com/nathansiegfrid/todolist/pkg/response"
 	"github.com/nathansiegfrid/todolist/pkg/token"
@@ -14,34 +17,89 @@ import (
 var (
 	errHeaderMissing = response.Error(http.StatusUnauthorized, "Authorization header is missing.")
 	errHeaderInvalid = response.Error(http.StatusUnauthorized, "Authorization header is not a Bearer token.")
+	errTokenRevoked  = response.Error(http.StatusUnauthorized, "Token has been revoked.")
+	errScope         = response.Error(http.StatusForbidden, "Token doesn't have the required scope.")
+	errRole          = response.Error(http.StatusForbidden, "User doesn't have the required role.")
 )
 
 type tokenErrorContextKey struct{}
 
-// VerifyAuth middleware verifies the Authorization header and extracts user ID from the token.
-func VerifyAuth(jwtService *token.JWTAuth) func(http.Handler) http.Handler {
-	// TODO: Use cookie-based authentication for web clients.
-	// Cookies support root domain and subdomain sharing.
-	verifyRequest := func(r *http.Request) (uuid.UUID, error) {
+// VerifyAuth middleware verifies the Authorization header, or the access token cookie if the header is absent,
+// and extracts user ID from the token. Tokens revoked in the RevocationStore are rejected.
+// Personal API tokens are accepted in the Authorization header, and limit the request to their scopes.
+// Requests authenticated by cookie should be protected by CSRF middleware.
+func VerifyAuth(
+	jwtService *token.JWTAuth,
+	revocations token.RevocationStore,
+	apiTokens token.APITokenStore,
+) func(http.Handler) http.Handler {
+	readToken := func(r *http.Request) (signedToken string, fromCookie bool, err error) {
 		authHeaderValue := r.Header.Get("Authorization")
 		if authHeaderValue == "" {
-			return uuid.Nil, errHeaderMissing
+			if cookie, err := r.Cookie(token.AccessTokenCookie); err == nil && cookie.Value != "" {
+				return cookie.Value, true, nil
+			}
+			return "", false, errHeaderMissing
 		}
-		token := strings.TrimPrefix(authHeaderValue, "Bearer ")
-		if token == authHeaderValue {
-			return uuid.Nil, errHeaderInvalid
+		signedToken = strings.TrimPrefix(authHeaderValue, "Bearer ")
+		if signedToken == authHeaderValue {
+			return "", false, errHeaderInvalid
 		}
-		return jwtService.VerifyToken(token)
+		return signedToken, false, nil
+	}
+
+	verifyRequest := func(r *http.Request, signedToken string, fromCookie bool) (*token.Claims, error) {
+		if !fromCookie && token.IsAPIToken(signedToken) {
+			return apiTokens.VerifyAPIToken(r.Context(), signedToken)
+		}
+
+		claims, err := jwtService.VerifyToken(signedToken)
+		if err != nil {
+			return nil, err
+		}
+
+		revoked, err := revocations.IsRevoked(r.Context(), claims)
+		if err != nil {
+			logger.Error(r.Context(), fmt.Sprintf("Token revocation check error: %s.", err), "category", "internal_error")
+			return nil, err
+		}
+		if revoked {
+			return nil, errTokenRevoked
+		}
+		return claims, nil
 	}
 
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			ctx := r.Context()
-			userID, err := verifyRequest(r)
+			signedToken, fromCookie, err := readToken(r)
+			var claims *token.Claims
+			if err == nil {
+				claims, err = verifyRequest(r, signedToken, fromCookie)
+			}
 			if err != nil {
 				ctx = context.WithValue(ctx, tokenErrorContextKey{}, err)
 			} else {
-				ctx = request.ContextWithUserID(ctx, userID)
+				ctx = request.ContextWithUserID(ctx, claims.UserID)
+				ctx = request.ContextWithRole(ctx, claims.Role)
+				// Only a verified cookie authenticates the request, so a stale or invalid cookie doesn't make
+				// public routes like login require a CSRF token.
+				if fromCookie {
+					ctx = request.ContextWithCookieAuth(ctx)
+				}
+				switch {
+				case claims.APIToken:
+					ctx = request.ContextWithScopes(ctx, claims.Scopes)
+				case claims.ActorID != uuid.Nil:
+					// Impersonating admins can't manage the account of the user.
+					ctx = request.ContextWithTokenID(ctx, claims.TokenID)
+					ctx = request.ContextWithTokenExpiresAt(ctx, claims.ExpiresAt)
+					ctx = request.ContextWithActorID(ctx, claims.ActorID)
+					ctx = request.ContextWithScopes(ctx, token.GrantableScopes)
+				default:
+					ctx = request.ContextWithTokenID(ctx, claims.TokenID)
+					ctx = request.ContextWithTokenExpiresAt(ctx, claims.ExpiresAt)
+				}
 			}
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
@@ -61,3 +119,38 @@ func RequireAuth(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// RequireAuthScope is a variant of RequireAuth which also checks the scopes of API tokens.
+// Requests with safe methods (GET, HEAD, OPTIONS) need readScope, other requests need writeScope.
+// Access tokens from login have every scope.
+func RequireAuthScope(readScope, writeScope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			scope := writeScope
+			switch r.Method {
+			case "GET", "HEAD", "OPTIONS":
+				scope = readScope
+			}
+			scopes := request.ScopesFromContext(r.Context())
+			if scopes != nil && !slices.Contains(scopes, scope) {
+				response.WriteError(w, response.ErrorResponseFrom(errScope))
+				return
+			}
+			next.ServeHTTP(w, r)
+		}))
+	}
+}
+
+// RequireRole is a variant of RequireAuth which also requires the user to have one of the roles.
+// The role is read from the token, so role changes take effect when the access token is refreshed.
+func RequireRole(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !slices.Contains(roles, request.RoleFromContext(r.Context())) {
+				response.WriteError(w, response.ErrorResponseFrom(errRole))
+				return
+			}
+			next.ServeHTTP(w, r)
+		}))
+	}
+}
@@ -0,0 +1,196 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nathansiegfrid/todolist/pkg/request"
+	"github.com/nathansiegfrid/todolist/pkg/token"
+)
+
+// fakeRevocationStore revokes individual tokens in memory.
+type fakeRevocationStore struct {
+	revoked map[string]bool
+}
+
+func (s *fakeRevocationStore) Revoke(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	s.revoked[tokenID] = true
+	return nil
+}
+
+func (s *fakeRevocationStore) RevokeAllForUser(ctx context.Context, userID uuid.UUID, before time.Time) error {
+	return nil
+}
+
+func (s *fakeRevocationStore) IsRevoked(ctx context.Context, claims *token.Claims) (bool, error) {
+	return s.revoked[claims.TokenID], nil
+}
+
+// authResult is what VerifyAuth put in the request context.
+type authResult struct {
+	userID     uuid.UUID
+	cookieAuth bool
+	err        error
+}
+
+// serveAuth runs the request through the middleware and returns the result seen by the next handler.
+func serveAuth(mw func(http.Handler) http.Handler, r *http.Request) authResult {
+	var res authResult
+	mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		res.userID = request.UserIDFromContext(r.Context())
+		res.cookieAuth = request.CookieAuthFromContext(r.Context())
+		res.err, _ = r.Context().Value(tokenErrorContextKey{}).(error)
+	})).ServeHTTP(httptest.NewRecorder(), r)
+	return res
+}
+
+func TestVerifyAuth(t *testing.T) {
+	jwtAuth, err := token.NewJWTAuth(token.NewHMACKey([]byte("secret")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	revocations := &fakeRevocationStore{revoked: map[string]bool{}}
+	mw := VerifyAuth(jwtAuth, revocations, nil)
+
+	headerUser, cookieUser := uuid.New(), uuid.New()
+	generate := func(userID uuid.UUID) string {
+		signed, err := jwtAuth.GenerateToken(userID, "user", time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+	headerToken, cookieToken, revokedToken := generate(headerUser), generate(cookieUser), generate(headerUser)
+	claims, err := jwtAuth.VerifyToken(revokedToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	revocations.Revoke(context.Background(), claims.TokenID, claims.ExpiresAt)
+
+	tests := []struct {
+		name           string
+		header         string
+		cookie         string
+		wantUserID     uuid.UUID
+		wantCookieAuth bool
+		wantErr        bool
+	}{
+		{"header", "Bearer " + headerToken, "", headerUser, false, false},
+		{"cookie", "", cookieToken, cookieUser, true, false},
+		{"header before cookie", "Bearer " + headerToken, cookieToken, headerUser, false, false},
+		// An invalid header isn't replaced by the cookie.
+		{"invalid header with cookie", "Bearer invalid", cookieToken, uuid.Nil, false, true},
+		{"header without Bearer", headerToken, "", uuid.Nil, false, true},
+		{"invalid cookie", "", "invalid", uuid.Nil, false, true},
+		{"revoked token", "Bearer " + revokedToken, "", uuid.Nil, false, true},
+		{"revoked cookie", "", revokedToken, uuid.Nil, false, true},
+		{"missing", "", "", uuid.Nil, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: token.AccessTokenCookie, Value: tt.cookie})
+			}
+			got := serveAuth(mw, r)
+			if (got.err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error %v", got.err, tt.wantErr)
+			}
+			if got.userID != tt.wantUserID {
+				t.Errorf("user ID = %s, want %s", got.userID, tt.wantUserID)
+			}
+			if got.cookieAuth != tt.wantCookieAuth {
+				t.Errorf("cookie auth = %v, want %v", got.cookieAuth, tt.wantCookieAuth)
+			}
+		})
+	}
+}
+
+// fakeAPITokenStore accepts one API token.
+type fakeAPITokenStore struct {
+	token  string
+	claims *token.Claims
+}
+
+func (s *fakeAPITokenStore) VerifyAPIToken(ctx context.Context, apiToken string) (*token.Claims, error) {
+	if apiToken != s.token {
+		return nil, errHeaderInvalid
+	}
+	return s.claims, nil
+}
+
+func TestVerifyAuthAPIToken(t *testing.T) {
+	jwtAuth, err := token.NewJWTAuth(token.NewHMACKey([]byte("secret")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	apiToken, _, err := token.GenerateAPIToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	userID := uuid.New()
+	apiTokens := &fakeAPITokenStore{apiToken, &token.Claims{UserID: userID, APIToken: true}}
+	mw := VerifyAuth(jwtAuth, &fakeRevocationStore{revoked: map[string]bool{}}, apiTokens)
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", "Bearer "+apiToken)
+	if got := serveAuth(mw, r); got.err != nil || got.userID != userID {
+		t.Errorf("API token in header: user ID = %s, error = %v, want %s", got.userID, got.err, userID)
+	}
+
+	// API tokens aren't accepted as cookies.
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(&http.Cookie{Name: token.AccessTokenCookie, Value: apiToken})
+	if got := serveAuth(mw, r); got.err == nil {
+		t.Errorf("API token in cookie: user ID = %s, want error", got.userID)
+	}
+}
+
+func TestRequireAuthScope(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		scopes     []string // Nil for access tokens.
+		wantStatus int
+	}{
+		{"access token read", http.MethodGet, nil, http.StatusOK},
+		{"access token write", http.MethodPost, nil, http.StatusOK},
+		{"read scope read", http.MethodGet, []string{token.ScopeTodosRead}, http.StatusOK},
+		{"read scope head", http.MethodHead, []string{token.ScopeTodosRead}, http.StatusOK},
+		{"read scope write", http.MethodPatch, []string{token.ScopeTodosRead}, http.StatusForbidden},
+		{"write scope read", http.MethodGet, []string{token.ScopeTodosWrite}, http.StatusForbidden},
+		{"write scope write", http.MethodDelete, []string{token.ScopeTodosWrite}, http.StatusOK},
+		{"both scopes", http.MethodPost, []string{token.ScopeTodosRead, token.ScopeTodosWrite}, http.StatusOK},
+		{"no scopes", http.MethodGet, []string{}, http.StatusForbidden},
+	}
+	mw := RequireAuthScope(token.ScopeTodosRead, token.ScopeTodosWrite)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/", nil)
+			if tt.scopes != nil {
+				r = r.WithContext(request.ContextWithScopes(r.Context(), tt.scopes))
+			}
+			w := httptest.NewRecorder()
+			mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(w, r)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+
+	// Unauthenticated requests are rejected before scopes are checked.
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r = r.WithContext(context.WithValue(r.Context(), tokenErrorContextKey{}, errHeaderMissing))
+	w := httptest.NewRecorder()
+	mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("unauthenticated status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/nathansiegfrid/todolist/pkg/request"
+	"github.com/nathansiegfrid/todolist/pkg/response"
+	"github.com/nathansiegfrid/todolist/pkg/token"
+)
+
+// CSRF middleware rejects unsafe requests authenticated by cookie without a valid CSRF token.
+// Requests authenticated by Authorization header are not vulnerable to CSRF and are let through.
+// It must be used after VerifyAuth middleware.
+func CSRF(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET", "HEAD", "OPTIONS":
+			next.ServeHTTP(w, r)
+			return
+		}
+		if request.CookieAuthFromContext(r.Context()) {
+			if err := token.VerifyCSRF(r); err != nil {
+				response.WriteError(w, response.ErrorResponseFrom(err))
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nathansiegfrid/todolist/pkg/request"
+	"github.com/nathansiegfrid/todolist/pkg/token"
+)
+
+func TestCSRF(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		cookieAuth bool
+		cookie     string
+		header     string
+		wantStatus int
+	}{
+		{"matching token", http.MethodPost, true, "csrf", "csrf", http.StatusOK},
+		{"safe method", http.MethodGet, true, "", "", http.StatusOK},
+		{"authenticated by header", http.MethodPost, false, "", "", http.StatusOK},
+		{"missing header", http.MethodPost, true, "csrf", "", http.StatusForbidden},
+		{"missing cookie", http.MethodDelete, true, "", "csrf", http.StatusForbidden},
+		{"empty tokens", http.MethodPatch, true, "", "", http.StatusForbidden},
+		{"other token", http.MethodPut, true, "csrf", "other", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/", nil)
+			if tt.cookieAuth {
+				r = r.WithContext(request.ContextWithCookieAuth(r.Context()))
+			}
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: token.CSRFTokenCookie, Value: tt.cookie})
+			}
+			if tt.header != "" {
+				r.Header.Set(token.CSRFTokenHeader, tt.header)
+			}
+			w := httptest.NewRecorder()
+			CSRF(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(w, r)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nathansiegfrid/todolist/pkg/mailer"
+)
+
+const webhookTimeout = 10 * time.Second
+
+// SignatureHeader contains the hex HMAC-SHA256 of the webhook body, prefixed with "sha256=".
+const SignatureHeader = "X-Todolist-Signature"
+
+type Notification struct {
+	Type    string         `json:"type"` // E.g. "reminder".
+	UserID  uuid.UUID      `json:"user_id"`
+	Email   string         `json:"email"`
+	Subject string         `json:"subject"`
+	Body    string         `json:"body"` // Plain text.
+	Data    map[string]any `json:"data,omitempty"`
+}
+
+// Notifier delivers notifications to users. Use WebhookNotifier or MailNotifier in production,
+// and LogNotifier for development and tests.
+type Notifier interface {
+	Notify(ctx context.Context, n *Notification) error
+}
+
+// WebhookNotifier posts notifications as JSON to a URL.
+type WebhookNotifier struct {
+	url    string
+	secret []byte
+	client *http.Client
+}
+
+// NewWebhookNotifier creates a WebhookNotifier. If secret is set, requests are signed in SignatureHeader,
+// so the receiver can verify they come from this app.
+func NewWebhookNotifier(url string, secret string) *WebhookNotifier {
+	return &WebhookNotifier{url, []byte(secret), &http.Client{Timeout: webhookTimeout}}
+}
+
+func (n *WebhookNotifier) Notify(ctx context.Context, notification *Notification) error {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(n.secret) > 0 {
+		mac := hmac.New(sha256.New, n.secret)
+		mac.Write(body)
+		req.Header.Set(SignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("post webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("post webhook: unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// MailNotifier sends notifications by email.
+type MailNotifier struct {
+	mailer mailer.Mailer
+}
+
+func NewMailNotifier(m mailer.Mailer) *MailNotifier {
+	return &MailNotifier{m}
+}
+
+func (n *MailNotifier) Notify(ctx context.Context, notification *Notification) error {
+	return n.mailer.Send(ctx, &mailer.Message{
+		To:      notification.Email,
+		Subject: notification.Subject,
+		Body:    notification.Body,
+	})
+}
+
+// LogNotifier writes notifications to the default logger instead of delivering them.
+type LogNotifier struct{}
+
+func (LogNotifier) Notify(_ context.Context, n *Notification) error {
+	slog.Info(
+		fmt.Sprintf("Notification to %s: %s.", n.Email, n.Subject),
+		"category", "notification",
+		"type", n.Type,
+		"body", n.Body,
+	)
+	return nil
+}
@@ -0,0 +1,202 @@
+package oidc
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/nathansiegfrid/todolist/pkg/token"
+)
+
+const fakeCodeDuration = time.Minute
+
+// FakeProvider is a minimal in-process OpenID provider for development and integration tests.
+// It has no login page: the authorization endpoint immediately redirects back with a code for the user
+// given in "login_hint" (default "user@example.com"), whose email is considered verified.
+// It must never be enabled in production, since anyone can log in as any email.
+type FakeProvider struct {
+	issuer   string
+	clientID string
+	key      *token.Key
+
+	mu    sync.Mutex
+	codes map[string]*fakeCode
+}
+
+type fakeCode struct {
+	email         string
+	nonce         string
+	redirectURL   string
+	codeChallenge string
+	expiresAt     time.Time
+}
+
+// NewFakeProvider creates a provider with a new Ed25519 signing key.
+// The issuer must be the URL where the provider's Handler is served.
+func NewFakeProvider(issuer, clientID string) (*FakeProvider, error) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	key, err := token.NewKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	return &FakeProvider{
+		issuer:   strings.TrimSuffix(issuer, "/"),
+		clientID: clientID,
+		key:      key,
+		codes:    make(map[string]*fakeCode),
+	}, nil
+}
+
+// Handler serves the discovery document and the endpoints of the provider.
+func (f *FakeProvider) Handler() http.Handler {
+	router := chi.NewRouter()
+	router.Get("/.well-known/openid-configuration", f.handleDiscovery)
+	router.Get("/authorize", f.handleAuthorize)
+	router.Post("/token", f.handleToken)
+	router.Get("/jwks", f.handleJWKS)
+	return router
+}
+
+func (f *FakeProvider) handleDiscovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                                f.issuer,
+		"authorization_endpoint":                f.issuer + "/authorize",
+		"token_endpoint":                        f.issuer + "/token",
+		"jwks_uri":                              f.issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"EdDSA"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (f *FakeProvider) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	redirectURL, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil || !redirectURL.IsAbs() {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	if query.Get("client_id") != f.clientID || query.Get("response_type") != "code" ||
+		query.Get("code_challenge") == "" || query.Get("code_challenge_method") != "S256" {
+		http.Error(w, "invalid authorization request", http.StatusBadRequest)
+		return
+	}
+
+	email := strings.ToLower(query.Get("login_hint"))
+	if email == "" {
+		email = "user@example.com"
+	}
+	code, err := GenerateRandom()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	f.mu.Lock()
+	for k, c := range f.codes {
+		if time.Now().After(c.expiresAt) {
+			delete(f.codes, k)
+		}
+	}
+	f.codes[code] = &fakeCode{
+		email:         email,
+		nonce:         query.Get("nonce"),
+		redirectURL:   redirectURL.String(),
+		codeChallenge: query.Get("code_challenge"),
+		expiresAt:     time.Now().Add(fakeCodeDuration),
+	}
+	f.mu.Unlock()
+
+	redirectQuery := redirectURL.Query()
+	redirectQuery.Set("code", code)
+	redirectQuery.Set("state", query.Get("state"))
+	redirectURL.RawQuery = redirectQuery.Encode()
+	http.Redirect(w, r, redirectURL.String(), http.StatusFound)
+}
+
+func (f *FakeProvider) handleToken(w http.ResponseWriter, r *http.Request) {
+	tokenError := func(code, description string) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": code, "error_description": description})
+	}
+
+	if err := r.ParseForm(); err != nil {
+		tokenError("invalid_request", err.Error())
+		return
+	}
+	if r.PostForm.Get("grant_type") != "authorization_code" {
+		tokenError("unsupported_grant_type", "only authorization_code is supported")
+		return
+	}
+	clientID := r.PostForm.Get("client_id")
+	if id, _, ok := r.BasicAuth(); ok {
+		clientID, _ = url.QueryUnescape(id)
+	}
+	if clientID != f.clientID {
+		tokenError("invalid_client", "unknown client")
+		return
+	}
+
+	// Codes are single-use, remove it even if the request turns out to be invalid.
+	f.mu.Lock()
+	c := f.codes[r.PostForm.Get("code")]
+	delete(f.codes, r.PostForm.Get("code"))
+	f.mu.Unlock()
+	if c == nil || time.Now().After(c.expiresAt) || c.redirectURL != r.PostForm.Get("redirect_uri") {
+		tokenError("invalid_grant", "code is invalid or has expired")
+		return
+	}
+	if !isS256Challenge(c.codeChallenge, r.PostForm.Get("code_verifier")) {
+		tokenError("invalid_grant", "code verifier doesn't match the code challenge")
+		return
+	}
+
+	now := time.Now()
+	idToken, err := f.key.Sign(jwt.MapClaims{
+		"iss":            f.issuer,
+		"sub":            "fake|" + c.email,
+		"aud":            f.clientID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"nonce":          c.nonce,
+		"email":          c.email,
+		"email_verified": true,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	accessToken, err := GenerateRandom()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	})
+}
+
+func (f *FakeProvider) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, token.JWKSet{Keys: []token.JWK{f.key.JWK()}})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
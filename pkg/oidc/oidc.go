@@ -0,0 +1,296 @@
+// Package oidc implements the OpenID Connect authorization code flow with PKCE for a single provider.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/nathansiegfrid/todolist/pkg/token"
+)
+
+// keysRefreshInterval limits how often unknown key IDs cause the key set to be fetched again.
+const keysRefreshInterval = time.Minute
+
+var errUnknownKey = errors.New("unknown key ID")
+
+// Config configures the client registered at the provider.
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string // Optional for public clients, PKCE protects the code exchange.
+	RedirectURL  string
+	Scopes       []string // Defaults to "openid email profile".
+	HTTPClient   *http.Client
+}
+
+// Provider is an OpenID provider. Its endpoints are discovered on first use and cached.
+type Provider struct {
+	config Config
+	client *http.Client
+
+	mu            sync.Mutex
+	metadata      *metadata
+	keys          map[string]any // Verification keys by ID.
+	keysFetchedAt time.Time
+}
+
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// IDToken contains the verified claims of an ID token used to identify the user.
+type IDToken struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+}
+
+func NewProvider(config Config) *Provider {
+	config.Issuer = strings.TrimSuffix(config.Issuer, "/")
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"openid", "email", "profile"}
+	}
+	client := config.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &Provider{config: config, client: client}
+}
+
+// Issuer returns the issuer identifier, which together with the subject identifies a user.
+func (p *Provider) Issuer() string {
+	return p.config.Issuer
+}
+
+// AuthCodeURL returns the URL of the provider's login page. The user is redirected back to RedirectURL
+// with the state and an authorization code, which is exchanged using the code verifier.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, codeVerifier, loginHint string) (string, error) {
+	m, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	challenge := sha256.Sum256([]byte(codeVerifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.config.ClientID},
+		"redirect_uri":          {p.config.RedirectURL},
+		"scope":                 {strings.Join(p.config.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	if loginHint != "" {
+		query.Set("login_hint", loginHint)
+	}
+
+	sep := "?"
+	if strings.Contains(m.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return m.AuthorizationEndpoint + sep + query.Encode(), nil
+}
+
+// Exchange redeems the authorization code at the token endpoint, and returns the verified ID token.
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*IDToken, error) {
+	m, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.config.RedirectURL},
+		"client_id":     {p.config.ClientID},
+		"code_verifier": {codeVerifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", m.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+
+	var resBody struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	status, err := p.do(req, &resBody)
+	if err != nil {
+		return nil, err
+	}
+	if resBody.Error != "" {
+		return nil, fmt.Errorf("token endpoint: %s: %s", resBody.Error, resBody.ErrorDescription)
+	}
+	if status != http.StatusOK || resBody.IDToken == "" {
+		return nil, fmt.Errorf("token endpoint: unexpected response with status %d", status)
+	}
+
+	return p.verifyIDToken(ctx, m, resBody.IDToken, nonce)
+}
+
+func (p *Provider) verifyIDToken(ctx context.Context, m *metadata, rawIDToken, nonce string) (*IDToken, error) {
+	var claims struct {
+		jwt.RegisteredClaims
+		Nonce         string `json:"nonce"`
+		Email         string `json:"email"`
+		EmailVerified any    `json:"email_verified"` // Some providers send a string.
+	}
+	_, err := jwt.ParseWithClaims(rawIDToken, &claims,
+		func(t *jwt.Token) (any, error) {
+			kid, _ := t.Header["kid"].(string)
+			return p.key(ctx, m, kid)
+		},
+		jwt.WithValidMethods([]string{"RS256", "ES256", "EdDSA"}),
+		jwt.WithIssuer(m.Issuer),
+		jwt.WithAudience(p.config.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("verify ID token: %w", err)
+	}
+	// Nonce ties the ID token to the login started by this browser, so it can't be replayed.
+	if claims.Nonce == "" || claims.Nonce != nonce {
+		return nil, errors.New("verify ID token: nonce mismatch")
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("verify ID token: subject is missing")
+	}
+
+	return &IDToken{
+		Issuer:        m.Issuer,
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified == true || claims.EmailVerified == "true",
+	}, nil
+}
+
+func (p *Provider) discover(ctx context.Context) (*metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", p.config.Issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	m := &metadata{}
+	status, err := p.do(req, m)
+	if err != nil {
+		return nil, fmt.Errorf("discover %s: %w", p.config.Issuer, err)
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("discover %s: unexpected status %d", p.config.Issuer, status)
+	}
+	// Issuer must match exactly, otherwise ID tokens from another issuer could be accepted.
+	if m.Issuer != p.config.Issuer {
+		return nil, fmt.Errorf("discover %s: issuer mismatch %s", p.config.Issuer, m.Issuer)
+	}
+	if m.AuthorizationEndpoint == "" || m.TokenEndpoint == "" || m.JWKSURI == "" {
+		return nil, fmt.Errorf("discover %s: missing endpoints", p.config.Issuer)
+	}
+	p.metadata = m
+	return m, nil
+}
+
+// key returns the verification key with the ID. The key set is fetched again if the key is unknown,
+// since the provider may have rotated its keys.
+func (p *Provider) key(ctx context.Context, m *metadata, kid string) (any, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	lookup := func() (any, error) {
+		if k, ok := p.keys[kid]; ok {
+			return k, nil
+		}
+		// Key ID is optional if the provider has a single key.
+		if kid == "" && len(p.keys) == 1 {
+			for _, k := range p.keys {
+				return k, nil
+			}
+		}
+		return nil, errUnknownKey
+	}
+	if k, err := lookup(); err == nil || time.Since(p.keysFetchedAt) < keysRefreshInterval {
+		return k, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", m.JWKSURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	set := &token.JWKSet{}
+	status, err := p.do(req, set)
+	if err != nil {
+		return nil, fmt.Errorf("fetch JWKS: %w", err)
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("fetch JWKS: unexpected status %d", status)
+	}
+
+	p.keys = make(map[string]any)
+	p.keysFetchedAt = time.Now()
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		// Skip unsupported keys instead of failing, the provider may publish keys for other algorithms.
+		if k, err := jwk.PublicKey(); err == nil {
+			p.keys[jwk.Kid] = k
+		}
+	}
+	return lookup()
+}
+
+func (p *Provider) do(req *http.Request, v any) (int, error) {
+	res, err := p.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	// Error responses may not be JSON, the caller checks the status code.
+	if err := json.NewDecoder(res.Body).Decode(v); err != nil && res.StatusCode == http.StatusOK {
+		return res.StatusCode, err
+	}
+	return res.StatusCode, nil
+}
+
+// GenerateRandom returns a random URL-safe string for state, nonce and PKCE code verifier.
+func GenerateRandom() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// isS256Challenge reports whether the challenge is the S256 PKCE challenge of the verifier.
+func isS256Challenge(challenge, verifier string) bool {
+	sum := sha256.Sum256([]byte(verifier))
+	return challenge == base64.RawURLEncoding.EncodeToString(sum[:])
+}
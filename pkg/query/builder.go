@@ -0,0 +1,103 @@
+package query
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Builder builds the WHERE clause of a query. Columns and conditions are written by the caller,
+// and values are always passed as args, so URL query can't inject SQL.
+type Builder struct {
+	where []string
+	args  []any
+}
+
+// NewBuilder creates a Builder. Args are numbered from $1, so conditions can refer to them.
+func NewBuilder(args ...any) *Builder {
+	return &Builder{args: args}
+}
+
+// Arg adds an arg and returns its placeholder, e.g. "$2".
+func (b *Builder) Arg(v any) string {
+	b.args = append(b.args, v)
+	return fmt.Sprintf("$%d", len(b.args))
+}
+
+// Where adds a condition.
+func (b *Builder) Where(cond string) {
+	b.where = append(b.where, cond)
+}
+
+// SQL returns the conditions joined with AND, or TRUE if there's none.
+func (b *Builder) SQL() string {
+	if len(b.where) == 0 {
+		return "TRUE"
+	}
+	return strings.Join(b.where, " AND ")
+}
+
+func (b *Builder) Args() []any {
+	return b.args
+}
+
+// Fingerprint returns a hash of the conditions and args added so far. Cursors are bound to it,
+// so a cursor can't be used with other filters.
+func (b *Builder) Fingerprint() string {
+	args, _ := json.Marshal(b.args)
+	sum := sha256.Sum256([]byte(b.SQL() + "\x00" + string(args)))
+	return base64.RawURLEncoding.EncodeToString(sum[:16])
+}
+
+// Where adds conditions of the filter on the column. It does nothing if the filter is nil.
+func Where[T Value](b *Builder, column string, f *Filter[T]) {
+	if f == nil {
+		return
+	}
+	for _, cond := range f.Conds {
+		col, cast := column, ""
+		if cond.Date {
+			col, cast = column+"::date", "::date"
+		}
+
+		switch {
+		case cond.Null && cond.Op == Eq:
+			b.Where(col + " IS NULL")
+		case cond.Null && cond.Op == Ne:
+			b.Where(col + " IS NOT NULL")
+		case cond.Op == Eq:
+			b.Where(col + " = " + b.Arg(cond.Values[0]) + cast)
+		case cond.Op == Ne:
+			b.Where(col + " IS DISTINCT FROM " + b.Arg(cond.Values[0]) + cast)
+		case cond.Op == Lt:
+			b.Where(col + " < " + b.Arg(cond.Values[0]) + cast)
+		case cond.Op == Lte:
+			b.Where(col + " <= " + b.Arg(cond.Values[0]) + cast)
+		case cond.Op == Gt:
+			b.Where(col + " > " + b.Arg(cond.Values[0]) + cast)
+		case cond.Op == Gte:
+			b.Where(col + " >= " + b.Arg(cond.Values[0]) + cast)
+		case cond.Op == Between:
+			b.Where(col + " BETWEEN " + b.Arg(cond.Values[0]) + cast + " AND " + b.Arg(cond.Values[1]) + cast)
+		case cond.Op == In:
+			b.Where(fmt.Sprintf("%s = ANY(%s%s)", col, b.Arg(cond.Values), arrayCast(cast)))
+		case cond.Op == Contains:
+			b.Where(col + " ILIKE " + b.Arg("%"+EscapeLike(fmt.Sprint(cond.Values[0]))+"%"))
+		}
+	}
+}
+
+// arrayCast returns the cast of an array arg, e.g. "::date[]".
+func arrayCast(cast string) string {
+	if cast == "" {
+		return ""
+	}
+	return cast + "[]"
+}
+
+// EscapeLike escapes LIKE wildcards, so the value only matches literally.
+func EscapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
@@ -0,0 +1,234 @@
+package query
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nathansiegfrid/todolist/pkg/response"
+	"github.com/nathansiegfrid/todolist/pkg/token"
+)
+
+// Default and maximum number of rows in a page.
+const (
+	DefaultLimit = 50
+	MaxLimit     = 200
+)
+
+// ErrCursor is returned by DecodeCursor for cursors that are malformed, tampered with,
+// or made for another sort or filters.
+var ErrCursor = response.Error(http.StatusBadRequest, "Invalid cursor. Cursors can only be used with the same sort and filters.")
+
+// Limit returns the number of rows in a page for the requested limit.
+func Limit(limit int) int {
+	if limit <= 0 {
+		return DefaultLimit
+	}
+	return min(limit, MaxLimit)
+}
+
+// SortKey is a column of ORDER BY.
+type SortKey struct {
+	Name     string // Name of the field in the sort param.
+	Column   string // SQL expression.
+	Type     string // SQL type of the column, cursor values are cast into it.
+	Desc     bool
+	Nullable bool // NULLs are last in both directions.
+}
+
+// Sort is an ORDER BY for keyset pagination. Its last key must be unique, e.g. the ID,
+// so every row has a distinct position.
+type Sort []SortKey
+
+// ParseSort parses a sort param like "-priority,due_date" into the allowed keys, "-" for descending,
+// and adds the tiebreaker key. Fields can't be repeated.
+func ParseSort(param string, allowed []SortKey, tiebreaker SortKey) (Sort, error) {
+	var s Sort
+	for _, field := range strings.Split(param, ",") {
+		name, desc := strings.CutPrefix(strings.TrimSpace(field), "-")
+		if slices.ContainsFunc(s, func(key SortKey) bool { return key.Name == name }) {
+			return nil, fmt.Errorf("field '%s' is repeated", name)
+		}
+		i := slices.IndexFunc(allowed, func(key SortKey) bool { return key.Name == name })
+		if i < 0 {
+			names := make([]string, len(allowed))
+			for i, key := range allowed {
+				names[i] = key.Name
+			}
+			return nil, fmt.Errorf("invalid field '%s', allowed fields are %s", name, strings.Join(names, ", "))
+		}
+		key := allowed[i]
+		key.Desc = desc
+		s = append(s, key)
+	}
+	return append(s, tiebreaker), nil
+}
+
+// OrderBy returns the ORDER BY expressions, in reverse if the page is before a cursor.
+func (s Sort) OrderBy(c *Cursor) string {
+	reverse := c != nil && c.Before
+	keys := make([]string, len(s))
+	for i, key := range s {
+		if key.Desc != reverse {
+			keys[i] = key.Column + " DESC"
+		} else {
+			keys[i] = key.Column + " ASC"
+		}
+		if key.Nullable && reverse {
+			keys[i] += " NULLS FIRST"
+		} else if key.Nullable {
+			keys[i] += " NULLS LAST"
+		}
+	}
+	return strings.Join(keys, ", ")
+}
+
+// Cursor is the position of a row in a sorted list. The page starts after the row, or ends before it if Before is set.
+type Cursor struct {
+	Values    []*string `json:"v"` // Values of the sort keys of the row as text, nil for NULL.
+	Before    bool      `json:"b,omitempty"`
+	Inclusive bool      `json:"i,omitempty"` // The page includes the row.
+}
+
+// EncodeCursor signs the cursor, or returns empty string if it's nil. The cursor is bound to the sort
+// and to filters, a Builder.Fingerprint of the conditions, so it can't be used with others.
+func EncodeCursor(signer *token.Signer, s Sort, filters string, c *Cursor) string {
+	if c == nil {
+		return ""
+	}
+	payload, _ := json.Marshal(c)
+	return signer.Sign(payload, []byte("cursor"), []byte(s.OrderBy(nil)), []byte(filters))
+}
+
+// DecodeCursor verifies the cursor made by EncodeCursor with the same sort and filters,
+// or returns nil if it's empty.
+func DecodeCursor(signer *token.Signer, s Sort, filters string, signed string) (*Cursor, error) {
+	if signed == "" {
+		return nil, nil
+	}
+	payload, err := signer.Verify(signed, []byte("cursor"), []byte(s.OrderBy(nil)), []byte(filters))
+	if err != nil {
+		return nil, ErrCursor
+	}
+	c := &Cursor{}
+	if err := json.Unmarshal(payload, c); err != nil || len(c.Values) != len(s) {
+		return nil, ErrCursor
+	}
+	return c, nil
+}
+
+// After adds the condition for rows after the cursor in the sort, or before it if the cursor is Before.
+// It does nothing if the cursor is nil.
+func After(b *Builder, s Sort, c *Cursor) {
+	if c == nil {
+		return
+	}
+	// E.g. "(a > $1) OR (a = $1 AND id > $2)", which unlike "(a, id) > ($1, $2)" supports mixed directions and NULLs.
+	var or []string
+	for i, key := range s {
+		// NULLs are last, so nothing is after NULL.
+		if c.Values[i] == nil && !c.Before {
+			continue
+		}
+
+		var and []string
+		for j := range i {
+			if c.Values[j] == nil {
+				and = append(and, s[j].Column+" IS NULL")
+			} else {
+				and = append(and, fmt.Sprintf("%s = %s::TEXT::%s", s[j].Column, b.Arg(*c.Values[j]), s[j].Type))
+			}
+		}
+
+		// NULLs are last, so they're after any value.
+		if c.Values[i] == nil {
+			and = append(and, key.Column+" IS NOT NULL")
+		} else {
+			op := ">"
+			if key.Desc != c.Before {
+				op = "<"
+			}
+			// The last key is unique, so only the cursor row is equal in all keys.
+			if c.Inclusive && i == len(s)-1 {
+				op += "="
+			}
+			cond := fmt.Sprintf("%s %s %s::TEXT::%s", key.Column, op, b.Arg(*c.Values[i]), key.Type)
+			if key.Nullable && !c.Before {
+				cond = "(" + cond + " OR " + key.Column + " IS NULL)"
+			}
+			and = append(and, cond)
+		}
+		or = append(or, "("+strings.Join(and, " AND ")+")")
+	}
+	if len(or) == 0 {
+		b.Where("FALSE")
+		return
+	}
+	b.Where("(" + strings.Join(or, " OR ") + ")")
+}
+
+// Paginate trims rows queried with limit+1 to the page, in sort order, and returns the cursors
+// of the pages after and before it, nil if there's none. Values returns the sort key values of a row.
+func Paginate[T any](rows []T, limit int, c *Cursor, values func(T) []any) ([]T, *Cursor, *Cursor) {
+	more := len(rows) > limit
+	if more {
+		rows = rows[:limit]
+	}
+	if c != nil && c.Before {
+		slices.Reverse(rows)
+	}
+	if len(rows) == 0 {
+		// Nothing is before or after the cursor row, e.g. it was the first row and rows were added before it
+		// since. Link to the pages from the cursor row, so the client isn't stranded.
+		if c != nil && c.Before {
+			return rows, &Cursor{Values: c.Values, Inclusive: true}, nil
+		}
+		if c != nil {
+			return rows, nil, &Cursor{Values: c.Values, Before: true, Inclusive: true}
+		}
+		return rows, nil, nil
+	}
+
+	// A page before the cursor always has the cursor row after it, and a page after the cursor has it before.
+	hasNext, hasPrev := more, c != nil
+	if c != nil && c.Before {
+		hasNext, hasPrev = true, more
+	}
+
+	var next, prev *Cursor
+	if hasNext {
+		next = &Cursor{Values: cursorValues(values(rows[len(rows)-1]))}
+	}
+	if hasPrev {
+		prev = &Cursor{Values: cursorValues(values(rows[0])), Before: true}
+	}
+	return rows, next, prev
+}
+
+// cursorValues formats values as text, which is cast back into the column type by After.
+func cursorValues(values []any) []*string {
+	texts := make([]*string, len(values))
+	for i, v := range values {
+		if valuer, ok := v.(driver.Valuer); ok {
+			v, _ = valuer.Value()
+		}
+		var text string
+		switch v := v.(type) {
+		case nil:
+			continue
+		case time.Time:
+			text = v.Format(time.RFC3339Nano)
+		case float64:
+			text = strconv.FormatFloat(v, 'g', -1, 64)
+		default:
+			text = fmt.Sprint(v)
+		}
+		texts[i] = &text
+	}
+	return texts
+}
@@ -0,0 +1,157 @@
+package query
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/nathansiegfrid/todolist/pkg/token"
+)
+
+var testSort = Sort{{Name: "priority", Column: "priority", Type: "INT"}, {Name: "id", Column: "id", Type: "UUID"}}
+
+func TestDecodeCursor(t *testing.T) {
+	signer := token.NewSigner([]byte("secret"))
+	c := &Cursor{Values: []*string{ptr("1"), ptr("a")}, Before: true}
+	signed := EncodeCursor(signer, testSort, "filters", c)
+
+	tests := []struct {
+		name    string
+		signer  *token.Signer
+		sort    Sort
+		filters string
+		signed  string
+		wantErr bool
+	}{
+		{"valid", signer, testSort, "filters", signed, false},
+		{"empty", signer, testSort, "filters", "", false},
+		{"other filters", signer, testSort, "other", signed, true},
+		{"other sort", signer, Sort{testSort[1], testSort[0]}, "filters", signed, true},
+		{"other secret", token.NewSigner([]byte("other")), testSort, "filters", signed, true},
+		{"tampered", signer, testSort, "filters", tamper(signed), true},
+		{"malformed", signer, testSort, "filters", "cursor", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecodeCursor(tt.signer, tt.sort, tt.filters, tt.signed)
+			if tt.wantErr {
+				if !errors.Is(err, ErrCursor) {
+					t.Errorf("error = %v, want ErrCursor", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.signed == "" {
+				if got != nil {
+					t.Errorf("cursor = %+v, want nil", got)
+				}
+				return
+			}
+			if *got.Values[0] != "1" || *got.Values[1] != "a" || !got.Before {
+				t.Errorf("cursor = %+v, want %+v", got, c)
+			}
+		})
+	}
+}
+
+func TestBuilderFingerprint(t *testing.T) {
+	build := func(priority int) *Builder {
+		b := NewBuilder()
+		b.Where("priority = " + b.Arg(priority))
+		return b
+	}
+	if build(1).Fingerprint() != build(1).Fingerprint() {
+		t.Error("same filters have different fingerprints")
+	}
+	if build(1).Fingerprint() == build(2).Fingerprint() {
+		t.Error("different args have the same fingerprint")
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	values := func(n int) []any { return []any{n, n} }
+	after := &Cursor{Values: []*string{ptr("0"), ptr("0")}}
+	before := &Cursor{Values: []*string{ptr("9"), ptr("9")}, Before: true}
+
+	tests := []struct {
+		name     string
+		rows     []int
+		cursor   *Cursor
+		wantRows []int
+		wantNext *Cursor
+		wantPrev *Cursor
+	}{
+		{"first page", []int{1, 2, 3}, nil, []int{1, 2}, &Cursor{Values: []*string{ptr("2"), ptr("2")}}, nil},
+		{"only page", []int{1, 2}, nil, []int{1, 2}, nil, nil},
+		{"empty", nil, nil, []int{}, nil, nil},
+		{"after", []int{1, 2}, after, []int{1, 2}, nil, &Cursor{Values: []*string{ptr("1"), ptr("1")}, Before: true}},
+		{"before", []int{8, 7, 6}, before, []int{7, 8}, &Cursor{Values: []*string{ptr("8"), ptr("8")}}, &Cursor{Values: []*string{ptr("7"), ptr("7")}, Before: true}},
+		{"empty after", nil, after, []int{}, nil, &Cursor{Values: after.Values, Before: true, Inclusive: true}},
+		{"empty before", nil, before, []int{}, &Cursor{Values: before.Values, Inclusive: true}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, next, prev := Paginate(slices.Clone(tt.rows), 2, tt.cursor, values)
+			if !slices.Equal(rows, tt.wantRows) && !(len(rows) == 0 && len(tt.wantRows) == 0) {
+				t.Errorf("rows = %v, want %v", rows, tt.wantRows)
+			}
+			if !equalCursor(next, tt.wantNext) {
+				t.Errorf("next = %s, want %s", formatCursor(next), formatCursor(tt.wantNext))
+			}
+			if !equalCursor(prev, tt.wantPrev) {
+				t.Errorf("prev = %s, want %s", formatCursor(prev), formatCursor(tt.wantPrev))
+			}
+		})
+	}
+}
+
+func TestAfterInclusive(t *testing.T) {
+	b := NewBuilder()
+	After(b, testSort, &Cursor{Values: []*string{ptr("1"), ptr("a")}, Inclusive: true})
+	if sql := b.SQL(); !strings.Contains(sql, "id >= ") || strings.Contains(sql, "priority >= ") {
+		t.Errorf("SQL = %q, want only the last key inclusive", sql)
+	}
+}
+
+func ptr(s string) *string {
+	return &s
+}
+
+// tamper changes the first character of the payload.
+func tamper(signed string) string {
+	if signed[0] == 'A' {
+		return "B" + signed[1:]
+	}
+	return "A" + signed[1:]
+}
+
+func equalCursor(a, b *Cursor) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return formatCursor(a) == formatCursor(b)
+}
+
+func formatCursor(c *Cursor) string {
+	if c == nil {
+		return "nil"
+	}
+	values := make([]string, len(c.Values))
+	for i, v := range c.Values {
+		values[i] = "NULL"
+		if v != nil {
+			values[i] = *v
+		}
+	}
+	var flags string
+	if c.Before {
+		flags += " before"
+	}
+	if c.Inclusive {
+		flags += " inclusive"
+	}
+	return "[" + strings.Join(values, ",") + "]" + flags
+}
@@ -0,0 +1,210 @@
+package query
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Operators of filters in URL query, e.g. "priority[gte]=2". A key without operator is "eq".
+const (
+	Eq       = "eq"       // Also "null".
+	Ne       = "ne"       // Also "null".
+	Lt       = "lt"       // Numbers and times only.
+	Lte      = "lte"      // Numbers and times only.
+	Gt       = "gt"       // Numbers and times only.
+	Gte      = "gte"      // Numbers and times only.
+	In       = "in"       // Comma-separated values.
+	Between  = "between"  // Two comma-separated values, inclusive. Numbers and times only.
+	Contains = "contains" // Case-insensitive part of the value. Strings only.
+)
+
+// Value is the type of values a Filter can compare with.
+type Value interface {
+	int | string | time.Time | uuid.UUID
+}
+
+// Cond is a single condition of a Filter.
+type Cond[T Value] struct {
+	Op     string `json:"op"`
+	Values []T    `json:"values,omitempty"`
+	Null   bool   `json:"null,omitempty"` // Compare with NULL, for "eq" and "ne".
+	Date   bool   `json:"date,omitempty"` // Compare dates only, for times given as "2006-01-02".
+}
+
+// Filter is a field of a URL query struct with operators, e.g. "due_date[gte]=2024-01-01&due_date[lt]=2024-02-01".
+// Use pointers to Filter in the struct, they're nil if the field isn't in the URL query.
+// Filters are decoded by request.ReadURLQuery, and translated into SQL by Where.
+type Filter[T Value] struct {
+	Conds []Cond[T]
+}
+
+// Equal returns a Filter matching the value.
+func Equal[T Value](v T) *Filter[T] {
+	return &Filter[T]{[]Cond[T]{{Op: Eq, Values: []T{v}}}}
+}
+
+func (f *Filter[T]) MarshalJSON() ([]byte, error) {
+	return json.Marshal(f.Conds)
+}
+
+func (f *Filter[T]) decode(op string, raw string) error {
+	var zero T
+	_, isString := any(zero).(string)
+	_, isUUID := any(zero).(uuid.UUID)
+
+	cond := Cond[T]{Op: op}
+	switch op {
+	case Eq, Ne:
+		if raw == "null" {
+			cond.Null = true
+			break
+		}
+		values, date, err := parseValues[T]([]string{raw})
+		if err != nil {
+			return err
+		}
+		cond.Values, cond.Date = values, date
+	case Lt, Lte, Gt, Gte, Between:
+		if isString || isUUID {
+			return fmt.Errorf("operator '%s' is only supported for numbers and times", op)
+		}
+		raws := []string{raw}
+		if op == Between {
+			raws = strings.Split(raw, ",")
+			if len(raws) != 2 {
+				return errors.New("operator 'between' needs two comma-separated values")
+			}
+		}
+		values, date, err := parseValues[T](raws)
+		if err != nil {
+			return err
+		}
+		cond.Values, cond.Date = values, date
+	case In:
+		values, date, err := parseValues[T](strings.Split(raw, ","))
+		if err != nil {
+			return err
+		}
+		cond.Values, cond.Date = values, date
+	case Contains:
+		if !isString {
+			return errors.New("operator 'contains' is only supported for text")
+		}
+		cond.Values = []T{any(raw).(T)}
+	default:
+		return fmt.Errorf("unknown operator '%s'", op)
+	}
+	f.Conds = append(f.Conds, cond)
+	return nil
+}
+
+// parseValues parses raw values, and returns whether they're all dates without time.
+// Dates can't be mixed with times.
+func parseValues[T Value](raws []string) ([]T, bool, error) {
+	values := make([]T, len(raws))
+	dates := 0
+	for i, raw := range raws {
+		switch v := any(&values[i]).(type) {
+		case *int:
+			n, err := strconv.Atoi(raw)
+			if err != nil {
+				return nil, false, fmt.Errorf("invalid number '%s'", raw)
+			}
+			*v = n
+		case *string:
+			*v = raw
+		case *time.Time:
+			t, err := time.Parse(time.RFC3339, raw)
+			if err != nil {
+				t, err = time.Parse(time.DateOnly, raw)
+				if err != nil {
+					return nil, false, fmt.Errorf("invalid time '%s', use RFC 3339 or YYYY-MM-DD", raw)
+				}
+				dates++
+			}
+			*v = t
+		case *uuid.UUID:
+			id, err := uuid.Parse(raw)
+			if err != nil {
+				return nil, false, fmt.Errorf("invalid ID '%s'", raw)
+			}
+			*v = id
+		}
+	}
+	if dates > 0 && dates < len(raws) {
+		return nil, false, errors.New("dates can't be mixed with times")
+	}
+	return values, dates > 0, nil
+}
+
+type decoder interface {
+	decode(op string, raw string) error
+}
+
+var decoderType = reflect.TypeFor[decoder]()
+
+// DecodeURLQuery decodes keys of Filter fields in dst, a pointer to struct with `schema` tags, and removes them
+// from the URL query. Operators on other fields are reported as errors, together with invalid filters.
+// The errors are keyed by URL query key.
+func DecodeURLQuery(dst any, query url.Values) map[string]string {
+	errs := map[string]string{}
+	v := reflect.ValueOf(dst).Elem()
+	for i := range v.NumField() {
+		field := v.Type().Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("schema"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		isFilter := field.Type.Kind() == reflect.Pointer && field.Type.Implements(decoderType)
+
+		for key, raws := range query {
+			op, ok := parseKey(key, name)
+			if !ok {
+				continue
+			}
+			if !isFilter {
+				if op != "" {
+					errs[key] = "operators aren't supported"
+					delete(query, key)
+				}
+				continue
+			}
+
+			if v.Field(i).IsNil() {
+				v.Field(i).Set(reflect.New(field.Type.Elem()))
+			}
+			if op == "" {
+				op = Eq
+			}
+			for _, raw := range raws {
+				if err := v.Field(i).Interface().(decoder).decode(op, raw); err != nil {
+					errs[key] = err.Error()
+				}
+			}
+			delete(query, key)
+		}
+	}
+	return errs
+}
+
+// parseKey returns the operator of a URL query key of the named field, e.g. "gte" of "priority[gte]",
+// or empty string if the key has no operator.
+func parseKey(key string, name string) (string, bool) {
+	if key == name {
+		return "", true
+	}
+	op, ok := strings.CutPrefix(key, name+"[")
+	if !ok {
+		return "", false
+	}
+	op, ok = strings.CutSuffix(op, "]")
+	return op, ok
+}
@@ -0,0 +1,100 @@
+// Package rank generates lexicographic ranks for manual ordering. A rank is a base-36 fraction
+// without the leading "0.", e.g. "i" is 0.5, so a rank between any two ranks can be made by adding digits.
+// Ranks never end in "0", otherwise there would be no rank between "a" and "a0".
+// Compare ranks bytewise, e.g. with COLLATE "C" in Postgres.
+package rank
+
+import "strings"
+
+const digits = "0123456789abcdefghijklmnopqrstuvwxyz"
+
+const (
+	base     = len(digits)
+	width    = 6 // Digits of evenly spaced ranks.
+	maxValue = base * base * base * base * base * base
+	step     = base * base * base
+)
+
+// MaxLength is the length above which ranks should be respaced with Even.
+const MaxLength = 16
+
+// Between returns a short rank between a and b, with empty string as no bound.
+// The a rank must be lower than b.
+func Between(a, b string) string {
+	// Appending after the last rank is common, so it's stepped like Even to keep ranks short.
+	if b == "" {
+		if n := value(a) + step; n < maxValue {
+			return format(n)
+		}
+	}
+	return midpoint(a, b)
+}
+
+// Even returns n evenly spaced ranks in ascending order.
+func Even(n int) []string {
+	gap := min(step, maxValue/(n+1))
+	ranks := make([]string, n)
+	for i := range ranks {
+		ranks[i] = format((i + 1) * gap)
+	}
+	return ranks
+}
+
+func midpoint(a, b string) string {
+	// Keep the common prefix, with a padded by zeros.
+	if b != "" {
+		n := 0
+		for n < len(b) && digitAt(a, n) == b[n] {
+			n++
+		}
+		if n > 0 {
+			return b[:n] + midpoint(a[min(n, len(a)):], b[n:])
+		}
+	}
+
+	lo, hi := 0, base
+	if a != "" {
+		lo = strings.IndexByte(digits, a[0])
+	}
+	if b != "" {
+		hi = strings.IndexByte(digits, b[0])
+	}
+	if hi-lo > 1 {
+		return string(digits[(lo+hi)/2])
+	}
+	// The first digits are consecutive. The first digit of b is between if b has more digits,
+	// which aren't all zeros, otherwise continue after the first digit of a.
+	if len(b) > 1 {
+		return b[:1]
+	}
+	if a == "" {
+		return string(digits[lo]) + midpoint("", "")
+	}
+	return a[:1] + midpoint(a[1:], "")
+}
+
+func digitAt(s string, i int) byte {
+	if i < len(s) {
+		return s[i]
+	}
+	return '0'
+}
+
+// value returns the first width digits of the rank as an integer.
+func value(r string) int {
+	n := 0
+	for i := range width {
+		n = n*base + strings.IndexByte(digits, digitAt(r, i))
+	}
+	return n
+}
+
+// format returns the rank of an integer of width digits, without trailing zeros.
+func format(n int) string {
+	b := make([]byte, width)
+	for i := width - 1; i >= 0; i-- {
+		b[i] = digits[n%base]
+		n /= base
+	}
+	return strings.TrimRight(string(b), "0")
+}
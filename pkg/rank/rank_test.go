@@ -0,0 +1,91 @@
+package rank
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBetween(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{"no bounds", "", "", "001"},
+		{"after last", "1", "", "101"},
+		{"before first", "", "1", "0i"},
+		{"between", "a", "c", "b"},
+		{"consecutive digits", "a", "b", "ai"},
+		{"common prefix", "a1", "a3", "a2"},
+		{"b longer", "a", "a1", "a0i"},
+		{"a longer", "a1", "b", "ai"},
+		{"last rank", "zzzzzz", "", "zzzzzzi"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Between(tt.a, tt.b)
+			if got != tt.want {
+				t.Errorf("Between(%q, %q) = %q, want %q", tt.a, tt.b, got, tt.want)
+			}
+			checkBetween(t, tt.a, got, tt.b)
+		})
+	}
+}
+
+func TestBetweenRepeated(t *testing.T) {
+	tests := []struct {
+		name string
+		next func(a, b, r string) (string, string) // Bounds of the next rank, after r was made between a and b.
+	}{
+		{"append", func(_, _, r string) (string, string) { return r, "" }},
+		{"prepend", func(_, _, r string) (string, string) { return "", r }},
+		{"narrow from below", func(_, b, r string) (string, string) { return r, b }},
+		{"narrow from above", func(a, _, r string) (string, string) { return a, r }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := "a", "b"
+			for range 200 {
+				r := Between(a, b)
+				checkBetween(t, a, r, b)
+				if t.Failed() {
+					return
+				}
+				a, b = tt.next(a, b, r)
+			}
+		})
+	}
+}
+
+func TestEven(t *testing.T) {
+	for _, n := range []int{0, 1, 10, 1000, 100_000} {
+		ranks := Even(n)
+		if len(ranks) != n {
+			t.Fatalf("Even(%d) returned %d ranks", n, len(ranks))
+		}
+		for i, r := range ranks {
+			if len(r) > width {
+				t.Errorf("Even(%d)[%d] = %q, longer than %d", n, i, r, width)
+			}
+			prev := ""
+			if i > 0 {
+				prev = ranks[i-1]
+			}
+			checkBetween(t, prev, r, "")
+		}
+	}
+}
+
+// checkBetween fails unless r is a valid rank strictly between a and b, with empty string as no bound.
+func checkBetween(t *testing.T, a, r, b string) {
+	t.Helper()
+	if r == "" || strings.HasSuffix(r, "0") || strings.Trim(r, digits) != "" {
+		t.Errorf("rank %q is invalid", r)
+	}
+	if a != "" && r <= a {
+		t.Errorf("rank %q is not after %q", r, a)
+	}
+	if b != "" && r >= b {
+		t.Errorf("rank %q is not before %q", r, b)
+	}
+}
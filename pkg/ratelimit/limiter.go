@@ -0,0 +1,85 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/nathansiegfrid/todolist/pkg/response"
+)
+
+// Policy decides how long a key is blocked after repeated hits.
+// Each hit beyond FreeHits doubles the delay, starting from BaseDelay up to MaxDelay.
+// After LockHits hits, the key is locked for LockDuration.
+type Policy struct {
+	Window       time.Duration // Hits are forgotten after no hit for this long.
+	FreeHits     int
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+	LockHits     int
+	LockDuration time.Duration
+}
+
+func (p Policy) delay(hits int) time.Duration {
+	if p.LockHits > 0 && hits >= p.LockHits {
+		return p.LockDuration
+	}
+	if hits <= p.FreeHits {
+		return 0
+	}
+	delay := p.BaseDelay
+	for i := p.FreeHits + 1; i < hits && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, p.MaxDelay)
+}
+
+type Limiter struct {
+	store  Store
+	policy Policy
+}
+
+func NewLimiter(store Store, policy Policy) *Limiter {
+	return &Limiter{store, policy}
+}
+
+// Hit counts an attempt, e.g. a login, for each key before it's made, and blocks the keys according to the policy.
+// It returns a "429 Too Many Requests" error without counting the attempt if any of the keys is blocked.
+// Counting and checking is a single store operation, so concurrent attempts can't all pass before any is counted.
+func (l *Limiter) Hit(ctx context.Context, keys ...string) error {
+	var retryAfter time.Duration
+	for i, key := range keys {
+		lockedUntil, err := l.store.Hit(ctx, key, l.policy.Window, l.policy.delay)
+		if err != nil {
+			return err
+		}
+		retryAfter = time.Until(lockedUntil)
+		if retryAfter > 0 {
+			// The attempt isn't made, so it doesn't count for the other keys either.
+			if err := l.Release(ctx, keys[:i]...); err != nil {
+				return err
+			}
+			return response.ErrTooManyRequests(retryAfter)
+		}
+	}
+	return nil
+}
+
+// Release uncounts an attempt of Hit that turned out legitimate, e.g. a successful login from an IP.
+func (l *Limiter) Release(ctx context.Context, keys ...string) error {
+	for _, key := range keys {
+		if err := l.store.Release(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Reset forgets the hits of the keys, e.g. after a successful login.
+func (l *Limiter) Reset(ctx context.Context, keys ...string) error {
+	for _, key := range keys {
+		if err := l.store.Reset(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nathansiegfrid/todolist/pkg/response"
+)
+
+var testPolicy = Policy{
+	Window:       time.Hour,
+	FreeHits:     3,
+	BaseDelay:    time.Minute,
+	MaxDelay:     time.Hour,
+	LockHits:     10,
+	LockDuration: 24 * time.Hour,
+}
+
+func TestPolicyDelay(t *testing.T) {
+	tests := []struct {
+		hits int
+		want time.Duration
+	}{
+		{1, 0},
+		{3, 0},
+		{4, time.Minute},
+		{5, 2 * time.Minute},
+		{9, 32 * time.Minute},
+		{10, 24 * time.Hour},
+	}
+	for _, tt := range tests {
+		if got := testPolicy.delay(tt.hits); got != tt.want {
+			t.Errorf("delay(%d) = %s, want %s", tt.hits, got, tt.want)
+		}
+	}
+}
+
+func TestLimiterHit(t *testing.T) {
+	ctx := context.Background()
+	l := NewLimiter(NewMemoryStore(), testPolicy)
+	tests := []struct {
+		name    string
+		keys    []string
+		wantErr bool
+	}{
+		{"free hit 1", []string{"ip", "email"}, false},
+		{"free hit 2", []string{"ip", "email"}, false},
+		{"free hit 3", []string{"ip", "email"}, false},
+		{"delayed hit", []string{"ip", "email"}, false},
+		{"blocked", []string{"ip", "email"}, true},
+		{"blocked by one key", []string{"other", "email"}, true},
+		// The blocked attempt isn't counted for "other", so it's still free.
+		{"other key", []string{"other"}, false},
+	}
+	for _, tt := range tests {
+		err := l.Hit(ctx, tt.keys...)
+		if tt.wantErr != isTooManyRequests(err) {
+			t.Fatalf("%s: error = %v, want 429 %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestLimiterHitConcurrent(t *testing.T) {
+	ctx := context.Background()
+	l := NewLimiter(NewMemoryStore(), testPolicy)
+
+	// Only the free hits and the first delayed hit pass, however many attempts run at once.
+	var passed atomic.Int32
+	var wg sync.WaitGroup
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := l.Hit(ctx, "key"); err == nil {
+				passed.Add(1)
+			} else if !isTooManyRequests(err) {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := passed.Load(); got != int32(testPolicy.FreeHits+1) {
+		t.Errorf("%d attempts passed, want %d", got, testPolicy.FreeHits+1)
+	}
+}
+
+func TestLimiterReleaseAndReset(t *testing.T) {
+	ctx := context.Background()
+	l := NewLimiter(NewMemoryStore(), testPolicy)
+	for range testPolicy.FreeHits {
+		if err := l.Hit(ctx, "released", "reset"); err != nil {
+			t.Fatal(err)
+		}
+		if err := l.Release(ctx, "released"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := l.Reset(ctx, "reset"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Both keys have free hits left, so nothing is blocked.
+	for i := range testPolicy.FreeHits + 1 {
+		if err := l.Hit(ctx, "released", "reset"); err != nil {
+			t.Fatalf("hit %d: %v", i+1, err)
+		}
+	}
+}
+
+func isTooManyRequests(err error) bool {
+	var res response.ErrorResponse
+	return errors.As(err, &res) && res.StatusCode == http.StatusTooManyRequests
+}
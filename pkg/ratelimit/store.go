@@ -0,0 +1,186 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+)
+
+// Store keeps hit counters and locks by key.
+// Use MemoryStore for a single app instance, and PostgresStore when running multiple instances.
+type Store interface {
+	// Hit counts a hit for key, then blocks key for delay(hits) if it's positive, where hits is the number of hits
+	// since the counter was reset. The counter is reset when the previous hit is older than window.
+	// If key is already blocked, the hit isn't counted and Hit returns the time key is blocked until,
+	// otherwise it returns zero time.
+	Hit(ctx context.Context, key string, window time.Duration, delay func(hits int) time.Duration) (time.Time, error)
+	// Release uncounts a hit of key. A block is kept.
+	Release(ctx context.Context, key string) error
+	// Reset removes the counter and block of key.
+	Reset(ctx context.Context, key string) error
+}
+
+type memoryEntry struct {
+	count       int
+	lastHit     time.Time
+	lockedUntil time.Time
+	window      time.Duration
+}
+
+// MemoryStore is a Store that keeps counters in process memory.
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]*memoryEntry
+	inserts int
+}
+
+// sweepInterval is the number of inserts between removals of stale entries.
+const sweepInterval = 1000
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]*memoryEntry)}
+}
+
+func (s *MemoryStore) Hit(
+	_ context.Context,
+	key string,
+	window time.Duration,
+	delay func(hits int) time.Duration,
+) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	e := s.entries[key]
+	if e == nil {
+		e = &memoryEntry{}
+		s.entries[key] = e
+		s.sweep(now)
+	}
+	if now.Before(e.lockedUntil) {
+		return e.lockedUntil, nil
+	}
+	if now.Sub(e.lastHit) > window {
+		e.count = 0
+	}
+	e.count++
+	e.lastHit = now
+	e.window = window
+	if d := delay(e.count); d > 0 {
+		e.lockedUntil = now.Add(d)
+	}
+	return time.Time{}, nil
+}
+
+func (s *MemoryStore) Release(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e := s.entries[key]; e != nil && e.count > 0 {
+		e.count--
+	}
+	return nil
+}
+
+func (s *MemoryStore) Reset(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, key)
+	return nil
+}
+
+// sweep must be called with s.mu held.
+func (s *MemoryStore) sweep(now time.Time) {
+	s.inserts++
+	if s.inserts < sweepInterval {
+		return
+	}
+	s.inserts = 0
+	for k, e := range s.entries {
+		if now.Sub(e.lastHit) > e.window && now.After(e.lockedUntil) {
+			delete(s.entries, k)
+		}
+	}
+}
+
+// PostgresStore is a Store backed by the "rate_limit" table, shared by all app instances.
+type PostgresStore struct {
+	db *sql.DB
+}
+
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{db}
+}
+
+func (s *PostgresStore) Hit(
+	ctx context.Context,
+	key string,
+	window time.Duration,
+	delay func(hits int) time.Duration,
+) (time.Time, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer tx.Rollback()
+
+	// Upserting locks the row until commit, so concurrent hits of the key are counted one after another.
+	now := time.Now()
+	var count int
+	var lastHitAt time.Time
+	var lockedUntil sql.NullTime
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO rate_limit (key, count, last_hit_at)
+		VALUES ($1, 0, $2)
+		ON CONFLICT (key) DO UPDATE
+		SET key = EXCLUDED.key
+		RETURNING count, last_hit_at, locked_until`,
+		key, now,
+	).Scan(&count, &lastHitAt, &lockedUntil)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if lockedUntil.Valid && now.Before(lockedUntil.Time) {
+		return lockedUntil.Time, nil
+	}
+
+	if now.Sub(lastHitAt) > window {
+		count = 0
+	}
+	count++
+	if d := delay(count); d > 0 {
+		lockedUntil = sql.NullTime{Time: now.Add(d), Valid: true}
+	}
+	_, err = tx.ExecContext(ctx, `
+		UPDATE rate_limit
+		SET count = $2, last_hit_at = $3, locked_until = $4
+		WHERE key = $1`,
+		key, count, now, lockedUntil,
+	)
+	if err != nil {
+		return time.Time{}, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	// Stale rows are useless, clean them up on the way.
+	_, err = s.db.ExecContext(ctx, `
+		DELETE FROM rate_limit
+		WHERE last_hit_at < NOW() - INTERVAL '1 day' AND (locked_until IS NULL OR locked_until < NOW())`,
+	)
+	return time.Time{}, err
+}
+
+func (s *PostgresStore) Release(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(ctx, "UPDATE rate_limit SET count = GREATEST(count - 1, 0) WHERE key = $1", key)
+	return err
+}
+
+func (s *PostgresStore) Reset(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM rate_limit WHERE key = $1", key)
+	return err
+}
@@ -2,6 +2,7 @@ package request
 
 import (
 	"context"
+	"time"
 
 	"github.com/google/uuid"
 )
@@ -11,6 +12,12 @@ type contextKey int
 const (
 	requestIDContextKey contextKey = iota
 	userIDContextKey
+	tokenIDContextKey
+	tokenExpiresAtContextKey
+	cookieAuthContextKey
+	scopesContextKey
+	roleContextKey
+	actorIDContextKey
 )
 
 func ContextWithRequestID(ctx context.Context, reqID string) context.Context {
@@ -28,3 +35,54 @@ func UserIDFromContext(ctx context.Context) uuid.UUID {
 	userID, _ := ctx.Value(userIDContextKey).(uuid.UUID)
 	return userID
 }
+
+func ContextWithTokenID(ctx context.Context, tokenID string) context.Context {
+	return context.WithValue(ctx, tokenIDContextKey, tokenID)
+}
+func TokenIDFromContext(ctx context.Context) string {
+	tokenID, _ := ctx.Value(tokenIDContextKey).(string)
+	return tokenID
+}
+
+func ContextWithTokenExpiresAt(ctx context.Context, expiresAt time.Time) context.Context {
+	return context.WithValue(ctx, tokenExpiresAtContextKey, expiresAt)
+}
+func TokenExpiresAtFromContext(ctx context.Context) time.Time {
+	expiresAt, _ := ctx.Value(tokenExpiresAtContextKey).(time.Time)
+	return expiresAt
+}
+
+// ContextWithCookieAuth marks the request as authenticated by cookie instead of Authorization header.
+func ContextWithCookieAuth(ctx context.Context) context.Context {
+	return context.WithValue(ctx, cookieAuthContextKey, true)
+}
+func CookieAuthFromContext(ctx context.Context) bool {
+	cookieAuth, _ := ctx.Value(cookieAuthContextKey).(bool)
+	return cookieAuth
+}
+
+// ContextWithScopes limits the request to the given scopes. Requests without scopes in context have every scope.
+func ContextWithScopes(ctx context.Context, scopes []string) context.Context {
+	return context.WithValue(ctx, scopesContextKey, scopes)
+}
+func ScopesFromContext(ctx context.Context) []string {
+	scopes, _ := ctx.Value(scopesContextKey).([]string)
+	return scopes
+}
+
+func ContextWithRole(ctx context.Context, role string) context.Context {
+	return context.WithValue(ctx, roleContextKey, role)
+}
+func RoleFromContext(ctx context.Context) string {
+	role, _ := ctx.Value(roleContextKey).(string)
+	return role
+}
+
+// ContextWithActorID marks the request as made by an admin impersonating the user.
+func ContextWithActorID(ctx context.Context, actorID uuid.UUID) context.Context {
+	return context.WithValue(ctx, actorIDContextKey, actorID)
+}
+func ActorIDFromContext(ctx context.Context) uuid.UUID {
+	actorID, _ := ctx.Value(actorIDContextKey).(uuid.UUID)
+	return actorID
+}
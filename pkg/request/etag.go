@@ -0,0 +1,80 @@
+package request
+
+import (
+	"net/http"
+	"strings"
+)
+
+// ETags are the entity tags of a conditional request header, e.g. `"3", W/"abc"`, or nil if the header is absent.
+// A "*" tag matches any ETag.
+type ETags []string
+
+// ReadIfMatch reads If-Match header, used by PATCH and DELETE to only change the version of a resource
+// the client has read. Compare it with ETags.Match.
+func ReadIfMatch(r *http.Request) ETags {
+	return parseETags(r.Header.Values("If-Match"))
+}
+
+// ReadIfNoneMatch reads If-None-Match header, used by GET to skip the response body if the client
+// has the same version cached. Compare it with ETags.MatchWeak.
+func ReadIfNoneMatch(r *http.Request) ETags {
+	return parseETags(r.Header.Values("If-None-Match"))
+}
+
+// Match reports whether a tag equals the ETag by strong comparison, so weak ETags never match.
+func (tags ETags) Match(etag string) bool {
+	for _, tag := range tags {
+		if tag == "*" || (tag == etag && !strings.HasPrefix(etag, "W/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchWeak reports whether a tag equals the ETag by weak comparison, ignoring the "W/" prefix.
+func (tags ETags) MatchWeak(etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, tag := range tags {
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// parseETags parses comma-separated lists of ETags. Malformed tags are skipped.
+func parseETags(values []string) ETags {
+	if len(values) == 0 {
+		return nil
+	}
+	tags := ETags{}
+	for _, value := range values {
+		for {
+			value = strings.TrimLeft(value, " \t,")
+			if value == "" {
+				break
+			}
+			if value[0] == '*' {
+				tags = append(tags, "*")
+				value = value[1:]
+				continue
+			}
+			// Quotes can't be escaped in ETags, so the tag ends at the next quote.
+			weak := strings.HasPrefix(value, "W/")
+			opaque := strings.TrimPrefix(value, "W/")
+			end := strings.IndexByte(opaque[min(1, len(opaque)):], '"')
+			if !strings.HasPrefix(opaque, `"`) || end < 0 {
+				// Skip to the next tag.
+				_, value, _ = strings.Cut(value, ",")
+				continue
+			}
+			tag := opaque[:end+2]
+			value = opaque[end+2:]
+			if weak {
+				tag = "W/" + tag
+			}
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
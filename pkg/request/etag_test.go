@@ -0,0 +1,68 @@
+package request
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestReadIfMatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []string
+		want   ETags
+	}{
+		{"absent", nil, nil},
+		{"empty", []string{""}, ETags{}},
+		{"one", []string{`"3"`}, ETags{`"3"`}},
+		{"list", []string{`"3", W/"abc" ,"4"`}, ETags{`"3"`, `W/"abc"`, `"4"`}},
+		{"multiple headers", []string{`"3"`, `"4"`}, ETags{`"3"`, `"4"`}},
+		{"any", []string{"*"}, ETags{"*"}},
+		{"comma in tag", []string{`"a,b", "c"`}, ETags{`"a,b"`, `"c"`}},
+		{"empty tag", []string{`""`}, ETags{`""`}},
+		{"unquoted tags are skipped", []string{`3, "4", W/5`}, ETags{`"4"`}},
+		{"unterminated tag is skipped", []string{`"4", "5`}, ETags{`"4"`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPatch, "/", nil)
+			for _, v := range tt.values {
+				r.Header.Add("If-Match", v)
+			}
+			got := ReadIfMatch(r)
+			if (got == nil) != (tt.want == nil) || !slices.Equal(got, tt.want) {
+				t.Errorf("ReadIfMatch() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestETagsMatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		tags     ETags
+		etag     string
+		want     bool
+		wantWeak bool
+	}{
+		{"absent", nil, `"3"`, false, false},
+		{"equal", ETags{`"3"`}, `"3"`, true, true},
+		{"other version", ETags{`"2"`}, `"3"`, false, false},
+		{"any", ETags{"*"}, `"3"`, true, true},
+		{"one of list", ETags{`"2"`, `"3"`}, `"3"`, true, true},
+		{"weak tag", ETags{`W/"3"`}, `"3"`, false, true},
+		{"weak etag", ETags{`W/"3"`}, `W/"3"`, false, true},
+		{"strong tag for weak etag", ETags{`"3"`}, `W/"3"`, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.tags.Match(tt.etag); got != tt.want {
+				t.Errorf("Match(%s) = %v, want %v", tt.etag, got, tt.want)
+			}
+			if got := tt.tags.MatchWeak(tt.etag); got != tt.wantWeak {
+				t.Errorf("MatchWeak(%s) = %v, want %v", tt.etag, got, tt.wantWeak)
+			}
+		})
+	}
+}
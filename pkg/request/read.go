@@ -2,10 +2,14 @@ package request
 
 import (
 	"encoding/json"
+	"net"
 	"net/http"
+	"net/url"
+	"reflect"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/schema"
+	"github.com/nathansiegfrid/todolist/pkg/query"
 	"github.com/nathansiegfrid/todolist/pkg/response"
 	"github.com/samber/lo"
 )
@@ -13,14 +17,29 @@ import (
 // ReadID reads {id} from URL path and parses it into uuid.UUID.
 // Supports `go-chi/chi` and standard `http` routers.
 func ReadID(r *http.Request) (uuid.UUID, error) {
-	idStr := r.PathValue("id")
+	return ReadIDParam(r, "id")
+}
+
+// ReadIDParam reads a named UUID param from URL path, e.g. {user_id}.
+func ReadIDParam(r *http.Request, name string) (uuid.UUID, error) {
+	idStr := r.PathValue(name)
 	id, err := uuid.Parse(idStr)
 	if err != nil {
-		return uuid.Nil, response.Errorf(http.StatusBadRequest, "Invalid ID param '%s'.", id)
+		return uuid.Nil, response.Errorf(http.StatusBadRequest, "Invalid ID param '%s'.", idStr)
 	}
 	return id, nil
 }
 
+// ClientIP returns the IP address of the client without port.
+// Behind a reverse proxy, use a middleware that sets RemoteAddr from trusted forwarding headers.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
 func ReadJSON[T any](r *http.Request) (*T, error) {
 	dst := new(T)
 	err := json.NewDecoder(r.Body).Decode(dst)
@@ -31,12 +50,27 @@ func ReadJSON[T any](r *http.Request) (*T, error) {
 }
 
 // ReadURLQuery maps URL query into struct using `schema` tags.
-// Supports primitive types, time.Time, and uuid.UUID.
+// Supports primitive types, time.Time, uuid.UUID, uuid.NullUUID ("null" for Valid false),
+// and query.Filter with operators, e.g. "priority[gte]=2".
 func ReadURLQuery[T any](r *http.Request) (*T, error) {
+	return DecodeURLQuery[T](r.URL.Query())
+}
+
+// DecodeURLQuery is like ReadURLQuery, for URL query from elsewhere than the request URL.
+func DecodeURLQuery[T any](values url.Values) (*T, error) {
 	dst := new(T)
+	if errs := query.DecodeURLQuery(dst, values); len(errs) > 0 {
+		return nil, response.ErrorResponse{
+			StatusCode: http.StatusBadRequest,
+			Message:    "Invalid URL query filter.",
+			Data:       errs,
+		}
+	}
+
 	dec := schema.NewDecoder()
 	dec.IgnoreUnknownKeys(true)
-	err := dec.Decode(dst, r.URL.Query())
+	dec.RegisterConverter(uuid.NullUUID{}, convertNullUUID)
+	err := dec.Decode(dst, values)
 	if err != nil {
 		if errs, ok := err.(schema.MultiError); ok {
 			// The MultiError map values doesn't make sense, so only the keys are returned.
@@ -50,3 +84,14 @@ func ReadURLQuery[T any](r *http.Request) (*T, error) {
 	}
 	return dst, nil
 }
+
+func convertNullUUID(value string) reflect.Value {
+	if value == "" || value == "null" {
+		return reflect.ValueOf(uuid.NullUUID{})
+	}
+	id, err := uuid.Parse(value)
+	if err != nil {
+		return reflect.Value{} // Invalid value is reported as conversion error.
+	}
+	return reflect.ValueOf(uuid.NullUUID{UUID: id, Valid: true})
+}
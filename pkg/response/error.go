@@ -3,7 +3,10 @@ package response
 import (
 	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	validation "github.com/go-ozzo/ozzo-validation/v4"
 	"github.com/google/uuid"
@@ -13,6 +16,9 @@ type ErrorResponse struct {
 	StatusCode int
 	Message    string
 	Data       any
+	// Header is additional response headers, e.g. Retry-After. It's a pointer, so ErrorResponse stays comparable
+	// with == and errors.Is.
+	Header *http.Header
 }
 
 // Error implements the `error` interface.
@@ -76,10 +82,26 @@ func ErrPermission() error {
 	return Error(http.StatusForbidden, "You are not authorized to perform this request.")
 }
 
+// ErrTooManyRequests is used when the client is rate limited. Retry-After is rounded up to whole seconds.
+func ErrTooManyRequests(retryAfter time.Duration) error {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	return ErrorResponse{
+		StatusCode: http.StatusTooManyRequests,
+		Message:    fmt.Sprintf("Too many attempts. Try again in %d seconds.", seconds),
+		Header:     &http.Header{"Retry-After": {strconv.Itoa(seconds)}},
+	}
+}
+
 func ErrIDNotFound(resource string, id uuid.UUID) error {
 	return Errorf(http.StatusNotFound, "%s with ID '%s' not found.", resource, id)
 }
 
+// ErrPreconditionFailed is used when If-Match doesn't match the current version of the resource,
+// because it was changed after the client read it.
+func ErrPreconditionFailed(resource string) error {
+	return Errorf(http.StatusPreconditionFailed, "%s was modified by another request. Reload it and try again.", resource)
+}
+
 func ErrConflict(resource string, value string) error {
 	return Errorf(http.StatusConflict, "%s '%s' already exists.", resource, value)
 }
@@ -0,0 +1,49 @@
+package response
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestErrorResponseComparable(t *testing.T) {
+	sentinel := Error(http.StatusUnauthorized, "Invalid code.")
+	tests := []struct {
+		name      string
+		err       error
+		target    error
+		want      bool // Of errors.Is.
+		wantEqual bool // Of ==, which doesn't unwrap.
+	}{
+		{"same sentinel", sentinel, sentinel, true, true},
+		{"wrapped sentinel", fmt.Errorf("login: %w", sentinel), sentinel, true, false},
+		{"other error", Error(http.StatusUnauthorized, "Other."), sentinel, false, false},
+		{"with header", ErrTooManyRequests(time.Second), sentinel, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errors.Is(tt.err, tt.target); got != tt.want {
+				t.Errorf("errors.Is() = %v, want %v", got, tt.want)
+			}
+			if got := tt.err == tt.target; got != tt.wantEqual {
+				t.Errorf("== is %v, want %v", got, tt.wantEqual)
+			}
+		})
+	}
+}
+
+func TestWriteErrorHeader(t *testing.T) {
+	w := httptest.NewRecorder()
+	if err := WriteError(w, ErrorResponseFrom(ErrTooManyRequests(1500*time.Millisecond))); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	if got := w.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("Retry-After = %q, want %q", got, "2")
+	}
+}
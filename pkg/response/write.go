@@ -1,8 +1,14 @@
 package response
 
 import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 )
 
 // responseBody standardizes the response format.
@@ -13,6 +19,14 @@ type responseBody struct {
 	Status  string `json:"status"`
 	Message string `json:"message,omitempty"`
 	Data    any    `json:"data,omitempty"`
+	*Page
+}
+
+// Page is the position of a page of a list. Cursors are empty on the last and first pages.
+type Page struct {
+	NextCursor string `json:"next_cursor,omitempty"`
+	PrevCursor string `json:"prev_cursor,omitempty"`
+	Total      *int   `json:"total,omitempty"` // Only counted if requested.
 }
 
 func write(w http.ResponseWriter, statusCode int, body responseBody) error {
@@ -29,6 +43,50 @@ func WriteJSON(w http.ResponseWriter, data any) error {
 	return write(w, http.StatusOK, responseBody{Status: "SUCCESS", Data: data})
 }
 
+// WritePage writes a page of a list, with RFC 8288 Link headers to the pages after and before it.
+// The links are the request URL with "cursor" query param replaced.
+func WritePage(w http.ResponseWriter, r *http.Request, data any, page *Page) error {
+	links := []struct{ rel, cursor string }{{"next", page.NextCursor}, {"prev", page.PrevCursor}}
+	for _, link := range links {
+		if link.cursor == "" {
+			continue
+		}
+		u := *r.URL
+		query := u.Query()
+		query.Set("cursor", link.cursor)
+		u.RawQuery = query.Encode()
+		w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="%s"`, u.RequestURI(), link.rel))
+	}
+	return write(w, http.StatusOK, responseBody{Status: "SUCCESS", Data: data, Page: page})
+}
+
+// ETag returns the strong ETag of a version of a resource, e.g. `"3"`. Set it as the ETag header of GET responses,
+// so clients can make conditional requests with If-Match and If-None-Match.
+// Vary are values the representation depends on besides the version, e.g. the user ID if it differs by user.
+// They're hashed into the ETag, e.g. `"3-1f2e3d4c5b6a7988"`.
+func ETag(version int, vary ...string) string {
+	etag := strconv.Itoa(version)
+	if len(vary) > 0 {
+		sum := sha256.Sum256([]byte(strings.Join(vary, "\x00")))
+		etag += "-" + hex.EncodeToString(sum[:8])
+	}
+	return strconv.Quote(etag)
+}
+
+// WeakETag returns a weak ETag hashed from the JSON of data, for responses without a version, e.g. pages of lists.
+func WeakETag(data ...any) string {
+	payload, _ := json.Marshal(data)
+	sum := sha256.Sum256(payload)
+	return `W/"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+}
+
+// WriteNotModified writes 304 Not Modified without body, for a GET with If-None-Match matching the ETag.
+func WriteNotModified(w http.ResponseWriter, etag string) error {
+	w.Header().Set("ETag", etag)
+	w.WriteHeader(http.StatusNotModified)
+	return nil
+}
+
 func WriteError(w http.ResponseWriter, res ErrorResponse) error {
 	var status string
 	if res.StatusCode >= http.StatusInternalServerError {
@@ -36,9 +94,22 @@ func WriteError(w http.ResponseWriter, res ErrorResponse) error {
 	} else {
 		status = "FAIL"
 	}
+	if res.Header != nil {
+		for k, v := range *res.Header {
+			w.Header()[k] = v
+		}
+	}
 	return write(w, res.StatusCode, responseBody{
 		Status:  status,
 		Message: res.Message,
 		Data:    res.Data,
 	})
 }
+
+// WriteRawJSON writes data without the standard response format.
+// It should only be used for responses that must follow an external specification.
+func WriteRawJSON(w http.ResponseWriter, data any) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	return json.NewEncoder(w).Encode(data)
+}
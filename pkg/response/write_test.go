@@ -0,0 +1,25 @@
+package response
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestETag(t *testing.T) {
+	if got := ETag(3); got != `"3"` {
+		t.Errorf("ETag(3) = %s, want %s", got, `"3"`)
+	}
+	alice, bob := ETag(3, "alice"), ETag(3, "bob")
+	if alice == bob {
+		t.Errorf("ETags of different viewers are equal: %s", alice)
+	}
+	if alice != ETag(3, "alice") || !strings.HasPrefix(alice, `"3-`) {
+		t.Errorf("ETag(3, alice) = %s, want a stable tag of version 3", alice)
+	}
+	if ETag(3, "alice") == ETag(4, "alice") {
+		t.Error("ETags of different versions are equal")
+	}
+	if got := WeakETag("page"); !strings.HasPrefix(got, `W/"`) || got != WeakETag("page") || got == WeakETag("other") {
+		t.Errorf("WeakETag(page) = %s, want a stable weak tag of the data", got)
+	}
+}
@@ -0,0 +1,303 @@
+// Package rrule implements a subset of RFC 5545 recurrence rules: FREQ (DAILY, WEEKLY, MONTHLY, YEARLY),
+// INTERVAL, BYDAY (without ordinals), BYMONTHDAY, COUNT and UNTIL. Weeks start on Monday.
+package rrule
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Frequency string
+
+const (
+	Daily   Frequency = "DAILY"
+	Weekly  Frequency = "WEEKLY"
+	Monthly Frequency = "MONTHLY"
+	Yearly  Frequency = "YEARLY"
+)
+
+// maxPeriods stops the search for occurrences of rules that never match, e.g. BYMONTHDAY=31 with FREQ=MONTHLY;INTERVAL=12
+// starting in a month with 30 days.
+const maxPeriods = 1000
+
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+type Rule struct {
+	Freq       Frequency
+	Interval   int // Defaults to 1.
+	ByDay      []time.Weekday
+	ByMonthDay []int // 1 to 31, or -1 to -31 counting from the end of the month.
+	Count      int   // Number of occurrences including the first one, or 0 for no limit.
+
+	// Until is the last possible occurrence, or zero for no limit.
+	// If UntilLocal is set, it's in the timezone of the occurrences rather than UTC.
+	Until      time.Time
+	UntilLocal bool
+}
+
+// Parse parses a rule like "FREQ=WEEKLY;BYDAY=MO,WE". The "RRULE:" prefix is optional.
+func Parse(s string) (*Rule, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "RRULE:")
+	r := &Rule{Interval: 1}
+	for _, part := range strings.Split(s, ";") {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok || value == "" {
+			return nil, fmt.Errorf("invalid rule part %q", part)
+		}
+
+		var err error
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			r.Freq = Frequency(strings.ToUpper(value))
+			if !slices.Contains([]Frequency{Daily, Weekly, Monthly, Yearly}, r.Freq) {
+				return nil, fmt.Errorf("unsupported FREQ %q", value)
+			}
+		case "INTERVAL":
+			r.Interval, err = strconv.Atoi(value)
+			if err != nil || r.Interval < 1 {
+				return nil, fmt.Errorf("invalid INTERVAL %q", value)
+			}
+		case "BYDAY":
+			for _, v := range strings.Split(value, ",") {
+				wd, ok := weekdays[strings.ToUpper(v)]
+				if !ok {
+					return nil, fmt.Errorf("invalid or unsupported BYDAY %q", v)
+				}
+				if !slices.Contains(r.ByDay, wd) {
+					r.ByDay = append(r.ByDay, wd)
+				}
+			}
+		case "BYMONTHDAY":
+			for _, v := range strings.Split(value, ",") {
+				day, err := strconv.Atoi(v)
+				if err != nil || day == 0 || day < -31 || day > 31 {
+					return nil, fmt.Errorf("invalid BYMONTHDAY %q", v)
+				}
+				r.ByMonthDay = append(r.ByMonthDay, day)
+			}
+		case "COUNT":
+			r.Count, err = strconv.Atoi(value)
+			if err != nil || r.Count < 1 {
+				return nil, fmt.Errorf("invalid COUNT %q", value)
+			}
+		case "UNTIL":
+			r.Until, r.UntilLocal, err = parseUntil(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid UNTIL %q", value)
+			}
+		default:
+			return nil, fmt.Errorf("unsupported rule part %q", key)
+		}
+	}
+
+	if r.Freq == "" {
+		return nil, errors.New("FREQ is required")
+	}
+	if r.Count > 0 && !r.Until.IsZero() {
+		return nil, errors.New("COUNT and UNTIL can't be used together")
+	}
+	return r, nil
+}
+
+func parseUntil(s string) (time.Time, bool, error) {
+	if t, err := time.Parse("20060102T150405Z", s); err == nil {
+		return t, false, nil
+	}
+	if t, err := time.Parse("20060102T150405", s); err == nil {
+		return t, true, nil
+	}
+	// A date includes the whole day.
+	t, err := time.Parse("20060102", s)
+	return t.Add(24*time.Hour - time.Second), true, err
+}
+
+// String returns the rule in RRULE format, without the "RRULE:" prefix.
+func (r *Rule) String() string {
+	parts := []string{"FREQ=" + string(r.Freq)}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, len(r.ByDay))
+		for i, wd := range r.ByDay {
+			days[i] = strings.ToUpper(wd.String()[:2])
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if len(r.ByMonthDay) > 0 {
+		days := make([]string, len(r.ByMonthDay))
+		for i, day := range r.ByMonthDay {
+			days[i] = strconv.Itoa(day)
+		}
+		parts = append(parts, "BYMONTHDAY="+strings.Join(days, ","))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if !r.Until.IsZero() {
+		if r.UntilLocal {
+			parts = append(parts, "UNTIL="+r.Until.Format("20060102T150405"))
+		} else {
+			parts = append(parts, "UNTIL="+r.Until.UTC().Format("20060102T150405Z"))
+		}
+	}
+	return strings.Join(parts, ";")
+}
+
+// Occurrences returns up to n occurrences of the rule starting at dtstart, which is always the first occurrence.
+// Occurrences have the time of day and timezone of dtstart.
+func (r *Rule) Occurrences(dtstart time.Time, n int) []time.Time {
+	var result []time.Time
+	if n <= 0 {
+		return result
+	}
+	r.iterate(dtstart, func(t time.Time) bool {
+		result = append(result, t)
+		return len(result) < n
+	})
+	return result
+}
+
+// Next returns the occurrence after dtstart, or false if dtstart is the last one.
+func (r *Rule) Next(dtstart time.Time) (time.Time, bool) {
+	occurrences := r.Occurrences(dtstart, 2)
+	if len(occurrences) < 2 {
+		return time.Time{}, false
+	}
+	return occurrences[1], true
+}
+
+// iterate calls yield with each occurrence in order, until it returns false.
+func (r *Rule) iterate(dtstart time.Time, yield func(time.Time) bool) {
+	until := r.Until
+	if r.UntilLocal {
+		y, m, d := r.Until.Date()
+		hh, mm, ss := r.Until.Clock()
+		until = time.Date(y, m, d, hh, mm, ss, 0, dtstart.Location())
+	}
+
+	count := 0
+	emit := func(t time.Time) bool {
+		if !until.IsZero() && t.After(until) {
+			return false
+		}
+		count++
+		return yield(t) && (r.Count == 0 || count < r.Count)
+	}
+
+	if !emit(dtstart) {
+		return
+	}
+	interval := max(r.Interval, 1)
+	for period := 0; period < maxPeriods; period++ {
+		for _, t := range r.expand(dtstart, period*interval) {
+			if !t.After(dtstart) {
+				continue
+			}
+			if !emit(t) {
+				return
+			}
+		}
+	}
+}
+
+// expand returns the occurrences in the period offset days, weeks, months or years after the period of dtstart.
+// The offset can be 0, which returns occurrences in the same period as dtstart.
+func (r *Rule) expand(dtstart time.Time, offset int) []time.Time {
+	y, m, d := dtstart.Date()
+	hh, mm, ss := dtstart.Clock()
+	date := func(y int, m time.Month, d int) time.Time {
+		return time.Date(y, m, d, hh, mm, ss, 0, dtstart.Location())
+	}
+
+	var result []time.Time
+	switch r.Freq {
+	case Daily:
+		if t := date(y, m, d+offset); r.matches(t) {
+			result = append(result, t)
+		}
+	case Weekly:
+		monday := d - daysSinceMonday(dtstart.Weekday()) + offset*7
+		days := r.ByDay
+		if len(days) == 0 {
+			days = []time.Weekday{dtstart.Weekday()}
+		}
+		for i := range 7 {
+			t := date(y, m, monday+i)
+			if slices.Contains(days, t.Weekday()) && r.matchesMonthDay(t) {
+				result = append(result, t)
+			}
+		}
+	case Monthly:
+		first := date(y, m+time.Month(offset), 1)
+		n := daysIn(first.Year(), first.Month())
+		if len(r.ByDay) == 0 && len(r.ByMonthDay) == 0 {
+			// Months without the day of dtstart are skipped.
+			if d <= n {
+				result = append(result, date(first.Year(), first.Month(), d))
+			}
+			break
+		}
+		for day := 1; day <= n; day++ {
+			if t := date(first.Year(), first.Month(), day); r.matches(t) {
+				result = append(result, t)
+			}
+		}
+	case Yearly:
+		year := y + offset
+		if len(r.ByDay) == 0 && len(r.ByMonthDay) == 0 {
+			// February 29 is skipped in non-leap years.
+			if d <= daysIn(year, m) {
+				result = append(result, date(year, m, d))
+			}
+			break
+		}
+		n := time.Date(year, time.December, 31, 0, 0, 0, 0, time.UTC).YearDay()
+		for day := 1; day <= n; day++ {
+			if t := date(year, time.January, day); r.matches(t) {
+				result = append(result, t)
+			}
+		}
+	}
+	return result
+}
+
+func (r *Rule) matches(t time.Time) bool {
+	if len(r.ByDay) > 0 && !slices.Contains(r.ByDay, t.Weekday()) {
+		return false
+	}
+	return r.matchesMonthDay(t)
+}
+
+func (r *Rule) matchesMonthDay(t time.Time) bool {
+	if len(r.ByMonthDay) == 0 {
+		return true
+	}
+	n := daysIn(t.Year(), t.Month())
+	for _, day := range r.ByMonthDay {
+		if day == t.Day() || n+day+1 == t.Day() {
+			return true
+		}
+	}
+	return false
+}
+
+func daysSinceMonday(wd time.Weekday) int {
+	return (int(wd) + 6) % 7
+}
+
+func daysIn(y int, m time.Month) int {
+	return time.Date(y, m+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
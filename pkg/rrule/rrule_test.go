@@ -0,0 +1,115 @@
+package rrule
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		rule    string
+		want    string // String of the parsed rule.
+		wantErr bool
+	}{
+		{"FREQ=DAILY", "FREQ=DAILY", false},
+		{"RRULE:freq=weekly;byday=mo,we,mo", "FREQ=WEEKLY;BYDAY=MO,WE", false},
+		{"FREQ=MONTHLY;INTERVAL=2;BYMONTHDAY=1,-1", "FREQ=MONTHLY;INTERVAL=2;BYMONTHDAY=1,-1", false},
+		{"FREQ=YEARLY;COUNT=3", "FREQ=YEARLY;COUNT=3", false},
+		{"FREQ=DAILY;UNTIL=20240131T120000Z", "FREQ=DAILY;UNTIL=20240131T120000Z", false},
+		{"FREQ=DAILY;UNTIL=20240131", "FREQ=DAILY;UNTIL=20240131T235959", false},
+		{"FREQ=DAILY;INTERVAL=1", "FREQ=DAILY", false},
+		{"", "", true},
+		{"INTERVAL=2", "", true},
+		{"FREQ=HOURLY", "", true},
+		{"FREQ=DAILY;INTERVAL=0", "", true},
+		{"FREQ=WEEKLY;BYDAY=1MO", "", true},
+		{"FREQ=MONTHLY;BYMONTHDAY=32", "", true},
+		{"FREQ=MONTHLY;BYMONTHDAY=0", "", true},
+		{"FREQ=DAILY;COUNT=0", "", true},
+		{"FREQ=DAILY;COUNT=2;UNTIL=20240131", "", true},
+		{"FREQ=DAILY;BYHOUR=9", "", true},
+		{"FREQ=DAILY;COUNT", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rule, func(t *testing.T) {
+			r, err := Parse(tt.rule)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Parse() = %q, want error", r)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := r.String(); got != tt.want {
+				t.Errorf("String() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNext(t *testing.T) {
+	// Wednesday.
+	dtstart := time.Date(2024, time.January, 31, 9, 0, 0, 0, time.UTC)
+	date := func(m time.Month, d int) time.Time {
+		return time.Date(2024, m, d, 9, 0, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		name   string
+		rule   string
+		want   time.Time
+		wantOK bool
+	}{
+		{"daily", "FREQ=DAILY", date(time.February, 1), true},
+		{"daily interval", "FREQ=DAILY;INTERVAL=3", date(time.February, 3), true},
+		{"weekly", "FREQ=WEEKLY", date(time.February, 7), true},
+		{"weekly later in the week", "FREQ=WEEKLY;BYDAY=MO,FR", date(time.February, 2), true},
+		{"weekly next week", "FREQ=WEEKLY;BYDAY=MO,TU", date(time.February, 5), true},
+		{"biweekly next period", "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO", date(time.February, 12), true},
+		{"monthly skips short months", "FREQ=MONTHLY", date(time.March, 31), true},
+		{"monthly last day", "FREQ=MONTHLY;BYMONTHDAY=-1", date(time.February, 29), true},
+		{"monthly weekday", "FREQ=MONTHLY;BYDAY=FR", date(time.February, 2), true},
+		{"yearly", "FREQ=YEARLY", time.Date(2025, time.January, 31, 9, 0, 0, 0, time.UTC), true},
+		{"count of one", "FREQ=DAILY;COUNT=1", time.Time{}, false},
+		{"count of two", "FREQ=DAILY;COUNT=2", date(time.February, 1), true},
+		{"until same day", "FREQ=DAILY;UNTIL=20240131", time.Time{}, false},
+		{"until next day", "FREQ=DAILY;UNTIL=20240201", date(time.February, 1), true},
+		{"until before time of day", "FREQ=DAILY;UNTIL=20240201T080000Z", time.Time{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := Parse(tt.rule)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, ok := r.Next(dtstart)
+			if ok != tt.wantOK || !got.Equal(tt.want) {
+				t.Errorf("Next() = (%s, %v), want (%s, %v)", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestOccurrences(t *testing.T) {
+	// 2024-03-31 is the day of the switch to summer time in Amsterdam.
+	amsterdam, err := time.LoadLocation("Europe/Amsterdam")
+	if err != nil {
+		t.Skip(err)
+	}
+	dtstart := time.Date(2024, time.March, 30, 9, 0, 0, 0, amsterdam)
+	r, err := Parse("FREQ=DAILY;COUNT=3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := r.Occurrences(dtstart, 5)
+	want := []time.Time{
+		dtstart,
+		time.Date(2024, time.March, 31, 9, 0, 0, 0, amsterdam),
+		time.Date(2024, time.April, 1, 9, 0, 0, 0, amsterdam),
+	}
+	if !slices.EqualFunc(got, want, time.Time.Equal) {
+		t.Errorf("Occurrences() = %v, want %v", got, want)
+	}
+}
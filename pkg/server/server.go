@@ -6,19 +6,36 @@ import (
 	"fmt"
 	"net/http"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 )
 
 const gracefulShutdownTimeout = 15 * time.Second
 
-// ListenAndServe starts an HTTP server with graceful shutdown.
-func ListenAndServe(port int, router http.Handler) error {
+// Worker runs in the background until ctx is canceled.
+type Worker func(ctx context.Context)
+
+// ListenAndServe starts an HTTP server and background workers with graceful shutdown.
+// On shutdown, workers are canceled together with the HTTP server, and waited for within the same timeout.
+func ListenAndServe(port int, router http.Handler, workers ...Worker) error {
 	svr := http.Server{
 		Addr:    fmt.Sprintf("0.0.0.0:%d", port),
 		Handler: router,
 	}
 
+	// Run background workers.
+	var wg sync.WaitGroup
+	workerCtx, workerCancel := context.WithCancel(context.Background())
+	defer workerCancel()
+	for _, worker := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			worker(workerCtx)
+		}()
+	}
+
 	// Run HTTP server.
 	var err error
 	signalCtx, signalCancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
@@ -27,6 +44,7 @@ func ListenAndServe(port int, router http.Handler) error {
 		err = svr.ListenAndServe()
 	}()
 	<-signalCtx.Done() // Wait for interrupt/terminate signals.
+	workerCancel()
 	if err != nil && !errors.Is(err, http.ErrServerClosed) {
 		return fmt.Errorf("listen and serve: %w", err)
 	}
@@ -37,5 +55,17 @@ func ListenAndServe(port int, router http.Handler) error {
 	if err := svr.Shutdown(shutdownCtx); err != nil {
 		return fmt.Errorf("shut down: %w", err)
 	}
+
+	// Wait for workers to finish their current work.
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-shutdownCtx.Done():
+		return fmt.Errorf("shut down workers: %w", shutdownCtx.Err())
+	}
 	return nil
 }
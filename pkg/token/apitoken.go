@@ -0,0 +1,89 @@
+package token
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/nathansiegfrid/todolist/pkg/response"
+)
+
+// APITokenPrefix marks personal API tokens, so they can be told apart from JWTs and found by secret scanners.
+const APITokenPrefix = "tdl_"
+
+// Scopes limit what an API token can do. Access tokens from login have every scope.
+const (
+	ScopeTodosRead  = "todos:read"
+	ScopeTodosWrite = "todos:write"
+	// Workspace scopes allow managing workspaces, their members and invitations.
+	// Todos in workspaces only need the todo scopes.
+	ScopeWorkspacesRead  = "workspaces:read"
+	ScopeWorkspacesWrite = "workspaces:write"
+	// ScopeAccount allows managing the account itself. It can't be granted to API tokens,
+	// so a leaked API token can't be used to mint more tokens or change credentials.
+	ScopeAccount = "account"
+)
+
+// GrantableScopes are the scopes that can be granted to API tokens.
+var GrantableScopes = []string{ScopeTodosRead, ScopeTodosWrite, ScopeWorkspacesRead, ScopeWorkspacesWrite}
+
+var errAPITokenInvalid = response.Error(http.StatusUnauthorized, "API token is invalid or has expired.")
+
+// GenerateAPIToken returns a random API token with APITokenPrefix, and its hash.
+func GenerateAPIToken() (string, []byte, error) {
+	t, _, err := GenerateOpaqueToken()
+	if err != nil {
+		return "", nil, err
+	}
+	t = APITokenPrefix + t
+	return t, HashOpaqueToken(t), nil
+}
+
+// IsAPIToken reports whether the token looks like a personal API token.
+func IsAPIToken(token string) bool {
+	return strings.HasPrefix(token, APITokenPrefix)
+}
+
+// APITokenStore verifies personal API tokens.
+type APITokenStore interface {
+	VerifyAPIToken(ctx context.Context, token string) (*Claims, error)
+}
+
+// PostgresAPITokenStore looks up API tokens in "api_token" table.
+type PostgresAPITokenStore struct {
+	db *sql.DB
+}
+
+func NewPostgresAPITokenStore(db *sql.DB) *PostgresAPITokenStore {
+	return &PostgresAPITokenStore{db}
+}
+
+// VerifyAPIToken returns the claims of an unexpired API token with the current role of the user,
+// and records its last use.
+func (s *PostgresAPITokenStore) VerifyAPIToken(ctx context.Context, token string) (*Claims, error) {
+	claims := &Claims{}
+	var scopes string
+	var expiresAt sql.NullTime
+	// Tokens of disabled users are rejected.
+	err := s.db.QueryRowContext(ctx, `
+		UPDATE api_token t
+		SET last_used_at = NOW()
+		FROM "user" u
+		WHERE t.token_hash = $1 AND (t.expires_at IS NULL OR t.expires_at > NOW())
+			AND u.id = t.user_id AND u.disabled_at IS NULL
+		RETURNING t.id, t.user_id, t.scopes, t.created_at, t.expires_at, u.role`,
+		HashOpaqueToken(token),
+	).Scan(&claims.TokenID, &claims.UserID, &scopes, &claims.IssuedAt, &expiresAt, &claims.Role)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errAPITokenInvalid
+		}
+		return nil, err
+	}
+	claims.ExpiresAt = expiresAt.Time
+	claims.Scopes = strings.Fields(scopes)
+	claims.APIToken = true
+	return claims, nil
+}
@@ -0,0 +1,43 @@
+package token
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestGenerateAPIToken(t *testing.T) {
+	apiToken, hash, err := GenerateAPIToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(apiToken, APITokenPrefix) || !IsAPIToken(apiToken) {
+		t.Errorf("GenerateAPIToken() = %s, want prefix %s", apiToken, APITokenPrefix)
+	}
+	// Hash covers the prefix, so it's the hash of the token as sent by clients.
+	if !bytes.Equal(hash, HashOpaqueToken(apiToken)) {
+		t.Error("GenerateAPIToken() hash doesn't match HashOpaqueToken() of the token")
+	}
+	other, _, err := GenerateAPIToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == apiToken {
+		t.Error("GenerateAPIToken() returned the same token twice")
+	}
+
+	tests := []struct {
+		token string
+		want  bool
+	}{
+		{APITokenPrefix + "abc", true},
+		{"eyJhbGciOiJIUzI1NiJ9.e30.sig", false},
+		{"", false},
+		{strings.ToUpper(APITokenPrefix) + "abc", false},
+	}
+	for _, tt := range tests {
+		if got := IsAPIToken(tt.token); got != tt.want {
+			t.Errorf("IsAPIToken(%q) = %v, want %v", tt.token, got, tt.want)
+		}
+	}
+}
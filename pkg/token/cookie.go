@@ -0,0 +1,100 @@
+package token
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"time"
+
+	"github.com/nathansiegfrid/todolist/pkg/response"
+)
+
+// Cookie and header names used by cookie-based authentication.
+const (
+	AccessTokenCookie  = "access_token"
+	RefreshTokenCookie = "refresh_token"
+	CSRFTokenCookie    = "csrf_token"
+	CSRFTokenHeader    = "X-CSRF-Token"
+	OIDCStateCookie    = "oidc_state"
+)
+
+var errCSRFToken = response.Error(http.StatusForbidden, "CSRF token is missing or invalid.")
+
+// CookieConfig configures session cookies for browser clients.
+// Set Domain to the root domain (e.g. "example.com") to share cookies with subdomains.
+type CookieConfig struct {
+	Domain   string
+	Secure   bool
+	SameSite http.SameSite
+}
+
+// SetSessionCookies sets HttpOnly access and refresh token cookies, and a CSRF token cookie readable by
+// JavaScript. The returned CSRF token must be sent back in the X-CSRF-Token header on unsafe requests.
+func (c *CookieConfig) SetSessionCookies(
+	w http.ResponseWriter,
+	accessToken string, accessTokenDuration time.Duration,
+	refreshToken string, refreshTokenDuration time.Duration,
+) (string, error) {
+	csrfToken, _, err := GenerateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	http.SetCookie(w, c.cookie(AccessTokenCookie, accessToken, "/", accessTokenDuration, true))
+	// Refresh token is only needed by "/v1/token/refresh" and "/v1/logout".
+	http.SetCookie(w, c.cookie(RefreshTokenCookie, refreshToken, "/v1", refreshTokenDuration, true))
+	http.SetCookie(w, c.cookie(CSRFTokenCookie, csrfToken, "/", refreshTokenDuration, false))
+	return csrfToken, nil
+}
+
+// ClearSessionCookies removes the cookies set by SetSessionCookies.
+func (c *CookieConfig) ClearSessionCookies(w http.ResponseWriter) {
+	http.SetCookie(w, c.cookie(AccessTokenCookie, "", "/", -1, true))
+	http.SetCookie(w, c.cookie(RefreshTokenCookie, "", "/v1", -1, true))
+	http.SetCookie(w, c.cookie(CSRFTokenCookie, "", "/", -1, false))
+}
+
+// SetStateCookie sets a short-lived HttpOnly cookie for state of a login flow through another site.
+// SameSite is relaxed to Lax, so the cookie is sent when the other site redirects back.
+func (c *CookieConfig) SetStateCookie(w http.ResponseWriter, name, value, path string, duration time.Duration) {
+	cookie := c.cookie(name, value, path, duration, true)
+	if cookie.SameSite == http.SameSiteStrictMode {
+		cookie.SameSite = http.SameSiteLaxMode
+	}
+	http.SetCookie(w, cookie)
+}
+
+// ClearStateCookie removes the cookie set by SetStateCookie.
+func (c *CookieConfig) ClearStateCookie(w http.ResponseWriter, name, path string) {
+	http.SetCookie(w, c.cookie(name, "", path, -1, true))
+}
+
+func (c *CookieConfig) cookie(name, value, path string, duration time.Duration, httpOnly bool) *http.Cookie {
+	maxAge := int(duration.Seconds())
+	if duration < 0 {
+		maxAge = -1 // Delete cookie now.
+	}
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   c.Domain,
+		MaxAge:   maxAge,
+		Secure:   c.Secure,
+		HttpOnly: httpOnly,
+		SameSite: c.SameSite,
+	}
+}
+
+// VerifyCSRF checks that the X-CSRF-Token header matches the CSRF token cookie (double-submit pattern).
+// A cross-site attacker can make the browser send the cookie, but can't read it to set the header.
+func VerifyCSRF(r *http.Request) error {
+	cookie, err := r.Cookie(CSRFTokenCookie)
+	if err != nil || cookie.Value == "" {
+		return errCSRFToken
+	}
+	header := r.Header.Get(CSRFTokenHeader)
+	if subtle.ConstantTimeCompare([]byte(header), []byte(cookie.Value)) != 1 {
+		return errCSRFToken
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+package token
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Key is a JWT signing and/or verification key.
+// Asymmetric keys are identified by their JWK thumbprint (RFC 7638), which is set as the "kid" header.
+type Key struct {
+	ID        string
+	method    jwt.SigningMethod
+	signKey   any // Nil for verification-only keys.
+	verifyKey any
+}
+
+// NewHMACKey creates an HS256 key. HMAC keys have an empty ID, so tokens signed before
+// key rotation was supported (without "kid" header) can still be verified.
+func NewHMACKey(secret []byte) *Key {
+	return &Key{
+		method:    jwt.SigningMethodHS256,
+		signKey:   secret,
+		verifyKey: secret,
+	}
+}
+
+// LoadPrivateKeyPEM loads an RSA (RS256) or Ed25519 (EdDSA) private key from a PEM file.
+// Supported formats are PKCS #8 and PKCS #1 (RSA only).
+func LoadPrivateKeyPEM(file string) (*Key, error) {
+	der, err := readPEM(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var privateKey any
+	privateKey, err = x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		privateKey, err = x509.ParsePKCS1PrivateKey(der)
+		if err != nil {
+			return nil, fmt.Errorf("parse private key %s: %w", file, err)
+		}
+	}
+
+	signer, ok := privateKey.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("parse private key %s: unsupported key type %T", file, privateKey)
+	}
+	key, err := NewKey(signer)
+	if err != nil {
+		return nil, fmt.Errorf("parse private key %s: %w", file, err)
+	}
+	return key, nil
+}
+
+// NewKey creates a signing key from an RSA or Ed25519 private key.
+func NewKey(privateKey crypto.Signer) (*Key, error) {
+	key, err := newPublicKey(privateKey.Public())
+	if err != nil {
+		return nil, err
+	}
+	key.signKey = privateKey
+	return key, nil
+}
+
+// LoadPublicKeyPEM loads an RSA or Ed25519 public key from a PEM file in PKIX format.
+// The key can only be used for verification, e.g. for tokens signed by a rotated-out key.
+func LoadPublicKeyPEM(file string) (*Key, error) {
+	der, err := readPEM(file)
+	if err != nil {
+		return nil, err
+	}
+
+	publicKey, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("parse public key %s: %w", file, err)
+	}
+	key, err := newPublicKey(publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("parse public key %s: %w", file, err)
+	}
+	return key, nil
+}
+
+func readPEM(file string) ([]byte, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("decode %s: no PEM data found", file)
+	}
+	return block.Bytes, nil
+}
+
+func newPublicKey(publicKey crypto.PublicKey) (*Key, error) {
+	key := &Key{verifyKey: publicKey}
+	switch publicKey.(type) {
+	case *rsa.PublicKey:
+		key.method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		key.method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", publicKey)
+	}
+
+	// Thumbprint is the SHA-256 of the required JWK members in lexicographic order.
+	jwk := key.JWK()
+	var members string
+	if jwk.Kty == "RSA" {
+		members = fmt.Sprintf(`{"e":"%s","kty":"RSA","n":"%s"}`, jwk.E, jwk.N)
+	} else {
+		members = fmt.Sprintf(`{"crv":"%s","kty":"OKP","x":"%s"}`, jwk.Crv, jwk.X)
+	}
+	sum := sha256.Sum256([]byte(members))
+	key.ID = base64.RawURLEncoding.EncodeToString(sum[:])
+	return key, nil
+}
+
+// JWK is a public key in JSON Web Key format (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`   // RSA modulus.
+	E   string `json:"e,omitempty"`   // RSA exponent.
+	Crv string `json:"crv,omitempty"` // OKP or EC curve.
+	X   string `json:"x,omitempty"`   // OKP public key, or EC x coordinate.
+	Y   string `json:"y,omitempty"`   // EC y coordinate.
+}
+
+// JWKSet is a JSON Web Key Set, served at "/.well-known/jwks.json".
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWK returns the public part of the key. It must not be called on HMAC keys.
+func (k *Key) JWK() JWK {
+	jwk := JWK{Kid: k.ID, Use: "sig", Alg: k.method.Alg()}
+	switch v := k.verifyKey.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(v.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(v.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(v)
+	}
+	return jwk
+}
+
+// PublicKey parses an RSA, EC (P-256) or Ed25519 public key, e.g. from the key set of another issuer.
+func (j JWK) PublicKey() (crypto.PublicKey, error) {
+	decode := func(s string) []byte {
+		b, _ := base64.RawURLEncoding.DecodeString(s)
+		return b
+	}
+	switch {
+	case j.Kty == "RSA" && j.N != "" && j.E != "":
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(decode(j.N)),
+			E: int(new(big.Int).SetBytes(decode(j.E)).Int64()),
+		}, nil
+	case j.Kty == "EC" && j.Crv == "P-256":
+		// Check that the point is on the curve. Uncompressed point format is 0x04 || x || y.
+		x, y := decode(j.X), decode(j.Y)
+		if _, err := ecdh.P256().NewPublicKey(append(append([]byte{4}, x...), y...)); err != nil {
+			return nil, fmt.Errorf("parse JWK %s: %w", j.Kid, err)
+		}
+		return &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}, nil
+	case j.Kty == "OKP" && j.Crv == "Ed25519" && len(decode(j.X)) == ed25519.PublicKeySize:
+		return ed25519.PublicKey(decode(j.X)), nil
+	}
+	return nil, fmt.Errorf("parse JWK %s: unsupported key type %s", j.Kid, j.Kty)
+}
+
+// Sign signs the claims, setting the key ID as "kid" header.
+func (k *Key) Sign(claims jwt.Claims) (string, error) {
+	if k.signKey == nil {
+		return "", errKeyNotSigning
+	}
+	token := jwt.NewWithClaims(k.method, claims)
+	if k.ID != "" {
+		token.Header["kid"] = k.ID
+	}
+	return token.SignedString(k.signKey)
+}
+
+func (k *Key) isHMAC() bool {
+	_, ok := k.method.(*jwt.SigningMethodHMAC)
+	return ok
+}
+
+var errKeyNotSigning = errors.New("signing key has no private part")
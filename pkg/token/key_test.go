@@ -0,0 +1,110 @@
+package token
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func newTestKey(t *testing.T) *Key {
+	t.Helper()
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := newPublicKey(privateKey.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	key.signKey = privateKey
+	return key
+}
+
+// signTestToken signs the claims like JWTAuth.GenerateToken does with the key.
+func signTestToken(t *testing.T, key *Key, claims jwt.Claims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(key.method, claims)
+	if key.ID != "" {
+		token.Header["kid"] = key.ID
+	}
+	signed, err := token.SignedString(key.signKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestVerifyTokenKeys(t *testing.T) {
+	signingKey, oldKey, unknownKey := newTestKey(t), newTestKey(t), newTestKey(t)
+	// Old key is rotated out, only its public key is kept for verification.
+	oldPublicKey, err := newPublicKey(oldKey.verifyKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth, err := NewJWTAuth(signingKey, oldPublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims := &jwtClaims{RegisteredClaims: jwt.RegisteredClaims{
+		Subject:   uuid.NewString(),
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	}}
+	sign := func(key *Key) string {
+		return signTestToken(t, key, claims)
+	}
+	// Public key used as HMAC secret, with the ID of the signing key (algorithm confusion).
+	confused := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	confused.Header["kid"] = signingKey.ID
+	confusedToken, err := confused.SignedString([]byte(signingKey.verifyKey.(ed25519.PublicKey)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// HMAC token without "kid", while no HMAC key is configured.
+	hmacToken := sign(NewHMACKey([]byte("secret")))
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{"signing key", sign(signingKey), false},
+		{"rotated-out key", sign(oldKey), false},
+		{"unknown key", sign(unknownKey), true},
+		{"algorithm of other key", confusedToken, true},
+		{"missing key ID", hmacToken, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := auth.VerifyToken(tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("VerifyToken() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	signingKey, oldKey := newTestKey(t), newTestKey(t)
+	auth, err := NewJWTAuth(signingKey, oldKey, NewHMACKey([]byte("secret")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	set := auth.JWKS()
+	if len(set.Keys) != 2 {
+		t.Fatalf("JWKS() has %d keys, want 2 without the HMAC key", len(set.Keys))
+	}
+	for _, jwk := range set.Keys {
+		if jwk.Kid != signingKey.ID && jwk.Kid != oldKey.ID {
+			t.Errorf("JWKS() has unknown key %s", jwk.Kid)
+		}
+		if jwk.Kty != "OKP" || jwk.Alg != "EdDSA" {
+			t.Errorf("JWKS() key %s is %s %s, want OKP EdDSA", jwk.Kid, jwk.Kty, jwk.Alg)
+		}
+	}
+}
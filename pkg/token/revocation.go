@@ -0,0 +1,180 @@
+package token
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RevocationStore keeps track of access tokens that are no longer valid before their expiry.
+type RevocationStore interface {
+	// Revoke invalidates a single token. The record can be dropped after expiresAt.
+	Revoke(ctx context.Context, tokenID string, expiresAt time.Time) error
+	// RevokeAllForUser invalidates all tokens of the user issued at or before the given time.
+	RevokeAllForUser(ctx context.Context, userID uuid.UUID, before time.Time) error
+	IsRevoked(ctx context.Context, claims *Claims) (bool, error)
+}
+
+// PostgresRevocationStore stores revocations in "revoked_token" and "user_token_revocation" tables.
+type PostgresRevocationStore struct {
+	db *sql.DB
+}
+
+func NewPostgresRevocationStore(db *sql.DB) *PostgresRevocationStore {
+	return &PostgresRevocationStore{db}
+}
+
+func (s *PostgresRevocationStore) Revoke(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO revoked_token (token_id, expires_at)
+		VALUES ($1, $2)
+		ON CONFLICT (token_id) DO NOTHING`,
+		tokenID, expiresAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	// Revocations of expired tokens are useless, clean them up on the way.
+	_, err = s.db.ExecContext(ctx, "DELETE FROM revoked_token WHERE expires_at < NOW()")
+	return err
+}
+
+func (s *PostgresRevocationStore) RevokeAllForUser(ctx context.Context, userID uuid.UUID, before time.Time) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO user_token_revocation (user_id, revoked_before)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET revoked_before = GREATEST(user_token_revocation.revoked_before, EXCLUDED.revoked_before)`,
+		userID, before,
+	)
+	return err
+}
+
+// IsRevoked revokes tokens issued at or before the time of RevokeAllForUser. Tokens without
+// sub-second issue time are revoked if issued in the same second, because they may have been issued before.
+func (s *PostgresRevocationStore) IsRevoked(ctx context.Context, claims *Claims) (bool, error) {
+	var revoked bool
+	err := s.db.QueryRowContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM revoked_token WHERE token_id = $1)
+			OR EXISTS (SELECT 1 FROM user_token_revocation WHERE user_id = $2 AND revoked_before >= $3)`,
+		claims.TokenID, claims.UserID, claims.IssuedAt,
+	).Scan(&revoked)
+	return revoked, err
+}
+
+// CachedRevocationStore caches lookups of another RevocationStore in memory,
+// so verifying a token doesn't cost a database round trip per request.
+//
+// Revocations made through this instance take effect immediately. Revocations made by other
+// app instances take effect once the cached "not revoked" result expires after ttl.
+type CachedRevocationStore struct {
+	store RevocationStore
+	ttl   time.Duration
+
+	mu      sync.Mutex
+	tokens  map[string]cachedRevocation
+	users   map[uuid.UUID]time.Time // Latest "revoked before" time known by this instance.
+	inserts int
+}
+
+type cachedRevocation struct {
+	revoked bool
+	until   time.Time
+}
+
+// sweepInterval is the number of cache inserts between removals of expired entries.
+const sweepInterval = 1000
+
+func NewCachedRevocationStore(store RevocationStore, ttl time.Duration) *CachedRevocationStore {
+	return &CachedRevocationStore{
+		store:  store,
+		ttl:    ttl,
+		tokens: make(map[string]cachedRevocation),
+		users:  make(map[uuid.UUID]time.Time),
+	}
+}
+
+func (s *CachedRevocationStore) Revoke(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	if err := s.store.Revoke(ctx, tokenID, expiresAt); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.set(tokenID, cachedRevocation{revoked: true, until: expiresAt})
+	return nil
+}
+
+func (s *CachedRevocationStore) RevokeAllForUser(ctx context.Context, userID uuid.UUID, before time.Time) error {
+	if err := s.store.RevokeAllForUser(ctx, userID, before); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if before.After(s.users[userID]) {
+		s.users[userID] = before
+	}
+	s.inserted()
+	return nil
+}
+
+func (s *CachedRevocationStore) IsRevoked(ctx context.Context, claims *Claims) (bool, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	if before, ok := s.users[claims.UserID]; ok && !claims.IssuedAt.After(before) {
+		s.mu.Unlock()
+		return true, nil
+	}
+	if c, ok := s.tokens[claims.TokenID]; ok && now.Before(c.until) {
+		s.mu.Unlock()
+		return c.revoked, nil
+	}
+	s.mu.Unlock()
+
+	revoked, err := s.store.IsRevoked(ctx, claims)
+	if err != nil {
+		return false, err
+	}
+
+	c := cachedRevocation{revoked: revoked, until: now.Add(s.ttl)}
+	if revoked {
+		// Revoked tokens stay revoked, so cache them until they expire.
+		c.until = claims.ExpiresAt
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.set(claims.TokenID, c)
+	return revoked, nil
+}
+
+// set must be called with s.mu held.
+func (s *CachedRevocationStore) set(tokenID string, c cachedRevocation) {
+	s.tokens[tokenID] = c
+	s.inserted()
+}
+
+// inserted removes expired entries every sweepInterval inserts. It must be called with s.mu held.
+func (s *CachedRevocationStore) inserted() {
+	s.inserts++
+	if s.inserts < sweepInterval {
+		return
+	}
+	s.inserts = 0
+	now := time.Now()
+	for k, v := range s.tokens {
+		if now.After(v.until) {
+			delete(s.tokens, k)
+		}
+	}
+	// Results cached as "not revoked" before the revocation have expired after ttl, so the store is asked
+	// about tokens issued before it anyway. Twice ttl covers lookups that were in flight during it.
+	for k, before := range s.users {
+		if now.Sub(before) > 2*s.ttl {
+			delete(s.users, k)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package token
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// fakeRevocationStore finds no revocations, and counts lookups.
+type fakeRevocationStore struct {
+	lookups int
+}
+
+func (s *fakeRevocationStore) Revoke(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	return nil
+}
+
+func (s *fakeRevocationStore) RevokeAllForUser(ctx context.Context, userID uuid.UUID, before time.Time) error {
+	return nil
+}
+
+func (s *fakeRevocationStore) IsRevoked(ctx context.Context, claims *Claims) (bool, error) {
+	s.lookups++
+	return false, nil
+}
+
+func TestCachedRevocationStoreRevokeAllForUser(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+	// Revoked in the middle of a second, so "iat" in seconds is the same before and after it.
+	revokedAt := time.Date(2024, time.January, 1, 12, 0, 0, 500_000_000, time.UTC)
+
+	tests := []struct {
+		name     string
+		userID   uuid.UUID
+		issuedAt time.Time
+		want     bool
+	}{
+		{"issued earlier", userID, revokedAt.Add(-time.Hour), true},
+		{"issued earlier in the same second", userID, revokedAt.Add(-400 * time.Millisecond), true},
+		{"issued at the same time", userID, revokedAt, true},
+		{"issued later in the same second", userID, revokedAt.Add(400 * time.Millisecond), false},
+		{"issued later", userID, revokedAt.Add(time.Hour), false},
+		{"other user", uuid.New(), revokedAt.Add(-time.Hour), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewCachedRevocationStore(&fakeRevocationStore{}, time.Minute)
+			if err := s.RevokeAllForUser(ctx, userID, revokedAt); err != nil {
+				t.Fatal(err)
+			}
+			claims := &Claims{TokenID: uuid.NewString(), UserID: tt.userID, IssuedAt: tt.issuedAt}
+			got, err := s.IsRevoked(ctx, claims)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("IsRevoked() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCachedRevocationStoreRevoke(t *testing.T) {
+	ctx := context.Background()
+	store := &fakeRevocationStore{}
+	s := NewCachedRevocationStore(store, time.Minute)
+	revoked := &Claims{TokenID: "revoked", UserID: uuid.New(), IssuedAt: time.Now()}
+	other := &Claims{TokenID: "other", UserID: revoked.UserID, IssuedAt: time.Now()}
+	if err := s.Revoke(ctx, revoked.TokenID, time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		claims      *Claims
+		want        bool
+		wantLookups int // Total lookups in the underlying store.
+	}{
+		{"revoked token", revoked, true, 0},
+		{"other token", other, false, 1},
+		{"other token is cached", other, false, 1},
+	}
+	for _, tt := range tests {
+		got, err := s.IsRevoked(ctx, tt.claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want || store.lookups != tt.wantLookups {
+			t.Errorf("%s: IsRevoked() = %v with %d lookups, want %v with %d", tt.name, got, store.lookups, tt.want, tt.wantLookups)
+		}
+	}
+}
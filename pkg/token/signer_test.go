@@ -0,0 +1,50 @@
+package token
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestSignerVerify(t *testing.T) {
+	s := NewSigner([]byte("secret"))
+	payload := []byte(`{"user_id":"1"}`)
+	signed := s.Sign(payload, []byte("alice@example.com"))
+	_, sig, _ := strings.Cut(signed, ".")
+	tampered, _, _ := strings.Cut(s.Sign([]byte(`{"user_id":"2"}`)), ".")
+
+	tests := []struct {
+		name    string
+		signer  *Signer
+		signed  string
+		binding [][]byte
+		wantErr bool
+	}{
+		{"valid", s, signed, [][]byte{[]byte("alice@example.com")}, false},
+		{"other binding", s, signed, [][]byte{[]byte("bob@example.com")}, true},
+		{"missing binding", s, signed, nil, true},
+		// Parts can't be moved between bindings.
+		{"split binding", s, signed, [][]byte{[]byte("alice@"), []byte("example.com")}, true},
+		{"other secret", NewSigner([]byte("other")), signed, [][]byte{[]byte("alice@example.com")}, true},
+		{"tampered payload", s, tampered + "." + sig, [][]byte{[]byte("alice@example.com")}, true},
+		{"missing signature", s, strings.TrimSuffix(signed, "."+sig), nil, true},
+		{"invalid base64", s, "!.!", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.signer.Verify(tt.signed, tt.binding...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Verify() error = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !bytes.Equal(got, payload) {
+				t.Errorf("Verify() = %s, want %s", got, payload)
+			}
+		})
+	}
+
+	// Payload can be read without the binding, but isn't verified.
+	got, err := s.Payload(signed)
+	if err != nil || !bytes.Equal(got, payload) {
+		t.Errorf("Payload() = (%s, %v), want %s", got, err, payload)
+	}
+}
@@ -1,8 +1,11 @@
 package token
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -16,54 +19,146 @@ var (
 	errTokenSubject = response.Error(http.StatusUnauthorized, "Token subject is not a valid UUID.")
 )
 
+// Claims are the verified claims of an access token or API token.
+type Claims struct {
+	TokenID   string
+	UserID    uuid.UUID
+	IssuedAt  time.Time
+	ExpiresAt time.Time // Zero for API tokens without expiry.
+	Scopes    []string  // Nil for access tokens, which have every scope.
+	APIToken  bool
+	Role      string
+	ActorID   uuid.UUID // Admin impersonating the user, or Nil.
+}
+
+// jwtClaims are the claims of access tokens. Impersonation tokens have an "act" claim (RFC 8693)
+// identifying the admin acting as the subject.
+type jwtClaims struct {
+	jwt.RegisteredClaims
+	// IssuedAtMicro is the issue time in microseconds. "iat" is in seconds, which can't tell a token issued
+	// right before a revocation from one issued right after it in the same second.
+	IssuedAtMicro int64       `json:"iat_us,omitempty"`
+	Role          string      `json:"role,omitempty"`
+	Actor         *actorClaim `json:"act,omitempty"`
+}
+
+type actorClaim struct {
+	Subject string `json:"sub"`
+}
+
 type JWTAuth struct {
-	secret []byte
+	signingKey *Key
+	keys       map[string]*Key // Verification keys by ID.
 }
 
-func NewJWTAuth(secret []byte) *JWTAuth {
-	return &JWTAuth{secret}
+// NewJWTAuth creates a JWTAuth that signs tokens with signingKey.
+// Tokens signed by any of the keys are accepted, so old keys can be kept during key rotation
+// until tokens signed by them have expired.
+func NewJWTAuth(signingKey *Key, verificationKeys ...*Key) (*JWTAuth, error) {
+	if signingKey.signKey == nil {
+		return nil, errKeyNotSigning
+	}
+	keys := map[string]*Key{signingKey.ID: signingKey}
+	for _, k := range verificationKeys {
+		keys[k.ID] = k
+	}
+	return &JWTAuth{signingKey, keys}, nil
 }
 
-func (auth *JWTAuth) GenerateToken(userID uuid.UUID, duration time.Duration) (string, error) {
-	claims := &jwt.RegisteredClaims{
-		Subject:   userID.String(),
-		ExpiresAt: jwt.NewNumericDate(time.Now().Add(duration)),
-		IssuedAt:  jwt.NewNumericDate(time.Now()),
+// JWKS returns the public verification keys as a JSON Web Key Set. HMAC keys are never published.
+func (auth *JWTAuth) JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	for _, k := range auth.keys {
+		if !k.isHMAC() {
+			set.Keys = append(set.Keys, k.JWK())
+		}
 	}
+	slices.SortFunc(set.Keys, func(a, b JWK) int { return strings.Compare(a.Kid, b.Kid) })
+	return set
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	signedToken, err := token.SignedString(auth.secret)
-	if err != nil {
-		return "", err
+func (auth *JWTAuth) GenerateToken(userID uuid.UUID, role string, duration time.Duration) (string, error) {
+	return auth.generateToken(userID, role, nil, duration)
+}
+
+// GenerateImpersonationToken generates a token for the admin with actorID to act as the user.
+func (auth *JWTAuth) GenerateImpersonationToken(
+	userID uuid.UUID,
+	role string,
+	actorID uuid.UUID,
+	duration time.Duration,
+) (string, error) {
+	return auth.generateToken(userID, role, &actorClaim{Subject: actorID.String()}, duration)
+}
+
+func (auth *JWTAuth) generateToken(userID uuid.UUID, role string, actor *actorClaim, duration time.Duration) (string, error) {
+	now := time.Now()
+	claims := &jwtClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(), // Used to revoke individual tokens.
+			Subject:   userID.String(),
+			ExpiresAt: jwt.NewNumericDate(now.Add(duration)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+		IssuedAtMicro: now.UnixMicro(),
+		Role:          role,
+		Actor:         actor,
 	}
-	return signedToken, nil
+
+	return auth.signingKey.Sign(claims)
 }
 
-func (auth *JWTAuth) VerifyToken(signedToken string) (uuid.UUID, error) {
-	token, err := jwt.ParseWithClaims(signedToken, &jwt.RegisteredClaims{}, func(token *jwt.Token) (any, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+func (auth *JWTAuth) VerifyToken(signedToken string) (*Claims, error) {
+	token, err := jwt.ParseWithClaims(signedToken, &jwtClaims{}, func(token *jwt.Token) (any, error) {
+		kid, _ := token.Header["kid"].(string)
+		key := auth.keys[kid]
+		if key == nil {
+			return nil, fmt.Errorf("unknown key ID: %s", kid)
+		}
+		// Algorithm must match the key, otherwise public keys could be used as HMAC secrets.
+		if token.Method.Alg() != key.method.Alg() {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
-		return auth.secret, nil
+		return key.verifyKey, nil
 	})
+	if errors.Is(err, jwt.ErrTokenExpired) {
+		return nil, errTokenExpired
+	}
 	if err != nil || !token.Valid {
-		return uuid.Nil, errTokenInvalid
+		return nil, errTokenInvalid
+	}
+
+	claims, ok := token.Claims.(*jwtClaims)
+	if !ok || claims.ExpiresAt == nil || claims.IssuedAt == nil {
+		return nil, errTokenInvalid
 	}
 
-	claims, ok := token.Claims.(*jwt.RegisteredClaims)
-	if !ok {
-		return uuid.Nil, errTokenInvalid
+	if time.Now().After(claims.ExpiresAt.Time) {
+		return nil, errTokenExpired
 	}
 
-	exp, _ := claims.GetExpirationTime() // Error value is always nil.
-	if time.Now().After(exp.Time) {
-		return uuid.Nil, errTokenExpired
+	issuedAt := claims.IssuedAt.Time
+	if claims.IssuedAtMicro != 0 {
+		issuedAt = time.UnixMicro(claims.IssuedAtMicro)
 	}
 
-	sub, _ := claims.GetSubject() // Error value is always nil.
-	userID, _ := uuid.Parse(sub)
+	userID, _ := uuid.Parse(claims.Subject)
 	if userID == uuid.Nil {
-		return uuid.Nil, errTokenSubject
+		return nil, errTokenSubject
+	}
+	var actorID uuid.UUID
+	if claims.Actor != nil {
+		actorID, _ = uuid.Parse(claims.Actor.Subject)
+		if actorID == uuid.Nil {
+			return nil, errTokenSubject
+		}
 	}
-	return userID, nil
+	return &Claims{
+		TokenID:   claims.ID,
+		UserID:    userID,
+		IssuedAt:  issuedAt,
+		ExpiresAt: claims.ExpiresAt.Time,
+		Role:      claims.Role,
+		ActorID:   actorID,
+	}, nil
 }
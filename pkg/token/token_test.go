@@ -0,0 +1,47 @@
+package token
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func TestVerifyTokenIssuedAt(t *testing.T) {
+	secret := []byte("secret")
+	auth, err := NewJWTAuth(NewHMACKey(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuedAt := time.Date(2024, time.January, 1, 12, 0, 0, 500_000_000, time.UTC)
+	expiresAt := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name   string
+		claims *jwtClaims
+		want   time.Time
+	}{
+		{"sub-second issue time", &jwtClaims{IssuedAtMicro: issuedAt.UnixMicro()}, issuedAt},
+		// Tokens issued before the private claim was added only have seconds.
+		{"issue time in seconds", &jwtClaims{}, issuedAt.Truncate(time.Second)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.claims.Subject = uuid.NewString()
+			tt.claims.IssuedAt = jwt.NewNumericDate(issuedAt)
+			tt.claims.ExpiresAt = jwt.NewNumericDate(expiresAt)
+			signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, tt.claims).SignedString(secret)
+			if err != nil {
+				t.Fatal(err)
+			}
+			claims, err := auth.VerifyToken(signed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !claims.IssuedAt.Equal(tt.want) {
+				t.Errorf("IssuedAt = %s, want %s", claims.IssuedAt, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package totp
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test vectors of RFC 6238 appendix B for SHA1, truncated to 6 digits.
+var rfcSecret = []byte("12345678901234567890")
+
+func TestCode(t *testing.T) {
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		t.Run(time.Unix(tt.unix, 0).UTC().Format(time.RFC3339), func(t *testing.T) {
+			if got := Code(rfcSecret, Step(time.Unix(tt.unix, 0))); got != tt.want {
+				t.Errorf("Code() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := Step(now)
+	tests := []struct {
+		name     string
+		code     string
+		skew     int64
+		wantStep int64
+		wantOK   bool
+	}{
+		{"current step", Code(rfcSecret, current), 0, current, true},
+		{"previous step within skew", Code(rfcSecret, current-1), 1, current - 1, true},
+		{"next step within skew", Code(rfcSecret, current+1), 1, current + 1, true},
+		{"previous step without skew", Code(rfcSecret, current-1), 0, 0, false},
+		{"step outside skew", Code(rfcSecret, current-2), 1, 0, false},
+		{"wrong code", "000000", 1, 0, false},
+		{"short code", Code(rfcSecret, current)[:5], 1, 0, false},
+		{"empty code", "", 1, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := Validate(rfcSecret, tt.code, now, tt.skew)
+			if ok != tt.wantOK || step != tt.wantStep {
+				t.Errorf("Validate() = (%d, %v), want (%d, %v)", step, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	a, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a) != secretSize || string(a) == string(b) {
+		t.Errorf("secrets %x and %x, want %d random bytes", a, b, secretSize)
+	}
+	if got := EncodeSecret(a); strings.Contains(got, "=") || len(got) != 32 {
+		t.Errorf("EncodeSecret() = %q, want 32 characters without padding", got)
+	}
+}
+
+func TestProvisioningURI(t *testing.T) {
+	uri, err := url.Parse(ProvisioningURI("Todolist", "user@example.com", rfcSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uri.Scheme != "otpauth" || uri.Host != "totp" || uri.Path != "/Todolist:user@example.com" {
+		t.Errorf("URI = %q", uri)
+	}
+	if got := uri.Query().Get("secret"); got != EncodeSecret(rfcSecret) {
+		t.Errorf("secret = %q, want %q", got, EncodeSecret(rfcSecret))
+	}
+}
@@ -19,7 +19,8 @@ SET user_id = $2,
     priority = $5,
     due_date = $6,
     completed = $7,
-    updated_at = NOW()
+    updated_at = NOW(),
+    version = version + 1
 WHERE id = $1;
 
 -- name: DeleteTodo :execrows